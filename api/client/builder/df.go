@@ -0,0 +1,69 @@
+package builder
+
+import (
+	"fmt"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/docker/docker/api/client"
+	"github.com/docker/docker/cli"
+	"github.com/docker/docker/pkg/stringid"
+	"github.com/docker/engine-api/types"
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+)
+
+type byLastUsed []types.BuildCacheEntry
+
+func (r byLastUsed) Len() int      { return len(r) }
+func (r byLastUsed) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r byLastUsed) Less(i, j int) bool {
+	return r[i].LastUsed.After(r[j].LastUsed)
+}
+
+type diskUsageOptions struct {
+	verbose bool
+}
+
+func newDiskUsageCommand(dockerCli *client.DockerCli) *cobra.Command {
+	var opts diskUsageOptions
+
+	cmd := &cobra.Command{
+		Use:   "df",
+		Short: "Show build cache disk usage",
+		Args:  cli.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDiskUsage(dockerCli, opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVarP(&opts.verbose, "verbose", "v", false, "Show the images of the build cache")
+
+	return cmd
+}
+
+func runDiskUsage(dockerCli *client.DockerCli, opts diskUsageOptions) error {
+	usage, err := dockerCli.Client().BuildCacheUsage(context.Background())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(dockerCli.Out(), 20, 1, 3, ' ', 0)
+	if opts.verbose {
+		fmt.Fprintf(w, "IMAGE ID\tSIZE\tLAST USED\tIN USE\n")
+		sort.Sort(byLastUsed(usage.Entries))
+		for _, e := range usage.Entries {
+			lastUsed := units.HumanDuration(time.Now().UTC().Sub(e.LastUsed)) + " ago"
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", stringid.TruncateID(e.ID), units.HumanSize(float64(e.Size)), lastUsed, e.InUse)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "IMAGES\tSIZE\tRECLAIMABLE\n")
+	fmt.Fprintf(w, "%d\t%s\t%s\n", len(usage.Entries), units.HumanSize(float64(usage.Size)), units.HumanSize(float64(usage.Reclaimable)))
+	w.Flush()
+	return nil
+}
@@ -0,0 +1,85 @@
+package builder
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"github.com/docker/docker/api/client"
+	"github.com/docker/docker/cli"
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+)
+
+type pruneOptions struct {
+	force       bool
+	keepStorage string
+}
+
+const (
+	allWarning = `WARNING! This will remove all the images of the build cache and all the
+cached Git repositories which are not in use.
+Are you sure you want to continue?`
+	keepStorageWarning = `WARNING! This will remove the least recently used images of the build cache
+and cached Git repositories which are not in use, until they take at most %s.
+Are you sure you want to continue?`
+)
+
+func newPruneCommand(dockerCli *client.DockerCli) *cobra.Command {
+	var opts pruneOptions
+
+	cmd := &cobra.Command{
+		Use:   "prune [OPTIONS]",
+		Short: "Remove unused build cache images",
+		Args:  cli.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPrune(dockerCli, opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVarP(&opts.force, "force", "f", false, "Do not prompt for confirmation")
+	flags.StringVar(&opts.keepStorage, "keep-storage", "", "Amount of disk space to keep for the build cache")
+
+	return cmd
+}
+
+func runPrune(dockerCli *client.DockerCli, opts pruneOptions) error {
+	// Without --keep-storage, no space is kept for the build cache.
+	var keepStorage int64
+	warning := allWarning
+	if opts.keepStorage != "" {
+		var err error
+		keepStorage, err = units.RAMInBytes(opts.keepStorage)
+		if err != nil {
+			return fmt.Errorf("invalid value for keep-storage: %v", err)
+		}
+		warning = fmt.Sprintf(keepStorageWarning, units.BytesSize(float64(keepStorage)))
+	}
+
+	if !opts.force && !client.PromptForConfirmation(dockerCli.In(), dockerCli.Out(), warning) {
+		return nil
+	}
+
+	report, err := dockerCli.Client().BuildCachePrune(context.Background(), keepStorage)
+	if err != nil {
+		return err
+	}
+
+	if len(report.ImagesDeleted) > 0 {
+		fmt.Fprintln(dockerCli.Out(), "Deleted build cache images:")
+		for _, id := range report.ImagesDeleted {
+			fmt.Fprintln(dockerCli.Out(), id)
+		}
+		fmt.Fprintln(dockerCli.Out())
+	}
+	if len(report.GitRepositoriesDeleted) > 0 {
+		fmt.Fprintln(dockerCli.Out(), "Deleted cached Git repositories:")
+		for _, remote := range report.GitRepositoriesDeleted {
+			fmt.Fprintln(dockerCli.Out(), remote)
+		}
+		fmt.Fprintln(dockerCli.Out())
+	}
+	fmt.Fprintf(dockerCli.Out(), "Total reclaimed space: %s\n", units.HumanSize(float64(report.SpaceReclaimed)))
+	return nil
+}
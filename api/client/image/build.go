@@ -4,23 +4,34 @@ import (
 	"archive/tar"
 	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strings"
 
 	"golang.org/x/net/context"
 
+	"github.com/docker/distribution/digest"
 	"github.com/docker/docker/api"
 	"github.com/docker/docker/api/client"
 	"github.com/docker/docker/builder"
+	"github.com/docker/docker/builder/dockerfile/lint"
+	"github.com/docker/docker/builder/dockerfile/parser"
 	"github.com/docker/docker/builder/dockerignore"
 	"github.com/docker/docker/cli"
 	"github.com/docker/docker/opts"
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/pkg/fileutils"
+	"github.com/docker/docker/pkg/ioutils"
 	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/docker/pkg/progress"
 	"github.com/docker/docker/pkg/streamformatter"
@@ -38,7 +49,11 @@ type buildOptions struct {
 	dockerfileName string
 	tags           opts.ListOpts
 	labels         []string
+	provenance     bool
+	epoch          string
+	network        string
 	buildArgs      opts.ListOpts
+	buildArgFiles  []string
 	ulimits        *runconfigopts.UlimitOpt
 	memory         string
 	memorySwap     string
@@ -55,6 +70,13 @@ type buildOptions struct {
 	rm             bool
 	forceRm        bool
 	pull           bool
+	check          bool
+	checkFormat    string
+	incremental    bool
+	submodules     bool
+	printContext   bool
+	output         string
+	progress       string
 }
 
 // NewBuildCommand creates a new `docker build` command
@@ -80,6 +102,7 @@ func NewBuildCommand(dockerCli *client.DockerCli) *cobra.Command {
 
 	flags.VarP(&options.tags, "tag", "t", "Name and optionally a tag in the 'name:tag' format")
 	flags.Var(&options.buildArgs, "build-arg", "Set build-time variables")
+	flags.StringSliceVar(&options.buildArgFiles, "build-arg-file", []string{}, "Read build-time variables from a file in the dotenv format")
 	flags.Var(options.ulimits, "ulimit", "Ulimit options")
 	flags.StringVarP(&options.dockerfileName, "file", "f", "", "Name of the Dockerfile (Default is 'PATH/Dockerfile')")
 	flags.StringVarP(&options.memory, "memory", "m", "", "Memory limit")
@@ -92,12 +115,22 @@ func NewBuildCommand(dockerCli *client.DockerCli) *cobra.Command {
 	flags.StringVar(&options.cpuSetMems, "cpuset-mems", "", "MEMs in which to allow execution (0-3, 0,1)")
 	flags.StringVar(&options.cgroupParent, "cgroup-parent", "", "Optional parent cgroup for the container")
 	flags.StringVar(&options.isolation, "isolation", "", "Container isolation technology")
+	flags.StringVar(&options.network, "network", "default", "Network mode of the RUN instructions, 'default' or 'none' to disable the network")
 	flags.StringSliceVar(&options.labels, "label", []string{}, "Set metadata for an image")
+	flags.BoolVar(&options.provenance, "provenance-labels", false, "Label the image with how it was built")
+	flags.StringVar(&options.epoch, "source-date-epoch", os.Getenv("SOURCE_DATE_EPOCH"), "Timestamp, in seconds since the Unix epoch, to build a reproducible image with")
 	flags.BoolVar(&options.noCache, "no-cache", false, "Do not use cache when building the image")
 	flags.BoolVar(&options.rm, "rm", true, "Remove intermediate containers after a successful build")
 	flags.BoolVar(&options.forceRm, "force-rm", false, "Always remove intermediate containers")
 	flags.BoolVarP(&options.quiet, "quiet", "q", false, "Suppress the build output and print image ID on success")
 	flags.BoolVar(&options.pull, "pull", false, "Always attempt to pull a newer version of the image")
+	flags.BoolVar(&options.check, "check", false, "Check the Dockerfile for common issues instead of building it")
+	flags.StringVar(&options.checkFormat, "check-format", "text", "Format of the --check report, 'text' or 'json'")
+	flags.BoolVar(&options.incremental, "incremental", false, "Only send the files of the context used by the build and changed since the previous build")
+	flags.BoolVar(&options.submodules, "recurse-submodules", true, "Check out the submodules of a Git repository context")
+	flags.BoolVar(&options.printContext, "print-context", false, "Print the files of the context sent to the daemon instead of building")
+	flags.StringVar(&options.progress, "progress", "auto", "Format of the build progress, 'auto' or 'json'")
+	flags.StringVarP(&options.output, "output", "o", "", "Export the root filesystem instead of creating an image (type=local,dest=<dir> or type=tar[,dest=<file>])")
 
 	client.AddTrustedFlags(flags, true)
 
@@ -117,12 +150,52 @@ func runBuild(dockerCli *client.DockerCli, options buildOptions) error {
 		contextDir    string
 		tempDir       string
 		relDockerfile string
+		remoteContext string
+		gitAuth       *types.AuthConfig
 		progBuff      io.Writer
 		buildBuff     io.Writer
 	)
 
 	progBuff = dockerCli.Out()
 	buildBuff = dockerCli.Out()
+	isTerminalOut := dockerCli.IsTerminalOut()
+
+	var progressEvents *json.Encoder
+	switch options.progress {
+	case "auto":
+	case "json":
+		// Only the events are written to stdout, one JSON object per line.
+		progressEvents = json.NewEncoder(dockerCli.Out())
+		progBuff = dockerCli.Err()
+		buildBuff = dockerCli.Err()
+		isTerminalOut = false
+	default:
+		return fmt.Errorf("invalid --progress %q, must be 'auto' or 'json'", options.progress)
+	}
+
+	var output *buildOutput
+	if options.output != "" {
+		if output, err = parseBuildOutput(options.output); err != nil {
+			return err
+		}
+		if len(options.tags.GetAll()) > 0 {
+			return fmt.Errorf("--output and --tag can't be used together")
+		}
+		if output.toStdout() {
+			if progressEvents != nil {
+				return errors.New("--progress=json can't be used when writing the exported archive to stdout")
+			}
+			if isTerminalOut {
+				return errors.New("Cowardly refusing to write the exported archive to a terminal. Use dest=<file> or redirect.")
+			}
+			// The archive is written to stdout, keep it free of any
+			// progress messages.
+			progBuff = dockerCli.Err()
+			buildBuff = dockerCli.Err()
+			isTerminalOut = false
+		}
+	}
+
 	if options.quiet {
 		progBuff = bytes.NewBuffer(nil)
 		buildBuff = bytes.NewBuffer(nil)
@@ -131,6 +204,12 @@ func runBuild(dockerCli *client.DockerCli, options buildOptions) error {
 	switch {
 	case specifiedContext == "-":
 		buildCtx, relDockerfile, err = builder.GetContextFromReader(dockerCli.In(), options.dockerfileName)
+	case urlutil.IsGitURL(specifiedContext) && daemonGitContext(specifiedContext, options):
+		// The daemon checks out the repository itself, fetching only what
+		// changed since the previous build of the same repository.
+		remoteContext, gitAuth = splitGitCredentials(specifiedContext)
+		relDockerfile = options.dockerfileName
+		buildCtx = ioutil.NopCloser(bytes.NewReader(nil))
 	case urlutil.IsGitURL(specifiedContext):
 		tempDir, relDockerfile, err = builder.GetContextFromGitURL(specifiedContext, options.dockerfileName)
 	case urlutil.IsURL(specifiedContext):
@@ -151,6 +230,28 @@ func runBuild(dockerCli *client.DockerCli, options buildOptions) error {
 		contextDir = tempDir
 	}
 
+	if options.check {
+		var dockerfile io.Reader
+		if buildCtx != nil {
+			defer buildCtx.Close()
+			dockerfile, err = dockerfileFromTar(buildCtx, relDockerfile)
+		} else {
+			var f *os.File
+			f, err = os.Open(filepath.Join(contextDir, relDockerfile))
+			if err == nil {
+				defer f.Close()
+				dockerfile = f
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read Dockerfile: %v", err)
+		}
+		return checkDockerfile(dockerCli.Out(), dockerfile, options.checkFormat)
+	}
+
+	ctx := context.Background()
+
+	var sessionID string
 	if buildCtx == nil {
 		// And canonicalize dockerfile name to a platform-independent one
 		relDockerfile, err = archive.CanonicalTarNameForPath(relDockerfile)
@@ -158,23 +259,25 @@ func runBuild(dockerCli *client.DockerCli, options buildOptions) error {
 			return fmt.Errorf("cannot canonicalize dockerfile path %s: %v", relDockerfile, err)
 		}
 
-		f, err := os.Open(filepath.Join(contextDir, ".dockerignore"))
-		if err != nil && !os.IsNotExist(err) {
+		ignoreFile, excludes, err := readDockerignore(contextDir, relDockerfile)
+		if err != nil {
 			return err
 		}
 
-		var excludes []string
-		if err == nil {
-			excludes, err = dockerignore.ReadAll(f)
-			if err != nil {
-				return err
-			}
-		}
-
 		if err := builder.ValidateContextDirectory(contextDir, excludes); err != nil {
 			return fmt.Errorf("Error checking context: '%s'.", err)
 		}
 
+		if options.printContext {
+			return walkBuildContext(contextDir, relDockerfile, ignoreFile, excludes, func(relPath string, info os.FileInfo) error {
+				if info.IsDir() {
+					relPath += "/"
+				}
+				_, err := fmt.Fprintln(dockerCli.Out(), relPath)
+				return err
+			})
+		}
+
 		// If .dockerignore mentions .dockerignore or the Dockerfile
 		// then make sure we send both files over to the daemon
 		// because Dockerfile is, obviously, needed no matter what, and
@@ -183,24 +286,32 @@ func runBuild(dockerCli *client.DockerCli, options buildOptions) error {
 		// parses the Dockerfile. Ignore errors here, as they will have been
 		// caught by validateContextDirectory above.
 		var includes = []string{"."}
-		keepThem1, _ := fileutils.Matches(".dockerignore", excludes)
-		keepThem2, _ := fileutils.Matches(relDockerfile, excludes)
-		if keepThem1 || keepThem2 {
-			includes = append(includes, ".dockerignore", relDockerfile)
+		if ignoreFile != "" {
+			keepThem1, _ := fileutils.Matches(ignoreFile, excludes)
+			keepThem2, _ := fileutils.Matches(relDockerfile, excludes)
+			if keepThem1 || keepThem2 {
+				includes = append(includes, ignoreFile, relDockerfile)
+			}
 		}
 
-		buildCtx, err = archive.TarWithOptions(contextDir, &archive.TarOptions{
-			Compression:     archive.Uncompressed,
-			ExcludePatterns: excludes,
-			IncludeFiles:    includes,
-		})
+		if options.incremental {
+			sessionID, buildCtx, err = syncBuildContext(ctx, dockerCli, contextDir, relDockerfile, ignoreFile, excludes)
+		} else {
+			buildCtx, err = archive.TarWithOptions(contextDir, &archive.TarOptions{
+				Compression:     archive.Uncompressed,
+				ExcludePatterns: excludes,
+				IncludeFiles:    includes,
+			})
+		}
 		if err != nil {
 			return err
 		}
+	} else if options.incremental {
+		return fmt.Errorf("--incremental is only supported with a local context directory")
+	} else if options.printContext {
+		return fmt.Errorf("--print-context is only supported with a local context directory or a Git repository")
 	}
 
-	ctx := context.Background()
-
 	var resolvedTags []*resolvedTag
 	if client.IsTrusted() {
 		// Wrap the tar archive to replace the Dockerfile entry with the rewritten
@@ -243,6 +354,17 @@ func runBuild(dockerCli *client.DockerCli, options buildOptions) error {
 		}
 	}
 
+	buildArgs, err := readBuildArgs(options)
+	if err != nil {
+		return err
+	}
+	// The commit is sent apart from the build args, so that daemons which
+	// don't know VCS_REF ignore it instead of reporting it as not consumed.
+	var vcsRef string
+	if contextDir != "" {
+		vcsRef = gitCommit(contextDir)
+	}
+
 	buildOptions := types.ImageBuildOptions{
 		Memory:         memory,
 		MemorySwap:     memorySwap,
@@ -252,6 +374,7 @@ func runBuild(dockerCli *client.DockerCli, options buildOptions) error {
 		Remove:         options.rm,
 		ForceRemove:    options.forceRm,
 		PullParent:     options.pull,
+		VCSRef:         vcsRef,
 		Isolation:      container.Isolation(options.isolation),
 		CPUSetCPUs:     options.cpuSetCpus,
 		CPUSetMems:     options.cpuSetMems,
@@ -262,18 +385,63 @@ func runBuild(dockerCli *client.DockerCli, options buildOptions) error {
 		Dockerfile:     relDockerfile,
 		ShmSize:        shmSize,
 		Ulimits:        options.ulimits.GetList(),
-		BuildArgs:      runconfigopts.ConvertKVStringsToMap(options.buildArgs.GetAll()),
+		BuildArgs:      buildArgs,
 		AuthConfigs:    dockerCli.RetrieveAuthConfigs(),
 		Labels:         runconfigopts.ConvertKVStringsToMap(options.labels),
+		SessionID:      sessionID,
+	}
+	buildOptions.ProvenanceLabels = options.provenance
+	buildOptions.SourceDateEpoch = options.epoch
+	buildOptions.NetworkMode = options.network
+	if remoteContext != "" {
+		buildOptions.RemoteContext = remoteContext
+		buildOptions.RecurseSubmodules = options.submodules
+		buildOptions.GitAuthConfig = gitAuth
+	}
+
+	var (
+		exportWriter io.WriteCloser
+		exportErr    error
+	)
+	if output != nil {
+		buildOptions.Export = true
+		buildOptions.ExportStage = output.stage
+		if exportWriter, err = output.open(dockerCli.Out()); err != nil {
+			return err
+		}
+	}
+	buildOptions.Events = progressEvents != nil
+
+	auxCallback := func(msg *json.RawMessage) {
+		var aux types.BuildAux
+		if err := json.Unmarshal(*msg, &aux); err != nil {
+			return
+		}
+		if aux.Event != nil && progressEvents != nil {
+			progressEvents.Encode(aux.Event)
+		}
+		if len(aux.ExportData) > 0 && exportWriter != nil && exportErr == nil {
+			if _, err := exportWriter.Write(aux.ExportData); err != nil {
+				exportErr = fmt.Errorf("unable to write the exported files: %v", err)
+			}
+		}
 	}
 
 	response, err := dockerCli.Client().ImageBuild(ctx, body, buildOptions)
 	if err != nil {
+		if exportWriter != nil {
+			exportWriter.Close()
+		}
 		return err
 	}
 	defer response.Body.Close()
 
-	err = jsonmessage.DisplayJSONMessagesStream(response.Body, buildBuff, dockerCli.OutFd(), dockerCli.IsTerminalOut(), nil)
+	err = jsonmessage.DisplayJSONMessagesStream(response.Body, buildBuff, dockerCli.OutFd(), isTerminalOut, auxCallback)
+	if exportWriter != nil {
+		if closeErr := exportWriter.Close(); err == nil && exportErr == nil && closeErr != nil {
+			exportErr = fmt.Errorf("unable to write the exported files: %v", closeErr)
+		}
+	}
 	if err != nil {
 		if jerr, ok := err.(*jsonmessage.JSONError); ok {
 			// If no error code is set, default to 1
@@ -287,6 +455,10 @@ func runBuild(dockerCli *client.DockerCli, options buildOptions) error {
 		}
 	}
 
+	if exportErr != nil {
+		return exportErr
+	}
+
 	// Windows: show error message about modified file permissions if the
 	// daemon isn't running Windows.
 	if response.OSType != "windows" && runtime.GOOS == "windows" {
@@ -294,8 +466,9 @@ func runBuild(dockerCli *client.DockerCli, options buildOptions) error {
 	}
 
 	// Everything worked so if -q was provided the output from the daemon
-	// should be just the image ID and we'll print that to stdout.
-	if options.quiet {
+	// should be just the image ID and we'll print that to stdout, unless
+	// stdout is reserved for the build events.
+	if options.quiet && progressEvents == nil {
 		fmt.Fprintf(dockerCli.Out(), "%s", buildBuff)
 	}
 
@@ -312,6 +485,56 @@ func runBuild(dockerCli *client.DockerCli, options buildOptions) error {
 	return nil
 }
 
+// checkDockerfile lints the given Dockerfile and writes the issues found to
+// out. It returns a status error if there are any issues.
+func checkDockerfile(out io.Writer, dockerfile io.Reader, format string) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("invalid --check-format %q, must be 'text' or 'json'", format)
+	}
+
+	ast, err := parser.Parse(dockerfile)
+	if err != nil {
+		return err
+	}
+	issues := lint.Check(ast)
+
+	if format == "json" {
+		if issues == nil {
+			issues = []lint.Issue{}
+		}
+		if err := json.NewEncoder(out).Encode(issues); err != nil {
+			return err
+		}
+	} else {
+		for _, issue := range issues {
+			fmt.Fprintln(out, issue)
+		}
+	}
+
+	if len(issues) > 0 {
+		return cli.StatusError{StatusCode: 1}
+	}
+	return nil
+}
+
+// dockerfileFromTar returns the content of the Dockerfile named
+// dockerfileName in the given tar archive.
+func dockerfileFromTar(tarStream io.Reader, dockerfileName string) (io.Reader, error) {
+	tarReader := tar.NewReader(tarStream)
+	for {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("Cannot locate specified Dockerfile: %s", dockerfileName)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if filepath.Clean(hdr.Name) == filepath.Clean(dockerfileName) {
+			return tarReader, nil
+		}
+	}
+}
+
 type translatorFunc func(context.Context, reference.NamedTagged) (reference.Canonical, error)
 
 // validateTag checks if the given image name can be resolved.
@@ -430,3 +653,286 @@ func replaceDockerfileTarWrapper(ctx context.Context, inputTarStream io.ReadClos
 
 	return pipeReader
 }
+
+// readBuildArgs returns the build-time variables read from the files given
+// with --build-arg-file, in order, overridden by the ones given with
+// --build-arg.
+func readBuildArgs(options buildOptions) (map[string]string, error) {
+	var args []string
+	for _, file := range options.buildArgFiles {
+		fileArgs, err := runconfigopts.ParseDotEnvFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read build args from %s: %v", file, err)
+		}
+		args = append(args, fileArgs...)
+	}
+	args = append(args, options.buildArgs.GetAll()...)
+	return runconfigopts.ConvertKVStringsToMap(args), nil
+}
+
+// gitCommit returns the ID of the commit checked out in the Git work tree
+// containing dir, if any, to be passed to the build as VCS_REF.
+func gitCommit(dir string) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		return ""
+	}
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", "HEAD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// daemonGitContext reports whether the Git repository at gitURL is checked
+// out by the daemon instead of being cloned locally. Repositories accessed
+// over SSH are cloned locally, with the keys of the user, as are the ones
+// whose files are needed by the client.
+func daemonGitContext(gitURL string, options buildOptions) bool {
+	if strings.HasPrefix(gitURL, "git@") {
+		return false
+	}
+	return !options.check && !options.printContext && !options.incremental && !client.IsTrusted()
+}
+
+// splitGitCredentials returns gitURL without the credentials it embeds, if
+// any, along with them, so that they are sent to the daemon separately from
+// the URL of the repository.
+func splitGitCredentials(gitURL string) (string, *types.AuthConfig) {
+	if !urlutil.IsURL(gitURL) {
+		return gitURL, nil
+	}
+	u, err := url.Parse(gitURL)
+	if err != nil || u.User == nil {
+		return gitURL, nil
+	}
+	password, _ := u.User.Password()
+	auth := &types.AuthConfig{Username: u.User.Username(), Password: password}
+	u.User = nil
+	return u.String(), auth
+}
+
+// readDockerignore reads the ignore file of a build of relDockerfile in
+// contextDir, and returns its name relative to contextDir along with the
+// patterns it holds. The name is empty if the context has no ignore file.
+func readDockerignore(contextDir, relDockerfile string) (string, []string, error) {
+	for _, name := range dockerignore.FileNames(relDockerfile) {
+		f, err := os.Open(filepath.Join(contextDir, filepath.FromSlash(name)))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", nil, err
+		}
+		excludes, err := dockerignore.ReadAll(f)
+		if err != nil {
+			return "", nil, err
+		}
+		return name, excludes, nil
+	}
+	return "", nil, nil
+}
+
+// walkBuildContext calls fn, in lexical order, for every file and directory
+// of contextDir sent to the daemon as the build context, given the patterns
+// of its ignore file. Paths are slash separated and relative to contextDir.
+func walkBuildContext(contextDir, relDockerfile, ignoreFile string, excludes []string, fn func(relPath string, info os.FileInfo) error) error {
+	_, _, exceptions, err := fileutils.CleanPatterns(excludes)
+	if err != nil {
+		return err
+	}
+
+	return filepath.Walk(contextDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relFilePath, err := filepath.Rel(contextDir, filePath)
+		if err != nil {
+			return err
+		}
+		if relFilePath == "." {
+			return nil
+		}
+		relPath := filepath.ToSlash(relFilePath)
+
+		// The Dockerfile and its ignore file are always sent, the daemon
+		// removes them if they are excluded.
+		if relPath != ignoreFile && relPath != relDockerfile {
+			skip, err := fileutils.Matches(relFilePath, excludes)
+			if err != nil {
+				return err
+			}
+			if skip {
+				if info.IsDir() && !exceptions && !strings.HasPrefix(relDockerfile, relPath+"/") && !strings.HasPrefix(ignoreFile, relPath+"/") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		return fn(relPath, info)
+	})
+}
+
+// contextFileDigest returns the digest of the content of the file of a build
+// context at path, or of its target if it is a symbolic link. Directories and
+// special files have no digest.
+func contextFileDigest(path string, info os.FileInfo) (string, error) {
+	switch {
+	case info.Mode().IsRegular():
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		dgst, err := digest.FromReader(f)
+		return dgst.String(), err
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		return digest.FromBytes([]byte(target)).String(), nil
+	}
+	return "", nil
+}
+
+// syncBuildContext describes the context directory to the daemon, and returns
+// the ID of the build session along with a tar archive of the files the
+// daemon asked for: the ones the build uses that changed since the previous
+// build of the same directory.
+func syncBuildContext(ctx context.Context, dockerCli *client.DockerCli, contextDir, relDockerfile, ignoreFile string, excludes []string) (string, io.ReadCloser, error) {
+	var files []types.BuildContextFile
+	err := walkBuildContext(contextDir, relDockerfile, ignoreFile, excludes, func(relPath string, info os.FileInfo) error {
+		dgst, err := contextFileDigest(filepath.Join(contextDir, filepath.FromSlash(relPath)), info)
+		if err != nil {
+			return err
+		}
+		files = append(files, types.BuildContextFile{
+			Path:    relPath,
+			Mode:    info.Mode(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Digest:  dgst,
+		})
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	dockerfile, err := ioutil.ReadFile(filepath.Join(contextDir, filepath.FromSlash(relDockerfile)))
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Builds of the same directory from the same host share a session, so
+	// that the daemon can reuse the files it received for the previous one.
+	hostname, _ := os.Hostname()
+	sessionID := fmt.Sprintf("%x", sha256.Sum256([]byte(hostname+"\x00"+contextDir)))
+
+	response, err := dockerCli.Client().BuildContextSync(ctx, types.BuildContextSyncRequest{
+		SessionID:         sessionID,
+		Dockerfile:        relDockerfile,
+		DockerfileContent: dockerfile,
+		Files:             files,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	// The Dockerfile is always sent, as it may be rewritten on the way
+	// to the daemon when content trust is enabled.
+	includes := []string{relDockerfile}
+	for _, p := range response.Required {
+		if p != relDockerfile {
+			includes = append(includes, p)
+		}
+	}
+
+	buildCtx, err := archive.TarWithOptions(contextDir, &archive.TarOptions{
+		Compression:  archive.Uncompressed,
+		IncludeFiles: includes,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return sessionID, buildCtx, nil
+}
+
+// buildOutput is where the root filesystem produced by a build is exported,
+// as given to --output.
+type buildOutput struct {
+	typ   string
+	dest  string
+	stage string
+}
+
+// parseBuildOutput parses the value of --output, a comma separated list of
+// key=value pairs such as "type=local,dest=out".
+func parseBuildOutput(value string) (*buildOutput, error) {
+	output := &buildOutput{}
+	for _, field := range strings.Split(value, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid field %q in --output, must be a key=value pair", field)
+		}
+		switch key := strings.ToLower(strings.TrimSpace(parts[0])); key {
+		case "type":
+			output.typ = parts[1]
+		case "dest":
+			output.dest = parts[1]
+		case "stage":
+			output.stage = parts[1]
+		default:
+			return nil, fmt.Errorf("unknown key %q in --output", key)
+		}
+	}
+
+	switch output.typ {
+	case "local":
+		if output.dest == "" {
+			return nil, fmt.Errorf("--output type=local requires a destination directory, set with dest=<dir>")
+		}
+	case "tar":
+		if output.dest == "" {
+			output.dest = "-"
+		}
+	default:
+		return nil, fmt.Errorf("invalid --output type %q, must be 'local' or 'tar'", output.typ)
+	}
+	return output, nil
+}
+
+func (o *buildOutput) toStdout() bool {
+	return o.typ == "tar" && o.dest == "-"
+}
+
+// open returns a writer for the exported tar archive. When exporting to a
+// local directory, the archive is extracted as it is written, and closing
+// the writer waits for the extraction to complete.
+func (o *buildOutput) open(stdout io.Writer) (io.WriteCloser, error) {
+	if o.typ == "tar" {
+		if o.toStdout() {
+			return ioutils.NopWriteCloser(stdout), nil
+		}
+		return os.Create(o.dest)
+	}
+
+	if err := os.MkdirAll(o.dest, 0755); err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := archive.Untar(pr, o.dest, &archive.TarOptions{NoLchown: true})
+		// Unblock the writer if the extraction failed.
+		pr.CloseWithError(err)
+		done <- err
+	}()
+	return ioutils.NewWriteCloserWrapper(pw, func() error {
+		pw.Close()
+		return <-done
+	}), nil
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/docker/docker/api/client"
 	"github.com/docker/docker/cli"
+	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/spf13/cobra"
 )
@@ -32,7 +33,7 @@ func NewLoadCommand(dockerCli *client.DockerCli) *cobra.Command {
 
 	flags := cmd.Flags()
 
-	flags.StringVarP(&opts.input, "input", "i", "", "Read from tar archive file, instead of STDIN")
+	flags.StringVarP(&opts.input, "input", "i", "", "Read from tar archive file or OCI image layout directory, instead of STDIN")
 	flags.BoolVarP(&opts.quiet, "quiet", "q", false, "Suppress the load output")
 
 	return cmd
@@ -42,12 +43,26 @@ func runLoad(dockerCli *client.DockerCli, opts loadOptions) error {
 
 	var input io.Reader = dockerCli.In()
 	if opts.input != "" {
-		file, err := os.Open(opts.input)
+		fi, err := os.Stat(opts.input)
 		if err != nil {
 			return err
 		}
-		defer file.Close()
-		input = file
+		if fi.IsDir() {
+			// An OCI image layout directory is sent as a tar.
+			dirTar, err := archive.Tar(opts.input, archive.Uncompressed)
+			if err != nil {
+				return err
+			}
+			defer dirTar.Close()
+			input = dirTar
+		} else {
+			file, err := os.Open(opts.input)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			input = file
+		}
 	}
 	if !dockerCli.IsTerminalOut() {
 		opts.quiet = true
@@ -14,8 +14,9 @@ import (
 )
 
 type pullOptions struct {
-	remote string
-	all    bool
+	remote   string
+	all      bool
+	platform string
 }
 
 // NewPullCommand creates a new `docker pull` command
@@ -35,6 +36,7 @@ func NewPullCommand(dockerCli *client.DockerCli) *cobra.Command {
 	flags := cmd.Flags()
 
 	flags.BoolVarP(&opts.all, "all-tags", "a", false, "Download all tagged images in the repository")
+	flags.StringVar(&opts.platform, "platform", "", "Select the os/architecture[/variant] of multi-platform images")
 	client.AddTrustedFlags(flags, true)
 
 	return cmd
@@ -72,14 +74,21 @@ func runPull(dockerCli *client.DockerCli, opts pullOptions) error {
 
 	ctx := context.Background()
 
+	if opts.platform != "" {
+		// Older daemons ignore the platform and pull the one of the daemon.
+		if err := dockerCli.RequireAPIVersion(ctx, "1.25", "--platform"); err != nil {
+			return err
+		}
+	}
+
 	authConfig := dockerCli.ResolveAuthConfig(ctx, repoInfo.Index)
 	requestPrivilege := dockerCli.RegistryAuthenticationPrivilegedFunc(repoInfo.Index, "pull")
 
 	if client.IsTrusted() && !registryRef.HasDigest() {
 		// Check if tag is digest
-		return dockerCli.TrustedPull(ctx, repoInfo, registryRef, authConfig, requestPrivilege)
+		return dockerCli.TrustedPull(ctx, repoInfo, registryRef, authConfig, requestPrivilege, opts.platform)
 	}
 
-	return dockerCli.ImagePullPrivileged(ctx, authConfig, distributionRef.String(), requestPrivilege, opts.all)
+	return dockerCli.ImagePullPrivileged(ctx, authConfig, distributionRef.String(), requestPrivilege, opts.all, opts.platform)
 
 }
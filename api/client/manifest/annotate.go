@@ -0,0 +1,86 @@
+package manifest
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/client"
+	"github.com/docker/docker/cli"
+	"github.com/spf13/cobra"
+)
+
+type annotateOptions struct {
+	list       string
+	manifest   string
+	os         string
+	arch       string
+	variant    string
+	osVersion  string
+	osFeatures []string
+}
+
+func newAnnotateCommand(dockerCli *client.DockerCli) *cobra.Command {
+	var opts annotateOptions
+
+	cmd := &cobra.Command{
+		Use:   "annotate [OPTIONS] MANIFEST_LIST MANIFEST",
+		Short: "Set the platform of a manifest in a local manifest list",
+		Args:  cli.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.list = args[0]
+			opts.manifest = args[1]
+			return runAnnotate(dockerCli, cmd, opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.os, "os", "", "Set the operating system")
+	flags.StringVar(&opts.arch, "arch", "", "Set the architecture")
+	flags.StringVar(&opts.variant, "variant", "", "Set the architecture variant")
+	flags.StringVar(&opts.osVersion, "os-version", "", "Set the operating system version")
+	flags.StringSliceVar(&opts.osFeatures, "os-features", nil, "Set the operating system features")
+
+	return cmd
+}
+
+func runAnnotate(dockerCli *client.DockerCli, cmd *cobra.Command, opts annotateOptions) error {
+	listRef, err := parseListRef(opts.list)
+	if err != nil {
+		return err
+	}
+	ref, err := parseRef(opts.manifest)
+	if err != nil {
+		return err
+	}
+
+	entry, err := loadEntry(listRef, ref)
+	if err != nil {
+		return err
+	}
+
+	flags := cmd.Flags()
+	platform := &entry.Descriptor.Platform
+	if flags.Changed("os") {
+		platform.OS = opts.os
+	}
+	if flags.Changed("arch") {
+		platform.Architecture = opts.arch
+	}
+	if flags.Changed("variant") {
+		platform.Variant = opts.variant
+	}
+	if flags.Changed("os-version") {
+		platform.OSVersion = opts.osVersion
+	}
+	if flags.Changed("os-features") {
+		platform.OSFeatures = opts.osFeatures
+	}
+	if platform.OS == "" || platform.Architecture == "" {
+		return fmt.Errorf("the operating system and the architecture of %s can't be empty", ref)
+	}
+
+	if err := saveEntry(listRef, entry); err != nil {
+		return err
+	}
+	fmt.Fprintf(dockerCli.Out(), "%s\n", ref)
+	return nil
+}
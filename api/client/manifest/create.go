@@ -0,0 +1,93 @@
+package manifest
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/net/context"
+
+	"github.com/docker/docker/api/client"
+	"github.com/docker/docker/cli"
+	"github.com/docker/docker/reference"
+	"github.com/spf13/cobra"
+)
+
+type createOptions struct {
+	list      string
+	manifests []string
+	amend     bool
+	insecure  bool
+}
+
+func newCreateCommand(dockerCli *client.DockerCli) *cobra.Command {
+	var opts createOptions
+
+	cmd := &cobra.Command{
+		Use:   "create [OPTIONS] MANIFEST_LIST MANIFEST [MANIFEST...]",
+		Short: "Create a local manifest list to annotate and push to a registry",
+		Args:  cli.RequiresMinArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.list = args[0]
+			opts.manifests = args[1:]
+			return runCreate(dockerCli, opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVarP(&opts.amend, "amend", "a", false, "Amend an existing manifest list")
+	flags.BoolVar(&opts.insecure, "insecure", false, "Allow communication with an insecure registry")
+
+	return cmd
+}
+
+func runCreate(dockerCli *client.DockerCli, opts createOptions) error {
+	listRef, err := parseListRef(opts.list)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(listDir(listRef)); err == nil && !opts.amend {
+		return fmt.Errorf("manifest list %s already exists, use --amend to add manifests to it", listRef)
+	}
+
+	ctx := context.Background()
+
+	for _, name := range opts.manifests {
+		ref, err := parseRef(name)
+		if err != nil {
+			return err
+		}
+		if ref.Hostname() != listRef.Hostname() {
+			return fmt.Errorf("manifest %s is not in the registry of the manifest list %s", ref, listRef)
+		}
+
+		repo, err := newRepository(ctx, dockerCli, ref, opts.insecure, "pull")
+		if err != nil {
+			return err
+		}
+		entry, err := fetchManifest(ctx, repo, ref)
+		if err != nil {
+			return err
+		}
+		if err := saveEntry(listRef, entry); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(dockerCli.Out(), "Created manifest list %s\n", listRef)
+	return nil
+}
+
+// parseListRef parses the reference of a manifest list, which is pushed by
+// tag.
+func parseListRef(s string) (reference.NamedTagged, error) {
+	ref, err := parseRef(s)
+	if err != nil {
+		return nil, err
+	}
+	tagged, ok := ref.(reference.NamedTagged)
+	if !ok {
+		return nil, fmt.Errorf("manifest list %s must be referenced by a tag", ref)
+	}
+	return tagged, nil
+}
@@ -0,0 +1,117 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/docker/api/client"
+	"github.com/docker/docker/cli"
+	"github.com/spf13/cobra"
+)
+
+type inspectOptions struct {
+	list     string
+	manifest string
+	insecure bool
+}
+
+func newInspectCommand(dockerCli *client.DockerCli) *cobra.Command {
+	var opts inspectOptions
+
+	cmd := &cobra.Command{
+		Use:   "inspect [OPTIONS] [MANIFEST_LIST] MANIFEST",
+		Short: "Display an image manifest or a local manifest list",
+		Args:  cli.RequiresRangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 2 {
+				opts.list = args[0]
+				opts.manifest = args[1]
+			} else {
+				opts.manifest = args[0]
+			}
+			return runInspect(dockerCli, opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVar(&opts.insecure, "insecure", false, "Allow communication with an insecure registry")
+
+	return cmd
+}
+
+func runInspect(dockerCli *client.DockerCli, opts inspectOptions) error {
+	if opts.list != "" {
+		listRef, err := parseListRef(opts.list)
+		if err != nil {
+			return err
+		}
+		ref, err := parseRef(opts.manifest)
+		if err != nil {
+			return err
+		}
+		entry, err := loadEntry(listRef, ref)
+		if err != nil {
+			return err
+		}
+		return printJSON(dockerCli, entry.Descriptor)
+	}
+
+	ref, err := parseRef(opts.manifest)
+	if err != nil {
+		return err
+	}
+
+	// A local manifest list is displayed as it would be pushed.
+	if tagged, err := parseListRef(opts.manifest); err == nil {
+		entries, err := loadEntries(tagged)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			var descriptors []manifestlist.ManifestDescriptor
+			for _, e := range entries {
+				descriptors = append(descriptors, e.Descriptor)
+			}
+			list, err := manifestlist.FromDescriptors(descriptors)
+			if err != nil {
+				return err
+			}
+			return printJSON(dockerCli, list)
+		}
+	}
+
+	ctx := context.Background()
+	repo, err := newRepository(ctx, dockerCli, ref, opts.insecure, "pull")
+	if err != nil {
+		return err
+	}
+	manSvc, err := repo.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	m, err := getManifest(ctx, manSvc, ref)
+	if err != nil {
+		return err
+	}
+	_, raw, err := m.Payload()
+	if err != nil {
+		return err
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return err
+	}
+	return printJSON(dockerCli, v)
+}
+
+func printJSON(dockerCli *client.DockerCli, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(dockerCli.Out(), "%s\n", data)
+	return nil
+}
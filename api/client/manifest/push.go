@@ -0,0 +1,198 @@
+package manifest
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/net/context"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	distreference "github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/client"
+	apiclient "github.com/docker/docker/api/client"
+	"github.com/docker/docker/cli"
+	"github.com/docker/docker/reference"
+	"github.com/spf13/cobra"
+)
+
+type pushOptions struct {
+	list     string
+	purge    bool
+	insecure bool
+}
+
+func newPushCommand(dockerCli *apiclient.DockerCli) *cobra.Command {
+	var opts pushOptions
+
+	cmd := &cobra.Command{
+		Use:   "push [OPTIONS] MANIFEST_LIST",
+		Short: "Push a local manifest list to a registry",
+		Args:  cli.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.list = args[0]
+			return runPush(dockerCli, opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVarP(&opts.purge, "purge", "p", false, "Remove the local manifest list after the push")
+	flags.BoolVar(&opts.insecure, "insecure", false, "Allow communication with an insecure registry")
+
+	return cmd
+}
+
+func runPush(dockerCli *apiclient.DockerCli, opts pushOptions) error {
+	listRef, err := parseListRef(opts.list)
+	if err != nil {
+		return err
+	}
+	entries, err := loadEntries(listRef)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no manifest list %s, create it with docker manifest create", listRef)
+	}
+
+	ctx := context.Background()
+	repo, err := newRepository(ctx, dockerCli, listRef, opts.insecure, "pull", "push")
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := pushEntry(ctx, dockerCli, repo, listRef, e, opts.insecure); err != nil {
+			return err
+		}
+	}
+
+	list, err := newManifestList(entries)
+	if err != nil {
+		return err
+	}
+	manSvc, err := repo.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	dgst, err := manSvc.Put(ctx, list, distribution.WithTag(listRef.Tag()))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(dockerCli.Out(), "%s\n", dgst)
+
+	if opts.purge {
+		return removeList(listRef)
+	}
+	return nil
+}
+
+// newManifestList returns the manifest list of entries, in their order.
+func newManifestList(entries []manifestEntry) (*manifestlist.DeserializedManifestList, error) {
+	descriptors := make([]manifestlist.ManifestDescriptor, 0, len(entries))
+	for _, e := range entries {
+		descriptors = append(descriptors, e.Descriptor)
+	}
+	return manifestlist.FromDescriptors(descriptors)
+}
+
+// pushEntry makes the manifest of e available in repo, the repository of the
+// manifest list listRef. The manifests of another repository are pushed by
+// digest, after their blobs are mounted or copied into repo.
+func pushEntry(ctx context.Context, dockerCli *apiclient.DockerCli, repo distribution.Repository, listRef reference.Named, e manifestEntry, insecure bool) error {
+	ref, err := reference.ParseNamed(e.Ref)
+	if err != nil {
+		return err
+	}
+	if ref.Name() == listRef.Name() {
+		return nil
+	}
+
+	m, _, err := distribution.UnmarshalManifest(e.Descriptor.MediaType, e.Raw)
+	if err != nil {
+		return err
+	}
+	img, ok := m.(*schema2.DeserializedManifest)
+	if !ok {
+		return fmt.Errorf("%s is not a schema2 image manifest", ref)
+	}
+
+	var sourceRepo distribution.Repository
+	for _, desc := range append([]distribution.Descriptor{img.Config}, img.Layers...) {
+		if len(desc.URLs) > 0 {
+			// Foreign layers are not pushed to the registries.
+			continue
+		}
+		if _, err := repo.Blobs(ctx).Stat(ctx, desc.Digest); err == nil {
+			continue
+		}
+		mounted, err := mountBlob(ctx, repo, ref, desc)
+		if err != nil {
+			return err
+		}
+		if mounted {
+			continue
+		}
+		if sourceRepo == nil {
+			sourceRepo, err = newRepository(ctx, dockerCli, ref, insecure, "pull")
+			if err != nil {
+				return err
+			}
+		}
+		if err := copyBlob(ctx, sourceRepo, repo, desc); err != nil {
+			return err
+		}
+	}
+
+	manSvc, err := repo.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = manSvc.Put(ctx, m)
+	return err
+}
+
+// mountBlob mounts the blob desc of the repository of ref into repo, and
+// returns whether the registry supports it.
+func mountBlob(ctx context.Context, repo distribution.Repository, ref reference.Named, desc distribution.Descriptor) (bool, error) {
+	remoteRef, err := distreference.WithName(ref.RemoteName())
+	if err != nil {
+		return false, err
+	}
+	canonicalRef, err := distreference.WithDigest(remoteRef, desc.Digest)
+	if err != nil {
+		return false, err
+	}
+
+	upload, err := repo.Blobs(ctx).Create(ctx, client.WithMountFrom(canonicalRef))
+	switch err.(type) {
+	case nil:
+		// The registry started an upload instead.
+		upload.Cancel(ctx)
+		return false, nil
+	case distribution.ErrBlobMounted:
+		return true, nil
+	}
+	return false, err
+}
+
+// copyBlob uploads the blob desc of sourceRepo into repo.
+func copyBlob(ctx context.Context, sourceRepo, repo distribution.Repository, desc distribution.Descriptor) error {
+	rc, err := sourceRepo.Blobs(ctx).Open(ctx, desc.Digest)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	upload, err := repo.Blobs(ctx).Create(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(upload, rc); err != nil {
+		upload.Cancel(ctx)
+		return err
+	}
+	_, err = upload.Commit(ctx, desc)
+	return err
+}
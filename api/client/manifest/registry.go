@@ -0,0 +1,122 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/docker/api/client"
+	dockerdist "github.com/docker/docker/distribution"
+	"github.com/docker/docker/reference"
+	"github.com/docker/docker/registry"
+)
+
+// newRepository returns the repository of ref in its registry, using the
+// credentials of the client for actions. Like the daemon, it tries the
+// secure endpoints of the registry first, and the insecure ones as well if
+// insecure is set.
+func newRepository(ctx context.Context, dockerCli *client.DockerCli, ref reference.Named, insecure bool, actions ...string) (distribution.Repository, error) {
+	repoInfo, err := registry.ParseRepositoryInfo(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	options := registry.ServiceOptions{V2Only: true}
+	if insecure {
+		options.InsecureRegistries = []string{repoInfo.Index.Name}
+	}
+	endpoints, err := registry.NewService(options).LookupPushEndpoints(repoInfo.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	authConfig := dockerCli.ResolveAuthConfig(ctx, repoInfo.Index)
+	lastErr := fmt.Errorf("no v2 endpoint found for %s", repoInfo.Index.Name)
+	for _, endpoint := range endpoints {
+		if endpoint.Version != registry.APIVersion2 {
+			continue
+		}
+		repo, _, err := dockerdist.NewV2Repository(ctx, repoInfo, endpoint, nil, &authConfig, actions...)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return repo, nil
+	}
+	return nil, lastErr
+}
+
+// fetchManifest fetches the image manifest ref from repo, and returns its
+// entry in a manifest list. The platform of the entry is the one of the
+// image config.
+func fetchManifest(ctx context.Context, repo distribution.Repository, ref reference.Named) (manifestEntry, error) {
+	manSvc, err := repo.Manifests(ctx)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+
+	m, err := getManifest(ctx, manSvc, ref)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+
+	var img *schema2.DeserializedManifest
+	switch v := m.(type) {
+	case *schema2.DeserializedManifest:
+		img = v
+	case *manifestlist.DeserializedManifestList:
+		return manifestEntry{}, fmt.Errorf("%s is a manifest list", ref)
+	default:
+		return manifestEntry{}, fmt.Errorf("%s is not a schema2 image manifest", ref)
+	}
+
+	mediaType, raw, err := m.Payload()
+	if err != nil {
+		return manifestEntry{}, err
+	}
+	dgst := digest.FromBytes(raw)
+	if r, ok := ref.(reference.Canonical); ok && r.Digest() != dgst {
+		return manifestEntry{}, fmt.Errorf("manifest digest mismatch for %s: got %s", ref, dgst)
+	}
+
+	config, err := repo.Blobs(ctx).Get(ctx, img.Config.Digest)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+	// The platform fields of an image config have the same names as the
+	// ones of a manifest list entry.
+	var platform manifestlist.PlatformSpec
+	if err := json.Unmarshal(config, &platform); err != nil {
+		return manifestEntry{}, err
+	}
+	platform.Features = nil
+
+	return manifestEntry{
+		Ref: ref.String(),
+		Descriptor: manifestlist.ManifestDescriptor{
+			Descriptor: distribution.Descriptor{
+				MediaType: mediaType,
+				Size:      int64(len(raw)),
+				Digest:    dgst,
+			},
+			Platform: platform,
+		},
+		Raw: raw,
+	}, nil
+}
+
+// getManifest fetches the manifest ref, by digest or by tag.
+func getManifest(ctx context.Context, manSvc distribution.ManifestService, ref reference.Named) (distribution.Manifest, error) {
+	switch r := ref.(type) {
+	case reference.Canonical:
+		return manSvc.Get(ctx, r.Digest())
+	case reference.NamedTagged:
+		return manSvc.Get(ctx, "", distribution.WithTag(r.Tag()))
+	}
+	return nil, fmt.Errorf("%s has neither tag nor digest", ref)
+}
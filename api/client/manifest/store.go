@@ -0,0 +1,149 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/docker/cliconfig"
+	"github.com/docker/docker/reference"
+)
+
+// manifestEntry is an image manifest of a manifest list being created. The
+// manifest lists are stored in the configuration directory of the client
+// until they are pushed.
+type manifestEntry struct {
+	// Ref is the reference the manifest was fetched with.
+	Ref string
+	// Descriptor is the entry of the manifest in the manifest list.
+	Descriptor manifestlist.ManifestDescriptor
+	// Raw is the manifest as stored in the registry.
+	Raw []byte
+}
+
+// indexFile is the name of the file of a manifest list holding the names of
+// the files of its entries, in the order they were added to the list.
+const indexFile = "index.json"
+
+// storeDir returns the directory the manifest lists are stored in.
+func storeDir() string {
+	return filepath.Join(cliconfig.ConfigDir(), "manifests")
+}
+
+// listDir returns the directory the manifest list listRef is stored in.
+func listDir(listRef reference.Named) string {
+	return filepath.Join(storeDir(), makeFilesafeName(listRef.String()))
+}
+
+// makeFilesafeName returns the name of the file of ref, the hex digest of
+// ref, so that distinct references never share a file whatever their
+// characters and length. The reference itself is stored in the file.
+func makeFilesafeName(ref string) string {
+	return digest.FromBytes([]byte(ref)).Hex()
+}
+
+// saveEntry adds e to the manifest list listRef, after its other entries, or
+// replaces the entry of the same reference in place.
+func saveEntry(listRef reference.Named, e manifestEntry) error {
+	dir := listDir(listRef)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	name := makeFilesafeName(e.Ref)
+	if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+		return err
+	}
+
+	names, err := loadIndex(dir)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if n == name {
+			return nil
+		}
+	}
+	data, err = json.Marshal(append(names, name))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, indexFile), data, 0600)
+}
+
+// loadIndex returns the names of the files of the entries of the manifest
+// list stored in dir, in order, or no names if it doesn't exist.
+func loadIndex(dir string) ([]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, indexFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// loadEntry returns the entry ref of the manifest list listRef.
+func loadEntry(listRef, ref reference.Named) (manifestEntry, error) {
+	var e manifestEntry
+	data, err := ioutil.ReadFile(filepath.Join(listDir(listRef), makeFilesafeName(ref.String())))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return e, fmt.Errorf("no manifest %s in the manifest list %s", ref, listRef)
+		}
+		return e, err
+	}
+	if err := json.Unmarshal(data, &e); err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+// loadEntries returns the entries of the manifest list listRef in the order
+// they were added to it, or no entries if it doesn't exist.
+func loadEntries(listRef reference.Named) ([]manifestEntry, error) {
+	names, err := loadIndex(listDir(listRef))
+	if err != nil {
+		return nil, err
+	}
+	var entries []manifestEntry
+	for _, name := range names {
+		data, err := ioutil.ReadFile(filepath.Join(listDir(listRef), name))
+		if err != nil {
+			return nil, err
+		}
+		var e manifestEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// removeList deletes the manifest list listRef.
+func removeList(listRef reference.Named) error {
+	return os.RemoveAll(listDir(listRef))
+}
+
+// parseRef parses the reference of an image or a manifest list, adding the
+// default tag if it has neither tag nor digest.
+func parseRef(s string) (reference.Named, error) {
+	ref, err := reference.ParseNamed(s)
+	if err != nil {
+		return nil, err
+	}
+	return reference.WithDefaultTag(ref), nil
+}
@@ -0,0 +1,96 @@
+package manifest
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/docker/cliconfig"
+	"github.com/docker/docker/pkg/testutil/assert"
+)
+
+func TestMakeFilesafeName(t *testing.T) {
+	assert.Equal(t, makeFilesafeName("busybox:latest"), digest.FromBytes([]byte("busybox:latest")).Hex())
+	// References mapping to the same name when replacing the separators
+	// get distinct files.
+	if makeFilesafeName("foo-bar:baz") == makeFilesafeName("foo:bar-baz") {
+		t.Fatal("expected distinct file names for foo-bar:baz and foo:bar-baz")
+	}
+}
+
+func TestStoreEntries(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "manifest-store-")
+	assert.NilError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	oldDir := cliconfig.ConfigDir()
+	cliconfig.SetConfigDir(tmpDir)
+	defer cliconfig.SetConfigDir(oldDir)
+
+	listRef, err := parseListRef("localhost:5000/foo:multi")
+	assert.NilError(t, err)
+
+	entries, err := loadEntries(listRef)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 0)
+
+	ref, err := parseRef("localhost:5000/foo")
+	assert.NilError(t, err)
+	e := manifestEntry{Ref: ref.String(), Raw: []byte("{}")}
+	e.Descriptor.Digest = digest.FromBytes(e.Raw)
+	e.Descriptor.Platform = manifestlist.PlatformSpec{OS: "linux", Architecture: "arm", Variant: "v7"}
+	assert.NilError(t, saveEntry(listRef, e))
+
+	loaded, err := loadEntry(listRef, ref)
+	assert.NilError(t, err)
+	assert.Equal(t, loaded.Ref, "localhost:5000/foo:latest")
+	assert.Equal(t, loaded.Descriptor.Digest, e.Descriptor.Digest)
+	assert.Equal(t, loaded.Descriptor.Platform.Variant, "v7")
+
+	entries, err = loadEntries(listRef)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 1)
+
+	assert.NilError(t, removeList(listRef))
+	entries, err = loadEntries(listRef)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 0)
+}
+
+func TestStoreEntriesOrder(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "manifest-store-")
+	assert.NilError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	oldDir := cliconfig.ConfigDir()
+	cliconfig.SetConfigDir(tmpDir)
+	defer cliconfig.SetConfigDir(oldDir)
+
+	listRef, err := parseListRef("localhost:5000/foo:multi")
+	assert.NilError(t, err)
+
+	// The entries are added in another order than the one of the names of
+	// their files, and the first one is replaced.
+	names := []string{"localhost:5000/foo:arm", "localhost:5000/foo:amd64", "localhost:5000/foo:ppc64le"}
+	for _, name := range append(names, names[0]) {
+		e := manifestEntry{Ref: name, Raw: []byte(name)}
+		e.Descriptor.Digest = digest.FromBytes(e.Raw)
+		assert.NilError(t, saveEntry(listRef, e))
+	}
+
+	entries, err := loadEntries(listRef)
+	assert.NilError(t, err)
+	list, err := newManifestList(entries)
+	assert.NilError(t, err)
+	assert.Equal(t, len(list.Manifests), len(names))
+	for i, name := range names {
+		assert.Equal(t, list.Manifests[i].Digest, digest.FromBytes([]byte(name)))
+	}
+}
+
+func TestParseListRefRequiresTag(t *testing.T) {
+	_, err := parseListRef("foo@sha256:" + digest.FromBytes(nil).Hex())
+	assert.Error(t, err, "must be referenced by a tag")
+}
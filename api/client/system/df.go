@@ -0,0 +1,177 @@
+package system
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/docker/docker/api/client"
+	"github.com/docker/docker/cli"
+	"github.com/docker/docker/pkg/stringid"
+	"github.com/docker/docker/pkg/stringutils"
+	"github.com/docker/engine-api/types"
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+)
+
+type diskUsageOptions struct {
+	verbose bool
+}
+
+func newDiskUsageCommand(dockerCli *client.DockerCli) *cobra.Command {
+	var opts diskUsageOptions
+
+	cmd := &cobra.Command{
+		Use:   "df [OPTIONS]",
+		Short: "Show docker disk usage",
+		Args:  cli.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDiskUsage(dockerCli, opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVarP(&opts.verbose, "verbose", "v", false, "Show detailed information on space usage")
+
+	return cmd
+}
+
+func runDiskUsage(dockerCli *client.DockerCli, opts diskUsageOptions) error {
+	du, err := dockerCli.Client().DiskUsage(context.Background())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(dockerCli.Out(), 20, 1, 3, ' ', 0)
+	if opts.verbose {
+		printVerboseDiskUsage(w, du)
+	} else {
+		printDiskUsage(w, du)
+	}
+	w.Flush()
+	return nil
+}
+
+// printDiskUsage prints a summary of the disk usage of each type of object.
+func printDiskUsage(w io.Writer, du types.DiskUsage) {
+	fmt.Fprintln(w, "TYPE\tTOTAL\tACTIVE\tSIZE\tRECLAIMABLE")
+
+	var activeImages int
+	var imagesReclaimable int64
+	for _, i := range du.Images {
+		if i.Containers > 0 {
+			activeImages++
+		} else {
+			imagesReclaimable += i.Size - i.SharedSize
+		}
+	}
+	printSummaryLine(w, "Images", len(du.Images), activeImages, du.LayersSize, imagesReclaimable)
+
+	var activeContainers int
+	var containersSize, containersReclaimable int64
+	for _, c := range du.Containers {
+		containersSize += c.SizeRw
+		if c.State == "running" || c.State == "paused" || c.State == "restarting" {
+			activeContainers++
+		} else {
+			containersReclaimable += c.SizeRw
+		}
+	}
+	printSummaryLine(w, "Containers", len(du.Containers), activeContainers, containersSize, containersReclaimable)
+
+	var activeVolumes int
+	var volumesSize, volumesReclaimable int64
+	for _, v := range du.Volumes {
+		if v.UsageData == nil || v.UsageData.Size < 0 {
+			continue
+		}
+		volumesSize += v.UsageData.Size
+		if v.UsageData.RefCount > 0 {
+			activeVolumes++
+		} else {
+			volumesReclaimable += v.UsageData.Size
+		}
+	}
+	printSummaryLine(w, "Local Volumes", len(du.Volumes), activeVolumes, volumesSize, volumesReclaimable)
+
+	if du.BuildCache != nil {
+		var activeEntries int
+		for _, e := range du.BuildCache.Entries {
+			if e.InUse {
+				activeEntries++
+			}
+		}
+		printSummaryLine(w, "Build Cache", len(du.BuildCache.Entries), activeEntries, du.BuildCache.Size, du.BuildCache.Reclaimable)
+	}
+}
+
+func printSummaryLine(w io.Writer, kind string, total, active int, size, reclaimable int64) {
+	percent := 0
+	if size > 0 {
+		percent = int(reclaimable * 100 / size)
+	}
+	fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s (%d%%)\n", kind, total, active, units.HumanSize(float64(size)), units.HumanSize(float64(reclaimable)), percent)
+}
+
+// printVerboseDiskUsage prints the disk usage of each object.
+func printVerboseDiskUsage(w io.Writer, du types.DiskUsage) {
+	now := time.Now()
+
+	fmt.Fprintf(w, "Images space usage:\n\n")
+	fmt.Fprintln(w, "REPOSITORY\tTAG\tIMAGE ID\tCREATED\tSIZE\tSHARED SIZE\tUNIQUE SIZE\tCONTAINERS")
+	for _, i := range du.Images {
+		repo, tag := "<none>", "<none>"
+		if len(i.RepoTags) > 0 {
+			if idx := strings.LastIndex(i.RepoTags[0], ":"); idx > 0 {
+				repo, tag = i.RepoTags[0][:idx], i.RepoTags[0][idx+1:]
+			}
+		}
+		created := units.HumanDuration(now.UTC().Sub(time.Unix(i.Created, 0))) + " ago"
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n", repo, tag, stringid.TruncateID(i.ID), created,
+			units.HumanSize(float64(i.Size)), units.HumanSize(float64(i.SharedSize)), units.HumanSize(float64(i.Size-i.SharedSize)), i.Containers)
+	}
+
+	fmt.Fprintf(w, "\nContainers space usage:\n\n")
+	fmt.Fprintln(w, "CONTAINER ID\tIMAGE\tCOMMAND\tLOCAL VOLUMES\tSIZE\tCREATED\tSTATUS\tNAMES")
+	for _, c := range du.Containers {
+		var localVolumes int
+		for _, m := range c.Mounts {
+			if m.Driver == "local" {
+				localVolumes++
+			}
+		}
+		var name string
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		created := units.HumanDuration(now.UTC().Sub(time.Unix(c.Created, 0))) + " ago"
+		fmt.Fprintf(w, "%s\t%s\t%q\t%d\t%s\t%s\t%s\t%s\n", stringid.TruncateID(c.ID), c.Image, stringutils.Truncate(c.Command, 20),
+			localVolumes, units.HumanSize(float64(c.SizeRw)), created, c.Status, name)
+	}
+
+	fmt.Fprintf(w, "\nLocal Volumes space usage:\n\n")
+	fmt.Fprintln(w, "VOLUME NAME\tLINKS\tSIZE")
+	for _, v := range du.Volumes {
+		links, size := 0, "N/A"
+		if v.UsageData != nil {
+			links = v.UsageData.RefCount
+			if v.UsageData.Size >= 0 {
+				size = units.HumanSize(float64(v.UsageData.Size))
+			}
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", v.Name, links, size)
+	}
+
+	if du.BuildCache != nil {
+		fmt.Fprintf(w, "\nBuild cache usage:\n\n")
+		fmt.Fprintln(w, "IMAGE ID\tSIZE\tLAST USED\tIN USE")
+		for _, e := range du.BuildCache.Entries {
+			lastUsed := units.HumanDuration(now.UTC().Sub(e.LastUsed)) + " ago"
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", stringid.TruncateID(e.ID), units.HumanSize(float64(e.Size)), lastUsed, e.InUse)
+		}
+	}
+}
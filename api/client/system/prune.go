@@ -0,0 +1,156 @@
+package system
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/net/context"
+
+	"github.com/docker/docker/api/client"
+	"github.com/docker/docker/cli"
+	"github.com/docker/engine-api/types/filters"
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+)
+
+type pruneOptions struct {
+	force  bool
+	all    bool
+	filter []string
+}
+
+const (
+	warning = `WARNING! This will remove:
+	- all stopped containers
+	- all volumes not used by at least one container
+	- all networks not used by at least one container
+	- %s
+Are you sure you want to continue?`
+
+	danglingImageDesc = "all dangling images"
+	allImageDesc      = `all images without at least one container associated to them
+	- all build cache images`
+)
+
+func newPruneCommand(dockerCli *client.DockerCli) *cobra.Command {
+	var opts pruneOptions
+
+	cmd := &cobra.Command{
+		Use:   "prune [OPTIONS]",
+		Short: "Remove unused data",
+		Args:  cli.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPrune(dockerCli, opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVarP(&opts.force, "force", "f", false, "Do not prompt for confirmation")
+	flags.BoolVarP(&opts.all, "all", "a", false, "Remove all unused images not just dangling ones")
+	flags.StringSliceVar(&opts.filter, "filter", []string{}, "Provide filter values (i.e. 'until=24h')")
+
+	return cmd
+}
+
+func runPrune(dockerCli *client.DockerCli, opts pruneOptions) error {
+	pruneFilters := filters.NewArgs()
+	for _, f := range opts.filter {
+		var err error
+		pruneFilters, err = filters.ParseFlag(f, pruneFilters)
+		if err != nil {
+			return err
+		}
+	}
+	// Volumes and networks have no creation time, so they are only
+	// filtered by label.
+	labelFilters := filters.NewArgs()
+	for _, label := range pruneFilters.Get("label") {
+		labelFilters.Add("label", label)
+	}
+	imageFilters := filters.NewArgs()
+	for _, field := range []string{"label", "until"} {
+		for _, value := range pruneFilters.Get(field) {
+			imageFilters.Add(field, value)
+		}
+	}
+	if opts.all {
+		imageFilters.Add("dangling", "false")
+	}
+
+	message := fmt.Sprintf(warning, danglingImageDesc)
+	if opts.all {
+		message = fmt.Sprintf(warning, allImageDesc)
+	}
+	if !opts.force && !client.PromptForConfirmation(dockerCli.In(), dockerCli.Out(), message) {
+		return nil
+	}
+
+	var (
+		ctx            = context.Background()
+		apiClient      = dockerCli.Client()
+		out            = dockerCli.Out()
+		spaceReclaimed uint64
+	)
+
+	containers, err := apiClient.ContainersPrune(ctx, pruneFilters)
+	if err != nil {
+		return err
+	}
+	printDeleted(out, "Deleted Containers:", containers.ContainersDeleted)
+	spaceReclaimed += containers.SpaceReclaimed
+
+	volumes, err := apiClient.VolumesPrune(ctx, labelFilters)
+	if err != nil {
+		return err
+	}
+	printDeleted(out, "Deleted Volumes:", volumes.VolumesDeleted)
+	spaceReclaimed += volumes.SpaceReclaimed
+
+	networks, err := apiClient.NetworksPrune(ctx, labelFilters)
+	if err != nil {
+		return err
+	}
+	printDeleted(out, "Deleted Networks:", networks.NetworksDeleted)
+
+	images, err := apiClient.ImagesPrune(ctx, imageFilters)
+	if err != nil {
+		return err
+	}
+	if len(images.ImagesDeleted) > 0 {
+		fmt.Fprintln(out, "Deleted Images:")
+		for _, d := range images.ImagesDeleted {
+			if d.Untagged != "" {
+				fmt.Fprintln(out, "untagged:", d.Untagged)
+			} else {
+				fmt.Fprintln(out, "deleted:", d.Deleted)
+			}
+		}
+		fmt.Fprintln(out)
+	}
+	spaceReclaimed += images.SpaceReclaimed
+
+	// The build cache has no labels, and is only pruned with --all if it
+	// isn't filtered.
+	if opts.all && pruneFilters.Len() == 0 {
+		buildCache, err := apiClient.BuildCachePrune(ctx, 0)
+		if err != nil {
+			return err
+		}
+		printDeleted(out, "Deleted Build Cache Images:", buildCache.ImagesDeleted)
+		spaceReclaimed += buildCache.SpaceReclaimed
+	}
+
+	fmt.Fprintf(out, "Total reclaimed space: %s\n", units.HumanSize(float64(spaceReclaimed)))
+	return nil
+}
+
+func printDeleted(out io.Writer, title string, deleted []string) {
+	if len(deleted) == 0 {
+		return
+	}
+	fmt.Fprintln(out, title)
+	for _, id := range deleted {
+		fmt.Fprintln(out, id)
+	}
+	fmt.Fprintln(out)
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/docker/docker/pkg/term"
 	"github.com/docker/engine-api/client"
 	"github.com/docker/engine-api/types"
+	"github.com/docker/engine-api/types/versions"
 )
 
 func (cli *DockerCli) resizeTty(ctx context.Context, id string, isExec bool) {
@@ -109,6 +110,24 @@ func (cli *DockerCli) GetTtySize() (int, int) {
 	return int(ws.Height), int(ws.Width)
 }
 
+// RequireAPIVersion returns an error if the API version used with the daemon,
+// the oldest of the ones of the client and of the daemon, is older than
+// version, the one feature was introduced in.
+func (cli *DockerCli) RequireAPIVersion(ctx context.Context, version, feature string) error {
+	apiVersion := cli.client.ClientVersion()
+	if versions.LessThan(apiVersion, version) {
+		return fmt.Errorf("%s requires API version %s, but the client uses API version %s", feature, version, apiVersion)
+	}
+	serverVersion, err := cli.client.ServerVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if versions.LessThan(serverVersion.APIVersion, version) {
+		return fmt.Errorf("%s requires API version %s, but the daemon only supports API version %s", feature, version, serverVersion.APIVersion)
+	}
+	return nil
+}
+
 // CopyToFile writes the content of the reader to the specified file
 func CopyToFile(outfile string, r io.Reader) error {
 	tmpFile, err := ioutil.TempFile(filepath.Dir(outfile), ".docker_temp_")
@@ -188,3 +207,19 @@ func PrettyPrint(i interface{}) string {
 		return capitalizeFirst(fmt.Sprintf("%s", t))
 	}
 }
+
+// PromptForConfirmation requests and checks confirmation from the user.
+// It returns true if the user answered yes.
+func PromptForConfirmation(ins io.Reader, outs io.Writer, message string) bool {
+	if message == "" {
+		message = "Are you sure you want to proceed?"
+	}
+	fmt.Fprintf(outs, "%s [y/N] ", message)
+
+	answer := ""
+	n, _ := fmt.Fscan(ins, &answer)
+	if n != 1 || (answer != "y" && answer != "Y") {
+		return false
+	}
+	return true
+}
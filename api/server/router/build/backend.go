@@ -17,4 +17,15 @@ type Backend interface {
 	//
 	// TODO: make this return a reference instead of string
 	BuildFromContext(ctx context.Context, src io.ReadCloser, remote string, buildOptions *types.ImageBuildOptions, pg backend.ProgressWriter) (string, error)
+
+	// SyncContext records the build context described by request, and
+	// returns the files which need to be sent to build it.
+	SyncContext(ctx context.Context, request types.BuildContextSyncRequest) (types.BuildContextSyncResponse, error)
+
+	// BuildCacheUsage returns the images kept as a build cache.
+	BuildCacheUsage() (*types.BuildCacheUsage, error)
+
+	// PruneBuildCache removes the images of the build cache which are not
+	// in use, until the cache takes at most keepStorage bytes.
+	PruneBuildCache(keepStorage int64) (*types.BuildCachePruneReport, error)
 }
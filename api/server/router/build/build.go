@@ -25,5 +25,8 @@ func (r *buildRouter) Routes() []router.Route {
 func (r *buildRouter) initRoutes() {
 	r.routes = []router.Route{
 		router.Cancellable(router.NewPostRoute("/build", r.postBuild)),
+		router.NewGetRoute("/build/cache", r.getBuildCache),
+		router.NewPostRoute("/build/context", r.postBuildContext),
+		router.NewPostRoute("/build/prune", r.postBuildPrune),
 	}
 }
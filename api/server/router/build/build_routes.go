@@ -51,6 +51,23 @@ func newImageBuildOptions(ctx context.Context, r *http.Request) (*types.ImageBui
 	options.CPUSetMems = r.FormValue("cpusetmems")
 	options.CgroupParent = r.FormValue("cgroupparent")
 	options.Tags = r.Form["t"]
+	options.SessionID = r.FormValue("session")
+	options.Events = httputils.BoolValue(r, "events")
+	// Git contexts are checked out with their submodules unless the client
+	// asks otherwise, as they were before the parameter was added.
+	options.RecurseSubmodules = httputils.BoolValueOrDefault(r, "submodules", true)
+	options.ProvenanceLabels = httputils.BoolValue(r, "provenance")
+	options.VCSRef = r.FormValue("vcsref")
+	options.SourceDateEpoch = r.FormValue("sourcedateepoch")
+	options.NetworkMode = r.FormValue("networkmode")
+	if options.NetworkMode != "" && options.NetworkMode != "default" && options.NetworkMode != "none" {
+		return nil, fmt.Errorf("Unsupported networkmode %q, must be 'default' or 'none'", options.NetworkMode)
+	}
+	options.Export = httputils.BoolValue(r, "export")
+	options.ExportStage = r.FormValue("exportstage")
+	if options.Export && len(options.Tags) > 0 {
+		return nil, fmt.Errorf("the result of a build can't be both exported and tagged")
+	}
 
 	if r.Form.Get("shmsize") != "" {
 		shmSize, err := strconv.ParseInt(r.Form.Get("shmsize"), 10, 64)
@@ -151,6 +168,15 @@ func (br *buildRouter) postBuild(ctx context.Context, w http.ResponseWriter, r *
 	}
 	buildOptions.AuthConfigs = authConfigs
 
+	if gitAuthEncoded := r.Header.Get("X-Git-Auth"); gitAuthEncoded != "" {
+		gitAuth := &types.AuthConfig{}
+		gitAuthJSON := base64.NewDecoder(base64.URLEncoding, strings.NewReader(gitAuthEncoded))
+		if err := json.NewDecoder(gitAuthJSON).Decode(gitAuth); err != nil {
+			return errf(fmt.Errorf("invalid X-Git-Auth header: %v", err))
+		}
+		buildOptions.GitAuthConfig = gitAuth
+	}
+
 	remoteURL := r.FormValue("remote")
 
 	// Currently, only used if context is from a remote url.
@@ -171,10 +197,18 @@ func (br *buildRouter) postBuild(ctx context.Context, w http.ResponseWriter, r *
 	stdout := &streamformatter.StdoutFormatter{Writer: out, StreamFormatter: sf}
 	stderr := &streamformatter.StderrFormatter{Writer: out, StreamFormatter: sf}
 
+	// Auxiliary data, such as exported files, is always sent to the client.
+	auxOut := out
+	if buildOptions.SuppressOutput {
+		auxOut = &syncWriter{w: output}
+	}
+	aux := &streamformatter.AuxFormatter{Writer: auxOut, StreamFormatter: sf}
+
 	pg := backend.ProgressWriter{
 		Output:             out,
 		StdoutFormatter:    stdout,
 		StderrFormatter:    stderr,
+		AuxFormatter:       aux,
 		ProgressReaderFunc: createProgressReader,
 	}
 
@@ -185,10 +219,55 @@ func (br *buildRouter) postBuild(ctx context.Context, w http.ResponseWriter, r *
 
 	// Everything worked so if -q was provided the output from the daemon
 	// should be just the image ID and we'll print that to stdout.
-	if buildOptions.SuppressOutput {
+	if buildOptions.SuppressOutput && imgID != "" {
 		stdout := &streamformatter.StdoutFormatter{Writer: output, StreamFormatter: sf}
 		fmt.Fprintf(stdout, "%s\n", string(imgID))
 	}
 
 	return nil
 }
+
+func (br *buildRouter) postBuildContext(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := httputils.CheckForJSON(r); err != nil {
+		return err
+	}
+
+	var request types.BuildContextSyncRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return err
+	}
+
+	response, err := br.backend.SyncContext(ctx, request)
+	if err != nil {
+		return err
+	}
+	return httputils.WriteJSON(w, http.StatusOK, response)
+}
+
+func (br *buildRouter) getBuildCache(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	usage, err := br.backend.BuildCacheUsage()
+	if err != nil {
+		return err
+	}
+	return httputils.WriteJSON(w, http.StatusOK, usage)
+}
+
+func (br *buildRouter) postBuildPrune(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := httputils.ParseForm(r); err != nil {
+		return err
+	}
+
+	keepStorage, err := httputils.Int64ValueOrDefault(r, "keep-storage", 0)
+	if err != nil {
+		return err
+	}
+	if keepStorage < 0 {
+		return fmt.Errorf("invalid keep-storage: %d", keepStorage)
+	}
+
+	report, err := br.backend.PruneBuildCache(keepStorage)
+	if err != nil {
+		return err
+	}
+	return httputils.WriteJSON(w, http.StatusOK, report)
+}
@@ -5,6 +5,7 @@ package backend
 
 import (
 	"io"
+	"time"
 
 	"github.com/docker/docker/pkg/streamformatter"
 	"github.com/docker/engine-api/types"
@@ -73,6 +74,14 @@ type ExecProcessConfig struct {
 type ContainerCommitConfig struct {
 	types.ContainerCommitConfig
 	Changes []string
+	// SourceDateEpoch, if not zero, makes the image reproducible: it is
+	// recorded as the creation time of the image, the modification times of
+	// the files of its layer are clamped to it, and the container it was
+	// committed from is not recorded.
+	SourceDateEpoch time.Time
+	// BuildCache records the image in the build cache, so that it is
+	// garbage collected once it is no longer used.
+	BuildCache bool
 }
 
 // ProgressWriter is an interface
@@ -81,5 +90,6 @@ type ProgressWriter struct {
 	Output             io.Writer
 	StdoutFormatter    *streamformatter.StdoutFormatter
 	StderrFormatter    *streamformatter.StderrFormatter
+	AuxFormatter       *streamformatter.AuxFormatter
 	ProgressReaderFunc func(io.ReadCloser) io.ReadCloser
 }
@@ -107,7 +107,8 @@ func (fi *HashedFileInfo) SetHash(h string) {
 type Backend interface {
 	// TODO: use digest reference instead of name
 
-	// GetImageOnBuild looks up a Docker image referenced by `name`.
+	// GetImageOnBuild looks up a Docker image referenced by `name`, to build
+	// from it. It fails if the image is rejected by the signature policy.
 	GetImageOnBuild(name string) (Image, error)
 	// TagImage tags an image with newTag
 	TagImageWithReference(image.ID, reference.Named) error
@@ -115,10 +116,13 @@ type Backend interface {
 	PullOnBuild(ctx context.Context, name string, authConfigs map[string]types.AuthConfig, output io.Writer) (Image, error)
 	// ContainerAttachRaw attaches to container.
 	ContainerAttachRaw(cID string, stdin io.ReadCloser, stdout, stderr io.Writer, stream bool) error
-	// ContainerCreate creates a new Docker container and returns potential warnings
-	ContainerCreate(types.ContainerCreateConfig) (types.ContainerCreateResponse, error)
+	// ContainerCreateOnBuild creates a new Docker container from the image
+	// of a build step and returns potential warnings.
+	ContainerCreateOnBuild(types.ContainerCreateConfig) (types.ContainerCreateResponse, error)
 	// ContainerRm removes a container specified by `id`.
 	ContainerRm(name string, config *types.ContainerRmConfig) error
+	// ImageDelete deletes the image referenced by `imageRef`.
+	ImageDelete(imageRef string, force, prune bool) ([]types.ImageDelete, error)
 	// Commit creates a new Docker image from an existing Docker container.
 	Commit(string, *backend.ContainerCommitConfig) (string, error)
 	// ContainerKill stops the container execution abruptly.
@@ -129,6 +133,15 @@ type Backend interface {
 	ContainerWait(containerID string, timeout time.Duration) (int, error)
 	// ContainerUpdateCmdOnBuild updates container.Path and container.Args
 	ContainerUpdateCmdOnBuild(containerID string, cmd []string) error
+	// ContainerExport writes the contents of the root filesystem of a
+	// container to out as a tar archive.
+	ContainerExport(name string, out io.Writer) error
+	// ImageHistory returns the history of an image, starting from its most
+	// recent layer.
+	ImageHistory(imageName string) ([]*types.ImageHistory, error)
+	// LookupImage returns the details of an image, such as its repository
+	// digests. The image is not verified against the signature policy.
+	LookupImage(name string) (*types.ImageInspect, error)
 
 	// ContainerCopy copies/extracts a source FileInfo to a destination path inside a container
 	// specified by a container object.
@@ -137,7 +150,19 @@ type Backend interface {
 	// with Context.Walk
 	//ContainerCopy(name string, res string) (io.ReadCloser, error)
 	// TODO: use copyBackend api
-	CopyOnBuild(containerID string, destPath string, src FileInfo, decompress bool) error
+	CopyOnBuild(containerID string, destPath string, src FileInfo, decompress bool, options CopyOptions) error
+}
+
+// CopyOptions holds the ownership and permissions to apply to the files
+// copied by CopyOnBuild.
+type CopyOptions struct {
+	// Chown is the user and, optionally, the group owning the copied files,
+	// as names or IDs resolved against the /etc/passwd and /etc/group files
+	// of the container. The (remapped) root user owns them if empty.
+	Chown string
+	// Chmod is the mode of the copied files. The mode of the source files is
+	// kept if nil.
+	Chmod *os.FileMode
 }
 
 // Image represents a Docker image used by the builder.
@@ -153,3 +178,21 @@ type ImageCache interface {
 	// and runconfig equals `cfg`. A cache miss is expected to return an empty ID and a nil error.
 	GetCachedImageOnBuild(parentID string, cfg *container.Config) (imageID string, err error)
 }
+
+// CacheManager is implemented by backends keeping track of the images
+// committed by builds, so that they can be garbage collected.
+type CacheManager interface {
+	// AcquireBuildCache prevents the build cache from being pruned until
+	// ReleaseBuildCache is called, so that the images of a build in progress
+	// aren't removed.
+	AcquireBuildCache()
+	// ReleaseBuildCache releases the build cache acquired by
+	// AcquireBuildCache.
+	ReleaseBuildCache()
+	// BuildCacheUsage returns the images of the build cache.
+	BuildCacheUsage() (*types.BuildCacheUsage, error)
+	// PruneBuildCache removes the images of the build cache which are not
+	// in use, least recently used first, until the cache takes at most
+	// keepStorage bytes.
+	PruneBuildCache(keepStorage int64) (*types.BuildCachePruneReport, error)
+}
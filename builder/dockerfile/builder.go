@@ -7,14 +7,22 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/docker/docker/api/types/backend"
 	"github.com/docker/docker/builder"
+	"github.com/docker/docker/builder/dockerfile/command"
 	"github.com/docker/docker/builder/dockerfile/parser"
 	"github.com/docker/docker/image"
+	"github.com/docker/docker/pkg/gitutils"
+	"github.com/docker/docker/pkg/streamformatter"
 	"github.com/docker/docker/pkg/stringid"
+	"github.com/docker/docker/pkg/urlutil"
 	"github.com/docker/docker/reference"
 	"github.com/docker/engine-api/types"
 	"github.com/docker/engine-api/types/container"
@@ -46,6 +54,19 @@ var BuiltinAllowedBuildArgs = map[string]bool{
 	"no_proxy":    true,
 }
 
+// AutomaticBuildArgs is the list of build args whose value is set by the
+// builder when they are declared by an ARG without a default value, and not
+// passed to the build:
+//   TARGETOS and TARGETARCH: the platform of the daemon, such as linux and amd64
+//   BUILD_DATE: the time the build started, in RFC 3339 format
+//   VCS_REF: the commit of the Git repository used as the context, if known
+var AutomaticBuildArgs = map[string]bool{
+	"TARGETOS":   true,
+	"TARGETARCH": true,
+	"BUILD_DATE": true,
+	"VCS_REF":    true,
+}
+
 // Builder is a Dockerfile builder
 // It implements the builder.Backend interface.
 type Builder struct {
@@ -54,6 +75,7 @@ type Builder struct {
 	Stdout io.Writer
 	Stderr io.Writer
 	Output io.Writer
+	Aux    *streamformatter.AuxFormatter
 
 	docker    builder.Backend
 	context   builder.Context
@@ -63,14 +85,25 @@ type Builder struct {
 	dockerfile       *parser.Node
 	runConfig        *container.Config // runconfig for cmd, run, entrypoint etc.
 	flags            *BFlags
+	heredocs         []parser.Heredoc
 	tmpContainers    map[string]struct{}
-	image            string // imageID
+	committed        []string // IDs of the images committed by the builder, in order.
+	image            string   // imageID
 	noBaseImage      bool
 	maintainer       string
 	cmdSet           bool
 	disableCommit    bool
 	cacheBusted      bool
-	allowedBuildArgs map[string]bool // list of build-time args that are allowed for expansion/substitution and passing to commands in 'run'.
+	allowedBuildArgs map[string]bool       // list of build-time args that are allowed for expansion/substitution and passing to commands in 'run'.
+	automaticArgs    map[string]string     // values of the AutomaticBuildArgs known to the builder.
+	parallelism      int                   // maximum number of build graph nodes processed concurrently.
+	prefetched       map[string][]copyInfo // sources of the current instruction resolved ahead of time.
+	stepCached       bool                  // whether the result of the current instruction was taken from the cache.
+	source           string                // URL of the remote Git context, if any.
+	baseName         string                // name of the base image of the stage, as given to FROM.
+	baseDigest       string                // digest of the base image of the stage.
+	provenanceSet    bool                  // whether the provenance labels were set on the config of the image.
+	epoch            time.Time             // creation time of the images committed, if the build is reproducible.
 
 	// TODO: remove once docker.Commit can receive a tag
 	id string
@@ -78,17 +111,50 @@ type Builder struct {
 
 // BuildManager implements builder.Backend and is shared across all Builder objects.
 type BuildManager struct {
-	backend builder.Backend
+	backend  builder.Backend
+	contexts *builder.ContextStore
+	gitCache *gitutils.Cache
 }
 
-// NewBuildManager creates a BuildManager.
-func NewBuildManager(b builder.Backend) (bm *BuildManager) {
-	return &BuildManager{backend: b}
+// NewBuildManager creates a BuildManager. The build contexts synchronized by
+// clients are kept in contexts, which may be nil if sessions are not
+// supported. Git contexts are checked out from gitCache, or cloned from
+// scratch for every build if it is nil.
+func NewBuildManager(b builder.Backend, contexts *builder.ContextStore, gitCache *gitutils.Cache) (bm *BuildManager) {
+	return &BuildManager{backend: b, contexts: contexts, gitCache: gitCache}
 }
 
 // BuildFromContext builds a new image from a given context.
 func (bm *BuildManager) BuildFromContext(ctx context.Context, src io.ReadCloser, remote string, buildOptions *types.ImageBuildOptions, pg backend.ProgressWriter) (string, error) {
-	buildContext, dockerfileName, err := builder.DetectContextFromRemoteURL(src, remote, pg.ProgressReaderFunc)
+	var (
+		buildContext   builder.ModifiableContext
+		dockerfileName string
+		vcsRef         string
+		err            error
+	)
+	if cm, ok := bm.backend.(builder.CacheManager); ok {
+		// The images committed by the build must not be pruned before
+		// they are tagged.
+		cm.AcquireBuildCache()
+		defer cm.ReleaseBuildCache()
+	}
+	if buildOptions.SessionID != "" {
+		if bm.contexts == nil {
+			return "", errors.New("build context sessions are not supported by this daemon")
+		}
+		if remote != "" {
+			return "", errors.New("a build session can't be used with a remote context")
+		}
+		buildContext, err = bm.contexts.Context(buildOptions.SessionID, src)
+	} else if bm.gitCache != nil && urlutil.IsGitURL(remote) {
+		opts := gitutils.CheckoutOptions{RecurseSubmodules: buildOptions.RecurseSubmodules}
+		if auth := buildOptions.GitAuthConfig; auth != nil {
+			opts.Username, opts.Password = auth.Username, auth.Password
+		}
+		buildContext, vcsRef, err = builder.MakeCachedGitContext(bm.gitCache, remote, opts)
+	} else {
+		buildContext, dockerfileName, err = builder.DetectContextFromRemoteURL(src, remote, pg.ProgressReaderFunc)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -104,6 +170,11 @@ func (bm *BuildManager) BuildFromContext(ctx context.Context, src io.ReadCloser,
 	if err != nil {
 		return "", err
 	}
+	b.Aux = pg.AuxFormatter
+	if vcsRef != "" {
+		b.automaticArgs["VCS_REF"] = vcsRef
+	}
+	b.source = sourceURL(remote)
 	return b.build(pg.StdoutFormatter, pg.StderrFormatter, pg.Output)
 }
 
@@ -117,6 +188,15 @@ func NewBuilder(clientCtx context.Context, config *types.ImageBuildOptions, back
 	if config.BuildArgs == nil {
 		config.BuildArgs = make(map[string]string)
 	}
+	buildDate, epoch := time.Now(), time.Time{}
+	if config.SourceDateEpoch != "" {
+		seconds, err := strconv.ParseInt(config.SourceDateEpoch, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid source date epoch %q: it must be a number of seconds since the Unix epoch", config.SourceDateEpoch)
+		}
+		epoch = time.Unix(seconds, 0).UTC()
+		buildDate = epoch
+	}
 	ctx, cancel := context.WithCancel(clientCtx)
 	b = &Builder{
 		clientCtx:        ctx,
@@ -130,6 +210,16 @@ func NewBuilder(clientCtx context.Context, config *types.ImageBuildOptions, back
 		tmpContainers:    map[string]struct{}{},
 		id:               stringid.GenerateNonCryptoID(),
 		allowedBuildArgs: make(map[string]bool),
+		automaticArgs: map[string]string{
+			"TARGETOS":   runtime.GOOS,
+			"TARGETARCH": runtime.GOARCH,
+			"BUILD_DATE": buildDate.UTC().Format(time.RFC3339),
+		},
+		epoch:       epoch,
+		parallelism: runtime.NumCPU(),
+	}
+	if config.VCSRef != "" {
+		b.automaticArgs["VCS_REF"] = config.VCSRef
 	}
 	if dockerfile != nil {
 		b.dockerfile, err = parser.Parse(dockerfile)
@@ -190,10 +280,11 @@ func sanitizeRepoAndTags(names []string) ([]reference.Named, error) {
 //
 // * read the dockerfile from context
 // * parse the dockerfile if not already parsed
-// * walk the AST and execute it by dispatching to handlers. If Remove
+// * walk the build graph of the AST and execute it by dispatching to
+//   handlers, running independent stages concurrently. If Remove
 //   or ForceRemove is set, additional cleanup around containers happens after
 //   processing.
-// * Tag image, if applicable.
+// * Tag image, if applicable, or export its root filesystem if requested.
 // * Print a happy message and return the image ID.
 //
 func (b *Builder) build(stdout io.Writer, stderr io.Writer, out io.Writer) (string, error) {
@@ -225,54 +316,171 @@ func (b *Builder) build(stdout io.Writer, stderr io.Writer, out io.Writer) (stri
 		b.dockerfile.Children = append(b.dockerfile.Children, node)
 	}
 
-	var shortImgID string
-	for i, n := range b.dockerfile.Children {
+	graph := newBuildGraph(b.dockerfile)
+	defer graph.cleanup()
+	progress := newBuildProgress(b)
+	dispatchNode := func(sb *Builder, n *buildNode) error {
+		step := progress.start(sb, n)
+		if err := sb.dispatch(n.step, n.ast); err != nil {
+			if n.ast.Source != "" {
+				err = fmt.Errorf("%s:%d: %v", n.ast.Source, n.ast.StartLine, err)
+			}
+			progress.end(sb, step, err)
+			return err
+		}
+		progress.end(sb, step, nil)
+
+		if sb.image != "" {
+			fmt.Fprintf(sb.Stdout, " ---> %s\n", stringid.TruncateID(sb.image))
+		}
+		if b.options.Remove {
+			sb.clearTmp()
+		}
+		return nil
+	}
+
+	// The global ARGs are declared by b before the stages are forked from it.
+	for _, n := range graph.globalArgs {
+		if err := dispatchNode(b, n); err != nil {
+			progress.summary("", err)
+			return "", err
+		}
+	}
+
+	// Every stage but the last one is dispatched by its own builder, the
+	// last stage produces the image and is dispatched by b itself. When there
+	// are several stages, the lines of their output are prefixed with their
+	// index.
+	stages := make([]*Builder, len(graph.stages))
+	for i := range stages {
+		if i == len(stages)-1 {
+			stages[i] = b
+		} else {
+			stages[i] = b.forkStage()
+		}
+	}
+	var stageOutput [][]*stageWriter
+	if len(stages) > 1 {
+		stageOutput = make([][]*stageWriter, len(stages))
+		for i, sb := range stages {
+			stageStdout, stageStderr := newStageWriter(stdout, i), newStageWriter(stderr, i)
+			stageOutput[i] = []*stageWriter{stageStdout, stageStderr}
+			sb.Stdout, sb.Stderr = stageStdout, stageStderr
+		}
+	}
+
+	var finalNode *buildNode
+	if b.options.ProvenanceLabels && !b.options.Export && len(graph.stages) > 0 {
+		if final := graph.stages[len(graph.stages)-1]; len(final) > 0 {
+			finalNode = final[len(final)-1]
+		}
+	}
+
+	err = graph.walk(b.clientCtx, b.parallelism, func(n *buildNode) error {
+		sb := stages[n.stage]
+		if n.isPrefetch() {
+			sb.runPrefetch(n.prefetch)
+			return nil
+		}
+
+		sb.prefetched = make(map[string][]copyInfo)
+		for _, src := range graph.prefetched[n] {
+			if src.infos != nil {
+				sb.prefetched[src.src] = src.infos
+			}
+		}
+		// The provenance labels are set on the config committed by the
+		// last instruction, which every instruction but FROM commits.
+		if n == finalNode && n.ast.Value != command.From {
+			sb.setProvenanceLabels()
+		}
+		err := dispatchNode(sb, n)
+		if stageOutput != nil {
+			for _, w := range stageOutput[n.stage] {
+				if err := w.flush(); err != nil {
+					logrus.Debugf("[BUILDER] failed to write the output of stage %d: %v", n.stage, err)
+				}
+			}
+		}
+		return err
+	})
+	b.Stdout, b.Stderr = stdout, stderr
+	if err != nil {
+		progress.summary("", err)
+		if b.options.ForceRemove {
+			for _, sb := range stages {
+				sb.clearTmp()
+			}
+		}
 		select {
 		case <-b.clientCtx.Done():
 			logrus.Debug("Builder: build cancelled!")
 			fmt.Fprintf(b.Stdout, "Build cancelled")
 			return "", fmt.Errorf("Build cancelled")
 		default:
-			// Not cancelled yet, keep going...
-		}
-		if err := b.dispatch(i, n); err != nil {
-			if b.options.ForceRemove {
-				b.clearTmp()
-			}
-			return "", err
 		}
+		return "", err
+	}
 
-		shortImgID = stringid.TruncateID(b.image)
-		fmt.Fprintf(b.Stdout, " ---> %s\n", shortImgID)
-		if b.options.Remove {
-			b.clearTmp()
+	for _, sb := range stages {
+		for arg := range sb.allowedBuildArgs {
+			b.allowedBuildArgs[arg] = true
 		}
 	}
 
 	// check if there are any leftover build-args that were passed but not
-	// consumed during build. Return an error, if there are any.
+	// consumed during build, and warn about them. Automatic build args may be
+	// passed for every build, whether the Dockerfile uses them or not.
 	leftoverArgs := []string{}
 	for arg := range b.options.BuildArgs {
-		if !b.isBuildArgAllowed(arg) {
+		if !b.isBuildArgAllowed(arg) && !AutomaticBuildArgs[arg] {
 			leftoverArgs = append(leftoverArgs, arg)
 		}
 	}
 	if len(leftoverArgs) > 0 {
-		return "", fmt.Errorf("One or more build-args %v were not consumed, failing build.", leftoverArgs)
+		sort.Strings(leftoverArgs)
+		fmt.Fprintf(b.Stdout, "[Warning] One or more build-args %v were not consumed\n", leftoverArgs)
 	}
 
 	if b.image == "" {
-		return "", fmt.Errorf("No image was generated. Is your Dockerfile empty?")
+		err := fmt.Errorf("No image was generated. Is your Dockerfile empty?")
+		progress.summary("", err)
+		return "", err
+	}
+
+	if b.options.ProvenanceLabels && !b.options.Export && !b.provenanceSet {
+		if err := b.addProvenanceLabels(); err != nil {
+			progress.summary("", err)
+			return "", err
+		}
+	}
+
+	if b.options.Export {
+		sb, err := exportedStage(stages, b.options.ExportStage)
+		if err != nil {
+			progress.summary("", err)
+			return "", err
+		}
+		defer removeCommittedImages(stages)
+		if err := b.export(sb.image); err != nil {
+			progress.summary("", err)
+			return "", err
+		}
+		fmt.Fprintf(b.Stdout, "Successfully exported %s\n", stringid.TruncateID(sb.image))
+		progress.summary(sb.image, nil)
+		return "", nil
 	}
 
 	imageID := image.ID(b.image)
 	for _, rt := range repoAndTags {
 		if err := b.docker.TagImageWithReference(imageID, rt); err != nil {
+			progress.summary("", err)
 			return "", err
 		}
 	}
 
-	fmt.Fprintf(b.Stdout, "Successfully built %s\n", shortImgID)
+	fmt.Fprintf(b.Stdout, "Successfully built %s\n", stringid.TruncateID(b.image))
+	progress.summary(b.image, nil)
 	return b.image, nil
 }
 
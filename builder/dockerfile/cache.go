@@ -0,0 +1,52 @@
+package dockerfile
+
+import (
+	"errors"
+
+	"github.com/docker/docker/builder"
+	"github.com/docker/engine-api/types"
+)
+
+var errCacheManagementNotSupported = errors.New("build cache management is not supported by this daemon")
+
+// BuildCacheUsage returns the images kept by the backend as a build cache.
+func (bm *BuildManager) BuildCacheUsage() (*types.BuildCacheUsage, error) {
+	cm, ok := bm.backend.(builder.CacheManager)
+	if !ok {
+		return nil, errCacheManagementNotSupported
+	}
+	return cm.BuildCacheUsage()
+}
+
+// PruneBuildCache removes the images of the build cache which are not in
+// use, until the cache takes at most keepStorage bytes, and then the
+// repositories cached for Git contexts which are not in use, until they take
+// at most the rest of keepStorage.
+func (bm *BuildManager) PruneBuildCache(keepStorage int64) (*types.BuildCachePruneReport, error) {
+	cm, ok := bm.backend.(builder.CacheManager)
+	if !ok {
+		return nil, errCacheManagementNotSupported
+	}
+	report, err := cm.PruneBuildCache(keepStorage)
+	if err != nil || bm.gitCache == nil {
+		return report, err
+	}
+
+	var keepGitStorage int64
+	if keepStorage > 0 {
+		usage, err := cm.BuildCacheUsage()
+		if err != nil {
+			return nil, err
+		}
+		if usage.Size < keepStorage {
+			keepGitStorage = keepStorage - usage.Size
+		}
+	}
+	removed, reclaimed, err := bm.gitCache.Prune(keepGitStorage)
+	if err != nil {
+		return nil, err
+	}
+	report.GitRepositoriesDeleted = removed
+	report.SpaceReclaimed += uint64(reclaimed)
+	return report, nil
+}
@@ -152,23 +152,36 @@ func add(b *Builder, args []string, attributes map[string]bool, original string)
 		return err
 	}
 
-	return b.runContextCommand(args, true, true, "ADD")
+	return b.runContextCommand(args, true, true, "ADD", builder.CopyOptions{})
 }
 
 // COPY foo /path
 //
-// Same as 'ADD' but without the tar and remote url handling.
+// Same as 'ADD' but without the tar and remote url handling. The owner and
+// the mode of the copied files can be set with --chown=user:group and
+// --chmod=mode.
 //
 func dispatchCopy(b *Builder, args []string, attributes map[string]bool, original string) error {
 	if len(args) < 2 {
 		return errAtLeastOneArgument("COPY")
 	}
 
+	flChown := b.flags.AddString("chown", "")
+	flChmod := b.flags.AddString("chmod", "")
 	if err := b.flags.Parse(); err != nil {
 		return err
 	}
 
-	return b.runContextCommand(args, false, false, "COPY")
+	options := builder.CopyOptions{Chown: flChown.Value}
+	if flChmod.Value != "" {
+		mode, err := parseChmod(flChmod.Value)
+		if err != nil {
+			return err
+		}
+		options.Chmod = &mode
+	}
+
+	return b.runContextCommand(args, false, false, "COPY", options)
 }
 
 // FROM imagename
@@ -202,7 +215,13 @@ func from(b *Builder, args []string, attributes map[string]bool, original string
 		// TODO: don't use `name`, instead resolve it to a digest
 		if !b.options.PullParent {
 			image, err = b.docker.GetImageOnBuild(name)
-			// TODO: shouldn't we error out if error is different from "not found" ?
+			if err != nil {
+				// An image which exists but was rejected, e.g. by the
+				// signature policy, must not be pulled instead.
+				if _, lookupErr := b.docker.LookupImage(name); lookupErr == nil {
+					return err
+				}
+			}
 		}
 		if image == nil {
 			image, err = b.docker.PullOnBuild(b.clientCtx, name, b.options.AuthConfigs, b.Output)
@@ -212,9 +231,21 @@ func from(b *Builder, args []string, attributes map[string]bool, original string
 		}
 	}
 
+	b.setBaseImage(name, image)
 	return b.processImageFrom(image)
 }
 
+// INCLUDE path/to/fragment
+//
+// INCLUDE inlines the instructions of another Dockerfile of the build context.
+// It is expanded when the Dockerfile is read from the context, see
+// expandIncludes, so it is only dispatched when the Dockerfile was given
+// directly to the builder.
+//
+func include(b *Builder, args []string, attributes map[string]bool, original string) error {
+	return fmt.Errorf("INCLUDE is only supported in a Dockerfile read from the build context")
+}
+
 // ONBUILD RUN echo yo
 //
 // ONBUILD triggers run when the image is used in a FROM statement.
@@ -237,7 +268,7 @@ func onbuild(b *Builder, args []string, attributes map[string]bool, original str
 	switch triggerInstruction {
 	case "ONBUILD":
 		return fmt.Errorf("Chaining ONBUILD via `ONBUILD ONBUILD` isn't allowed")
-	case "MAINTAINER", "FROM":
+	case "MAINTAINER", "FROM", "INCLUDE":
 		return fmt.Errorf("%s isn't allowed as an ONBUILD trigger", triggerInstruction)
 	}
 
@@ -286,13 +317,22 @@ func run(b *Builder, args []string, attributes map[string]bool, original string)
 		return fmt.Errorf("Please provide a source image with `from` prior to run")
 	}
 
+	flNetwork := b.flags.AddString("network", "")
+	flSecurity := b.flags.AddString("security", "")
 	if err := b.flags.Parse(); err != nil {
 		return err
 	}
+	opts, err := b.runOptions(flNetwork.Value, flSecurity.Value)
+	if err != nil {
+		return err
+	}
 
 	args = handleJSONArgs(args, attributes)
 
 	if !attributes["json"] {
+		if len(b.heredocs) > 0 {
+			args = []string{heredocScript(args[0], b.heredocs)}
+		}
 		args = append(getShell(b.runConfig), args...)
 	}
 	config := &container.Config{
@@ -354,6 +394,9 @@ func run(b *Builder, args []string, attributes map[string]bool, original string)
 		tmpEnv := append([]string{fmt.Sprintf("|%d", len(cmdBuildEnv))}, cmdBuildEnv...)
 		saveCmd = strslice.StrSlice(append(tmpEnv, saveCmd...))
 	}
+	if key := opts.cacheKey(); len(key) > 0 {
+		saveCmd = strslice.StrSlice(append(key, saveCmd...))
+	}
 
 	b.runConfig.Cmd = saveCmd
 	hit, err := b.probeCache()
@@ -373,7 +416,7 @@ func run(b *Builder, args []string, attributes map[string]bool, original string)
 
 	logrus.Debugf("[BUILDER] Command to be executed: %v", b.runConfig.Cmd)
 
-	cID, err := b.create()
+	cID, err := b.create(opts)
 	if err != nil {
 		return err
 	}
@@ -706,11 +749,20 @@ func arg(b *Builder, args []string, attributes map[string]bool, original string)
 
 	// If there is a default value associated with this arg then add it to the
 	// b.buildArgs if one is not already passed to the builder. The args passed
-	// to builder override the default value of 'arg'.
-	if _, ok := b.options.BuildArgs[name]; !ok && hasDefault {
-		b.options.BuildArgs[name] = value
+	// to builder override the default value of 'arg'. Without a default value,
+	// automatic build args get the one set by the builder.
+	if _, ok := b.options.BuildArgs[name]; !ok {
+		if hasDefault {
+			b.options.BuildArgs[name] = value
+		} else if value, ok := b.automaticArgs[name]; ok {
+			b.options.BuildArgs[name] = value
+		}
 	}
 
+	// The global ARGs preceding the first FROM have no image to commit to.
+	if b.image == "" && !b.noBaseImage {
+		return nil
+	}
 	return b.commit("", b.runConfig.Cmd, fmt.Sprintf("ARG %s", arg))
 }
 
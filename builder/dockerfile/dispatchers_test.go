@@ -0,0 +1,118 @@
+package dockerfile
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/builder"
+	"github.com/docker/engine-api/types"
+	"github.com/docker/engine-api/types/container"
+	"golang.org/x/net/context"
+)
+
+func TestArgAutomaticValues(t *testing.T) {
+	b := &Builder{
+		options:          &types.ImageBuildOptions{BuildArgs: map[string]string{"VCS_REF": "passed"}},
+		runConfig:        &container.Config{},
+		allowedBuildArgs: make(map[string]bool),
+		automaticArgs:    map[string]string{"TARGETOS": "linux", "BUILD_DATE": "2016-06-01T00:00:00Z", "VCS_REF": "abcdef"},
+		disableCommit:    true,
+	}
+
+	for _, a := range []string{"TARGETOS", "BUILD_DATE=unknown", "VCS_REF", "TARGETARCH", "OTHER"} {
+		if err := arg(b, []string{a}, nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string]string{
+		"TARGETOS":   "linux",
+		"BUILD_DATE": "unknown",
+		"VCS_REF":    "passed",
+	}
+	if !reflect.DeepEqual(b.options.BuildArgs, expected) {
+		t.Fatalf("Expected build args %v, got %v", expected, b.options.BuildArgs)
+	}
+	for _, a := range []string{"TARGETOS", "BUILD_DATE", "VCS_REF", "TARGETARCH", "OTHER"} {
+		if !b.isBuildArgAllowed(a) {
+			t.Fatalf("Expected %s to be allowed", a)
+		}
+	}
+}
+
+func TestRunOptions(t *testing.T) {
+	cases := []struct {
+		buildNetwork, network, security string
+		expected                         runOptions
+		cacheKey                         []string
+		err                              string
+	}{
+		{"", "", "", runOptions{network: "default"}, nil, ""},
+		{"default", "none", "", runOptions{network: "none"}, []string{"|network=none"}, ""},
+		{"", "default", "sandbox", runOptions{network: "default", security: "sandbox"}, []string{"|security=sandbox"}, ""},
+		{"none", "", "sandbox", runOptions{network: "none", security: "sandbox"}, []string{"|network=none", "|security=sandbox"}, ""},
+		{"none", "default", "", runOptions{}, nil, "the network is disabled for this build"},
+		{"", "host", "", runOptions{}, nil, "Invalid RUN --network value"},
+		{"", "", "insecure", runOptions{}, nil, "Invalid RUN --security value"},
+	}
+
+	for _, c := range cases {
+		b := &Builder{options: &types.ImageBuildOptions{NetworkMode: c.buildNetwork}}
+		opts, err := b.runOptions(c.network, c.security)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("%+v: expected an error containing %q, got %v", c, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if opts != c.expected {
+			t.Fatalf("%+v: expected %+v, got %+v", c, c.expected, opts)
+		}
+		if key := opts.cacheKey(); !reflect.DeepEqual(key, c.cacheKey) {
+			t.Fatalf("%+v: expected cache key %v, got %v", c, c.cacheKey, key)
+		}
+	}
+}
+
+// rejectingBackend has images which are all rejected by the signature policy.
+type rejectingBackend struct {
+	builder.Backend
+	pulled bool
+}
+
+var errRejectedImage = errors.New("image rejected by the signature policy")
+
+func (b *rejectingBackend) GetImageOnBuild(name string) (builder.Image, error) {
+	return nil, errRejectedImage
+}
+
+func (b *rejectingBackend) LookupImage(name string) (*types.ImageInspect, error) {
+	return &types.ImageInspect{ID: name}, nil
+}
+
+func (b *rejectingBackend) PullOnBuild(ctx context.Context, name string, authConfigs map[string]types.AuthConfig, output io.Writer) (builder.Image, error) {
+	b.pulled = true
+	return nil, errors.New("pull not expected")
+}
+
+func TestFromRejectedImage(t *testing.T) {
+	backend := &rejectingBackend{}
+	b := &Builder{
+		options:   &types.ImageBuildOptions{},
+		runConfig: &container.Config{},
+		docker:    backend,
+		flags:     NewBFlags(),
+	}
+	if err := from(b, []string{"busybox"}, nil, ""); err != errRejectedImage {
+		t.Fatalf("Expected the policy error, got %v", err)
+	}
+	if backend.pulled {
+		t.Fatal("Expected the rejected image not to be pulled")
+	}
+}
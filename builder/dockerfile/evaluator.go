@@ -67,6 +67,7 @@ func init() {
 		command.Expose:      expose,
 		command.From:        from,
 		command.Healthcheck: healthcheck,
+		command.Include:     include,
 		command.Label:       label,
 		command.Maintainer:  maintainer,
 		command.Onbuild:     onbuild,
@@ -106,6 +107,7 @@ func (b *Builder) dispatch(stepN int, ast *parser.Node) error {
 	attrs := ast.Attributes
 	original := ast.Original
 	flags := ast.Flags
+	heredocs := ast.Heredocs
 	strList := []string{}
 	msg := fmt.Sprintf("Step %d : %s", stepN+1, upperCasedCmd)
 
@@ -196,6 +198,7 @@ func (b *Builder) dispatch(stepN int, ast *parser.Node) error {
 	if f, ok := evaluateTable[cmd]; ok {
 		b.flags = NewBFlags()
 		b.flags.Args = flags
+		b.heredocs = heredocs
 		return f(b, strList, attrs, original)
 	}
 
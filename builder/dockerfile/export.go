@@ -0,0 +1,89 @@
+package dockerfile
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/pkg/streamformatter"
+	"github.com/docker/docker/pkg/stringid"
+	"github.com/docker/engine-api/types"
+	"github.com/docker/engine-api/types/container"
+	"github.com/docker/engine-api/types/strslice"
+)
+
+// exportChunkSize is the size of the chunks of the exported tar archive
+// sent in the messages of the build response stream.
+const exportChunkSize = 512 * 1024
+
+// exportedStage returns the builder of the stage selected by stage, the
+// index of the stage, or the last stage if it is empty.
+func exportedStage(stages []*Builder, stage string) (*Builder, error) {
+	if stage == "" {
+		return stages[len(stages)-1], nil
+	}
+	i, err := strconv.Atoi(stage)
+	if err != nil || i < 0 || i >= len(stages) {
+		return nil, fmt.Errorf("invalid stage to export %q: the Dockerfile has %d stages", stage, len(stages))
+	}
+	if stages[i].image == "" {
+		return nil, fmt.Errorf("stage %d didn't produce a root filesystem to export", i)
+	}
+	return stages[i], nil
+}
+
+// export sends the root filesystem of imageID to the client as a tar
+// archive, split into the auxiliary data of the build response stream.
+func (b *Builder) export(imageID string) error {
+	if b.Aux == nil {
+		return errors.New("the build output can't be exported to this client")
+	}
+
+	c, err := b.docker.ContainerCreateOnBuild(types.ContainerCreateConfig{
+		Config: &container.Config{
+			Image: imageID,
+			Cmd:   strslice.StrSlice{"/bin/sh", "-c", "#(nop) EXPORT"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer b.removeContainer(c.ID)
+
+	w := bufio.NewWriterSize(&exportWriter{aux: b.Aux}, exportChunkSize)
+	if err := b.docker.ContainerExport(c.ID, w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// removeCommittedImages removes the images committed by the stages of a build
+// whose root filesystem is exported rather than kept as an image. The images
+// the build took from the cache are kept.
+func removeCommittedImages(stages []*Builder) {
+	for _, sb := range stages {
+		for i := len(sb.committed) - 1; i >= 0; i-- {
+			id := sb.committed[i]
+			if _, err := sb.docker.ImageDelete(id, false, false); err != nil {
+				logrus.Debugf("[BUILDER] failed to remove intermediate image %s: %v", id, err)
+				continue
+			}
+			fmt.Fprintf(sb.Stdout, "Removing intermediate image %s\n", stringid.TruncateID(id))
+		}
+		sb.committed = nil
+	}
+}
+
+// exportWriter sends what is written to it as exported data.
+type exportWriter struct {
+	aux *streamformatter.AuxFormatter
+}
+
+func (w *exportWriter) Write(p []byte) (int, error) {
+	if err := w.aux.Emit(types.BuildAux{ExportData: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,79 @@
+package dockerfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/builder"
+	"github.com/docker/engine-api/types"
+)
+
+func TestExportedStage(t *testing.T) {
+	stages := []*Builder{{image: "first"}, {}, {image: "last"}}
+
+	cases := []struct {
+		stage    string
+		expected string
+		valid    bool
+	}{
+		{"", "last", true},
+		{"0", "first", true},
+		{"2", "last", true},
+		{"1", "", false},
+		{"3", "", false},
+		{"-1", "", false},
+		{"last", "", false},
+	}
+	for _, c := range cases {
+		sb, err := exportedStage(stages, c.stage)
+		if !c.valid {
+			if err == nil {
+				t.Errorf("Expected an error exporting stage %q", c.stage)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error exporting stage %q: %v", c.stage, err)
+			continue
+		}
+		if sb.image != c.expected {
+			t.Errorf("Expected stage %q to export %s, got %s", c.stage, c.expected, sb.image)
+		}
+	}
+}
+
+// imageDeleteBackend records the images deleted through it.
+type imageDeleteBackend struct {
+	builder.Backend
+	deleted []string
+}
+
+func (b *imageDeleteBackend) ImageDelete(imageRef string, force, prune bool) ([]types.ImageDelete, error) {
+	if force || prune {
+		return nil, fmt.Errorf("unexpected force or prune removing %s", imageRef)
+	}
+	b.deleted = append(b.deleted, imageRef)
+	return []types.ImageDelete{{Deleted: imageRef}}, nil
+}
+
+func TestRemoveCommittedImages(t *testing.T) {
+	backend := &imageDeleteBackend{}
+	stages := []*Builder{
+		{docker: backend, Stdout: ioutil.Discard, committed: []string{"a1", "a2"}},
+		{docker: backend, Stdout: ioutil.Discard},
+		{docker: backend, Stdout: ioutil.Discard, image: "b2", committed: []string{"b1", "b2"}},
+	}
+	removeCommittedImages(stages)
+
+	expected := []string{"a2", "a1", "b2", "b1"}
+	if !reflect.DeepEqual(backend.deleted, expected) {
+		t.Fatalf("Expected the committed images to be removed children first, %v, got %v", expected, backend.deleted)
+	}
+	for i, sb := range stages {
+		if len(sb.committed) != 0 {
+			t.Fatalf("Expected the images of stage %d to be forgotten once removed", i)
+		}
+	}
+}
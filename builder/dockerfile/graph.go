@@ -0,0 +1,360 @@
+package dockerfile
+
+// This file turns the flat list of instructions produced by the parser into a
+// dependency graph so that work which does not depend on each other can run
+// concurrently.
+//
+// Every FROM starts a new stage. Instructions within a stage depend on the
+// instruction before them, but stages don't depend on each other, so they can
+// be dispatched in parallel. The ARG instructions preceding the first FROM
+// are global: they are dispatched before the stages, which all inherit them. In addition, the sources of ADD and COPY
+// instructions that don't need variable expansion are resolved ahead of time
+// by prefetch nodes: remote ADD sources are downloaded and local sources are
+// hashed while the preceding instructions of the stage are still running.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/builder/dockerfile/command"
+	"github.com/docker/docker/builder/dockerfile/parser"
+	"github.com/docker/docker/pkg/urlutil"
+	"github.com/docker/engine-api/types/container"
+	"golang.org/x/net/context"
+)
+
+// buildNode is a single unit of work in a buildGraph. It is either a
+// Dockerfile instruction or a prefetch of one of the sources of an ADD or
+// COPY instruction.
+type buildNode struct {
+	id    int
+	stage int
+	deps  []*buildNode
+
+	// step is the index of the instruction in the Dockerfile and ast the
+	// instruction itself. Both are unset for prefetch nodes.
+	step int
+	ast  *parser.Node
+
+	// prefetch is set for nodes resolving the source src of the instruction
+	// node they are attached to.
+	prefetch *prefetchSource
+
+	done chan struct{}
+	err  error
+}
+
+func (n *buildNode) isPrefetch() bool {
+	return n.prefetch != nil
+}
+
+// prefetchSource holds the resolved file information for a source of an ADD
+// or COPY instruction.
+type prefetchSource struct {
+	src    string
+	remote bool
+	cmd    string
+	infos  []copyInfo
+}
+
+// buildGraph is the dependency graph of a Dockerfile.
+type buildGraph struct {
+	nodes []*buildNode
+	// globalArgs holds the ARG instructions preceding the first FROM. They
+	// are not part of the walk.
+	globalArgs []*buildNode
+	// stages holds the instruction nodes of every stage in Dockerfile order.
+	stages [][]*buildNode
+	// prefetched maps every instruction node to the sources that are
+	// resolved ahead of time for it.
+	prefetched map[*buildNode][]*prefetchSource
+}
+
+// newBuildGraph creates the dependency graph for the instructions of a
+// parsed Dockerfile.
+func newBuildGraph(root *parser.Node) *buildGraph {
+	g := &buildGraph{
+		prefetched: make(map[*buildNode][]*prefetchSource),
+	}
+
+	var prev *buildNode
+	stage := -1
+	for i, ast := range root.Children {
+		if ast.Value == command.Arg && stage < 0 {
+			g.globalArgs = append(g.globalArgs, &buildNode{
+				id:   -1,
+				step: i,
+				ast:  ast,
+				done: make(chan struct{}),
+			})
+			continue
+		}
+		if ast.Value == command.From || stage < 0 {
+			stage++
+			g.stages = append(g.stages, nil)
+			prev = nil
+		}
+		n := g.addNode(stage)
+		n.step = i
+		n.ast = ast
+		if prev != nil {
+			n.deps = append(n.deps, prev)
+		}
+		for _, src := range prefetchSources(ast) {
+			p := g.addNode(stage)
+			p.prefetch = src
+			n.deps = append(n.deps, p)
+			g.prefetched[n] = append(g.prefetched[n], src)
+		}
+		g.stages[stage] = append(g.stages[stage], n)
+		prev = n
+	}
+	return g
+}
+
+func (g *buildGraph) addNode(stage int) *buildNode {
+	n := &buildNode{
+		id:    len(g.nodes),
+		stage: stage,
+		step:  -1,
+		done:  make(chan struct{}),
+	}
+	g.nodes = append(g.nodes, n)
+	return n
+}
+
+// prefetchSources returns the sources of an ADD or COPY instruction that can
+// be resolved before the instruction is dispatched. Sources containing
+// variables are left alone as their value depends on the preceding
+// instructions.
+func prefetchSources(ast *parser.Node) []*prefetchSource {
+	if ast.Value != command.Add && ast.Value != command.Copy {
+		return nil
+	}
+
+	var args []string
+	for n := ast.Next; n != nil; n = n.Next {
+		args = append(args, n.Value)
+	}
+	if len(args) < 2 {
+		return nil
+	}
+
+	var srcs []*prefetchSource
+	for _, src := range args[:len(args)-1] {
+		if strings.ContainsAny(src, "$\\`") {
+			continue
+		}
+		if _, ok := parser.HeredocName(src); ok {
+			continue
+		}
+		remote := urlutil.IsURL(src)
+		if remote && ast.Value != command.Add {
+			// Leave it to the dispatcher to report the error
+			continue
+		}
+		srcs = append(srcs, &prefetchSource{
+			src:    src,
+			remote: remote,
+			cmd:    strings.ToUpper(ast.Value),
+		})
+	}
+	return srcs
+}
+
+// walk calls fn for every node of the graph once all the nodes it depends on
+// completed successfully, running at most parallelism nodes at the same time.
+// The first error returned by fn stops the walk; nodes that didn't start yet
+// are skipped and the error is returned.
+func (g *buildGraph) walk(ctx context.Context, parallelism int, fn func(*buildNode) error) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		sem      = make(chan struct{}, parallelism)
+	)
+
+	for _, n := range g.nodes {
+		wg.Add(1)
+		go func(n *buildNode) {
+			defer wg.Done()
+			defer close(n.done)
+
+			for _, dep := range n.deps {
+				<-dep.done
+				if dep.err != nil {
+					n.err = dep.err
+					return
+				}
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				n.err = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+
+			// Don't start new work once the walk has been stopped.
+			select {
+			case <-ctx.Done():
+				n.err = ctx.Err()
+				return
+			default:
+			}
+
+			if n.err = fn(n); n.err != nil {
+				once.Do(func() {
+					firstErr = n.err
+					cancel()
+				})
+			}
+		}(n)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	// The walk was stopped before any node failed, e.g. when the build got
+	// cancelled.
+	for _, n := range g.nodes {
+		if n.err != nil {
+			return n.err
+		}
+	}
+	return nil
+}
+
+// cleanup removes the files downloaded by remote prefetch nodes.
+func (g *buildGraph) cleanup() {
+	for _, srcs := range g.prefetched {
+		for _, src := range srcs {
+			if !src.remote {
+				continue
+			}
+			for _, info := range src.infos {
+				if err := os.RemoveAll(filepath.Dir(info.Path())); err != nil {
+					logrus.Debugf("[BUILDER] failed to remove downloaded source %s: %v", src.src, err)
+				}
+			}
+		}
+	}
+}
+
+// runPrefetch resolves a prefetched source. Failures are not fatal, the
+// instruction resolves the source by itself and reports the error when it is
+// dispatched.
+func (b *Builder) runPrefetch(src *prefetchSource) {
+	if src.remote {
+		fi, err := b.download(src.src)
+		if err != nil {
+			logrus.Debugf("[BUILDER] prefetch of %s failed: %v", src.src, err)
+			return
+		}
+		src.infos = []copyInfo{{FileInfo: fi, decompress: false}}
+		return
+	}
+	if b.context == nil {
+		return
+	}
+	infos, err := b.calcCopyInfo(src.cmd, src.src, src.cmd == "ADD", true)
+	if err != nil {
+		logrus.Debugf("[BUILDER] prefetch of %s failed: %v", src.src, err)
+		return
+	}
+	src.infos = infos
+}
+
+// forkStage returns a Builder sharing the build-wide settings of b but with
+// its own per-stage state, so that stages can be dispatched concurrently.
+// Build args are scoped to the stage: an ARG only allows the use of a build
+// arg in the stage it's declared in, besides the global ARGs already declared
+// by b.
+func (b *Builder) forkStage() *Builder {
+	sb := *b
+	options := *b.options
+	options.BuildArgs = make(map[string]string, len(b.options.BuildArgs))
+	for k, v := range b.options.BuildArgs {
+		options.BuildArgs[k] = v
+	}
+	sb.options = &options
+	sb.runConfig = new(container.Config)
+	sb.tmpContainers = map[string]struct{}{}
+	sb.committed = nil
+	sb.allowedBuildArgs = make(map[string]bool, len(b.allowedBuildArgs))
+	for k, v := range b.allowedBuildArgs {
+		sb.allowedBuildArgs[k] = v
+	}
+	sb.prefetched = nil
+	return &sb
+}
+
+// stageWriter prefixes every line written to it with the stage it belongs
+// to, so that the output of concurrent stages can be told apart. Complete
+// lines are written at once so that the lines of the stages don't get mixed;
+// incomplete lines are held until they are completed or flushed.
+type stageWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func newStageWriter(w io.Writer, stage int) *stageWriter {
+	return &stageWriter{w: w, prefix: fmt.Sprintf("[stage %d] ", stage)}
+}
+
+func (w *stageWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	i := bytes.LastIndexByte(w.buf, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	if err := w.writeLines(w.buf[:i+1]); err != nil {
+		return 0, err
+	}
+	w.buf = append(w.buf[:0], w.buf[i+1:]...)
+	return len(p), nil
+}
+
+// flush writes the incomplete line held by w, if any.
+func (w *stageWriter) flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.writeLines(append(w.buf, '\n'))
+	w.buf = w.buf[:0]
+	return err
+}
+
+func (w *stageWriter) writeLines(lines []byte) error {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(lines, []byte{'\n'}) {
+		if len(line) > 0 {
+			out.WriteString(w.prefix)
+			out.Write(line)
+		}
+	}
+	_, err := w.w.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,177 @@
+package dockerfile
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/builder/dockerfile/parser"
+	"github.com/docker/engine-api/types"
+	"github.com/docker/engine-api/types/container"
+	"golang.org/x/net/context"
+)
+
+func parseGraph(t *testing.T, dockerfile string) *buildGraph {
+	ast, err := parser.Parse(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatalf("Error when parsing Dockerfile: %s", err)
+	}
+	return newBuildGraph(ast)
+}
+
+func TestBuildGraphStages(t *testing.T) {
+	g := parseGraph(t, `FROM busybox
+RUN echo one
+FROM scratch
+COPY foo bar /dest/
+COPY $var /dest
+ADD http://example.com/file /dest`)
+
+	if len(g.stages) != 2 {
+		t.Fatalf("Expected 2 stages, got %d", len(g.stages))
+	}
+	if len(g.stages[0]) != 2 || len(g.stages[1]) != 4 {
+		t.Fatalf("Unexpected stage sizes %d and %d", len(g.stages[0]), len(g.stages[1]))
+	}
+	for _, stage := range g.stages {
+		if len(stage[0].deps) != 0 {
+			t.Fatalf("Expected the first instruction of a stage to have no dependencies, got %d", len(stage[0].deps))
+		}
+	}
+
+	copyNode := g.stages[1][1]
+	if len(g.prefetched[copyNode]) != 2 || len(copyNode.deps) != 3 {
+		t.Fatalf("Expected COPY to depend on 2 prefetches and the previous instruction, got %d deps", len(copyNode.deps))
+	}
+	if len(g.prefetched[g.stages[1][2]]) != 0 {
+		t.Fatal("Expected sources with variables not to be prefetched")
+	}
+	addNode := g.stages[1][3]
+	if srcs := g.prefetched[addNode]; len(srcs) != 1 || !srcs[0].remote {
+		t.Fatal("Expected the remote ADD source to be prefetched")
+	}
+}
+
+func TestBuildGraphWalkOrder(t *testing.T) {
+	g := parseGraph(t, `FROM busybox
+RUN one
+RUN two
+FROM busybox
+RUN three`)
+
+	var (
+		mu   sync.Mutex
+		seen []int
+	)
+	err := g.walk(context.Background(), 4, func(n *buildNode) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, dep := range n.deps {
+			found := false
+			for _, id := range seen {
+				if id == dep.id {
+					found = true
+				}
+			}
+			if !found {
+				return fmt.Errorf("node %d ran before its dependency %d", n.id, dep.id)
+			}
+		}
+		seen = append(seen, n.id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != len(g.nodes) {
+		t.Fatalf("Expected %d nodes to run, got %d", len(g.nodes), len(seen))
+	}
+}
+
+func TestBuildGraphWalkError(t *testing.T) {
+	g := parseGraph(t, `FROM busybox
+RUN one
+RUN two`)
+
+	var ran []int
+	err := g.walk(context.Background(), 1, func(n *buildNode) error {
+		ran = append(ran, n.step)
+		if n.step == 1 {
+			return fmt.Errorf("failed")
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "failed" {
+		t.Fatalf("Expected the node error to be returned, got %v", err)
+	}
+	if len(ran) != 2 {
+		t.Fatalf("Expected the walk to stop after the failing node, ran %v", ran)
+	}
+}
+
+func TestBuildGraphGlobalArgs(t *testing.T) {
+	g := parseGraph(t, `ARG VERSION=1.0
+ARG DEBUG
+FROM busybox
+ARG STAGE
+RUN echo $VERSION
+FROM busybox
+RUN echo $VERSION`)
+
+	if len(g.globalArgs) != 2 {
+		t.Fatalf("Expected 2 global ARGs, got %d", len(g.globalArgs))
+	}
+	if len(g.stages) != 2 || len(g.stages[0]) != 3 || len(g.stages[1]) != 2 {
+		t.Fatalf("Expected the global ARGs not to be part of the stages, got %d stages", len(g.stages))
+	}
+	for _, n := range g.globalArgs {
+		for _, gn := range g.nodes {
+			if gn == n {
+				t.Fatal("Expected the global ARGs not to be walked")
+			}
+		}
+	}
+
+	b := &Builder{
+		options:          &types.ImageBuildOptions{BuildArgs: map[string]string{}},
+		runConfig:        &container.Config{},
+		allowedBuildArgs: make(map[string]bool),
+	}
+	for _, n := range g.globalArgs {
+		if err := arg(b, []string{n.ast.Next.Value}, nil, n.ast.Original); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sb := b.forkStage()
+	if !sb.isBuildArgAllowed("VERSION") || !sb.isBuildArgAllowed("DEBUG") || sb.options.BuildArgs["VERSION"] != "1.0" {
+		t.Fatal("Expected the stages to inherit the global ARGs")
+	}
+	sb.image = "sha256:0123456789abcdef"
+	sb.disableCommit = true
+	if err := arg(sb, []string{"STAGE"}, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if b.isBuildArgAllowed("STAGE") {
+		t.Fatal("Expected the ARGs of a stage not to be inherited by the other stages")
+	}
+}
+
+func TestStageWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := newStageWriter(&out, 1)
+
+	fmt.Fprint(w, "Step 1 : RUN echo")
+	if out.Len() != 0 {
+		t.Fatalf("Expected incomplete lines to be held, got %q", out.String())
+	}
+	fmt.Fprint(w, " one\n ---> abc\nprogress")
+	if err := w.flush(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "[stage 1] Step 1 : RUN echo one\n[stage 1]  ---> abc\n[stage 1] progress\n"
+	if out.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, out.String())
+	}
+}
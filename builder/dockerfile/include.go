@@ -0,0 +1,80 @@
+package dockerfile
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/builder/dockerfile/command"
+	"github.com/docker/docker/builder/dockerfile/parser"
+)
+
+// expandIncludes replaces the INCLUDE instructions of ast, the AST of the
+// file name, with the instructions of the files they include, which are read
+// from the build context and expanded recursively. The nodes of the included
+// instructions keep their line in the file they come from, which is recorded
+// as their Source. included holds the files including name, so that cycles
+// are detected.
+func (b *Builder) expandIncludes(ast *parser.Node, name string, included []string) error {
+	included = append(included, name)
+
+	children := make([]*parser.Node, 0, len(ast.Children))
+	for _, node := range ast.Children {
+		if node.Value != command.Include {
+			children = append(children, node)
+			continue
+		}
+
+		location := fmt.Sprintf("%s:%d", name, node.StartLine)
+		if node.Next == nil || node.Next.Value == "" || len(node.Flags) > 0 {
+			return fmt.Errorf("%s: %v", location, errExactlyOneArgument("INCLUDE"))
+		}
+		fragment := contextPath(node.Next.Value)
+		for _, f := range included {
+			if f == fragment {
+				return fmt.Errorf("%s: INCLUDE cycle detected: %s", location, strings.Join(append(included, fragment), " -> "))
+			}
+		}
+
+		fragmentAST, err := b.parseFragment(fragment)
+		if err != nil {
+			return fmt.Errorf("%s: %v", location, err)
+		}
+		for _, n := range fragmentAST.Children {
+			n.Source = fragment
+		}
+		if err := b.expandIncludes(fragmentAST, fragment, included); err != nil {
+			return err
+		}
+		children = append(children, fragmentAST.Children...)
+	}
+	ast.Children = children
+	return nil
+}
+
+// parseFragment parses the file of the build context included as fragment.
+func (b *Builder) parseFragment(fragment string) (*parser.Node, error) {
+	f, err := b.context.Open(filepath.FromSlash(fragment))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("Cannot locate included file: %s", fragment)
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	ast, err := parser.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing included file %s: %v", fragment, err)
+	}
+	return ast, nil
+}
+
+// contextPath returns p as a slash separated path relative to the root of
+// the build context, so that the different ways of referring to a file
+// compare equal.
+func contextPath(p string) string {
+	return path.Clean("/" + filepath.ToSlash(p))[1:]
+}
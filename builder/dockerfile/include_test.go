@@ -0,0 +1,119 @@
+package dockerfile
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/builder"
+	"github.com/docker/engine-api/types"
+)
+
+// mapContext is a build context made of files held in memory, by path.
+type mapContext map[string]string
+
+func (c mapContext) Close() error {
+	return nil
+}
+
+func (c mapContext) Stat(path string) (string, builder.FileInfo, error) {
+	return "", nil, os.ErrNotExist
+}
+
+func (c mapContext) Open(path string) (io.ReadCloser, error) {
+	content, ok := c[filepath.ToSlash(path)]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(strings.NewReader(content)), nil
+}
+
+func (c mapContext) Walk(root string, walkFn builder.WalkFunc) error {
+	return nil
+}
+
+// parseTestContext parses the Dockerfile of a context made of files.
+func parseTestContext(t *testing.T, files map[string]string) (*Builder, error) {
+	b := &Builder{
+		options: &types.ImageBuildOptions{Dockerfile: builder.DefaultDockerfileName},
+		context: mapContext(files),
+	}
+	return b, b.readDockerfile()
+}
+
+func TestIncludeExpansion(t *testing.T) {
+	b, err := parseTestContext(t, map[string]string{
+		"Dockerfile": "FROM busybox\nINCLUDE common/harden\nCMD [\"sh\"]\n",
+		"common/harden": "# Shared hardening\n\n" +
+			"RUN adduser -D app\n" +
+			"INCLUDE /common/../common/tz\n" +
+			"USER app\n",
+		"common/tz": "ENV TZ=UTC\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type instruction struct {
+		value, source string
+		line          int
+	}
+	var actual []instruction
+	for _, n := range b.dockerfile.Children {
+		actual = append(actual, instruction{n.Value, n.Source, n.StartLine})
+	}
+	expected := []instruction{
+		{"from", "", 1},
+		{"run", "common/harden", 3},
+		{"env", "common/tz", 1},
+		{"user", "common/harden", 5},
+		{"cmd", "", 3},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Expected instructions %v, got %v", expected, actual)
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	cases := []struct {
+		files    map[string]string
+		expected string
+	}{
+		{
+			map[string]string{"Dockerfile": "FROM busybox\nINCLUDE missing\n"},
+			"Dockerfile:2: Cannot locate included file: missing",
+		},
+		{
+			map[string]string{
+				"Dockerfile": "FROM busybox\nINCLUDE a\n",
+				"a":          "RUN true\n\nINCLUDE ./b\n",
+				"b":          "INCLUDE a\n",
+			},
+			"b:1: INCLUDE cycle detected: Dockerfile -> a -> b -> a",
+		},
+		{
+			map[string]string{
+				"Dockerfile": "FROM busybox\nINCLUDE Dockerfile\n",
+			},
+			"Dockerfile:2: INCLUDE cycle detected: Dockerfile -> Dockerfile",
+		},
+		{
+			map[string]string{
+				"Dockerfile": "FROM busybox\n\nINCLUDE a\n",
+				"a":          "ENV PATH\n",
+			},
+			"Dockerfile:3: Error parsing included file a: ",
+		},
+	}
+
+	for _, c := range cases {
+		_, err := parseTestContext(t, c.files)
+		if err == nil || !strings.HasPrefix(err.Error(), c.expected) {
+			t.Fatalf("Expected an error starting with %q, got %v", c.expected, err)
+		}
+	}
+}
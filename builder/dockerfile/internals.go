@@ -15,6 +15,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -59,7 +60,7 @@ func (b *Builder) commit(id string, autoCmd strslice.StrSlice, comment string) e
 		} else if hit {
 			return nil
 		}
-		id, err = b.create()
+		id, err = b.create(runOptions{})
 		if err != nil {
 			return err
 		}
@@ -75,6 +76,8 @@ func (b *Builder) commit(id string, autoCmd strslice.StrSlice, comment string) e
 			Pause:  true,
 			Config: &autoConfig,
 		},
+		SourceDateEpoch: b.epoch,
+		BuildCache:      true,
 	}
 
 	// Commit the container
@@ -84,6 +87,7 @@ func (b *Builder) commit(id string, autoCmd strslice.StrSlice, comment string) e
 	}
 
 	b.image = imageID
+	b.committed = append(b.committed, imageID)
 	return nil
 }
 
@@ -92,7 +96,41 @@ type copyInfo struct {
 	decompress bool
 }
 
-func (b *Builder) runContextCommand(args []string, allowRemote bool, allowLocalDecompression bool, cmdName string) error {
+// parseChmod parses the octal mode given to the --chmod flag.
+func parseChmod(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 07777 {
+		return 0, fmt.Errorf("Invalid --chmod value %q, must be an octal mode", value)
+	}
+	perm := os.FileMode(mode & 0777)
+	if mode&04000 != 0 {
+		perm |= os.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		perm |= os.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		perm |= os.ModeSticky
+	}
+	return perm, nil
+}
+
+// formatChmod formats a mode parsed by parseChmod back to its octal form.
+func formatChmod(perm os.FileMode) string {
+	mode := uint32(perm.Perm())
+	if perm&os.ModeSetuid != 0 {
+		mode |= 04000
+	}
+	if perm&os.ModeSetgid != 0 {
+		mode |= 02000
+	}
+	if perm&os.ModeSticky != 0 {
+		mode |= 01000
+	}
+	return fmt.Sprintf("%04o", mode)
+}
+
+func (b *Builder) runContextCommand(args []string, allowRemote bool, allowLocalDecompression bool, cmdName string, options builder.CopyOptions) error {
 	if b.context == nil {
 		return fmt.Errorf("No context given. Impossible to use %s", cmdName)
 	}
@@ -113,7 +151,20 @@ func (b *Builder) runContextCommand(args []string, allowRemote bool, allowLocalD
 	// the copy until we've looked at all src files
 	var err error
 	for _, orig := range args[0 : len(args)-1] {
+		if prefetched, ok := b.prefetched[orig]; ok {
+			infos = append(infos, prefetched...)
+			continue
+		}
 		var fi builder.FileInfo
+		if heredoc := b.heredoc(orig); heredoc != nil {
+			fi, err = writeHeredoc(heredoc)
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(filepath.Dir(fi.Path()))
+			infos = append(infos, copyInfo{fi, false})
+			continue
+		}
 		decompress := allowLocalDecompression
 		if urlutil.IsURL(orig) {
 			if !allowRemote {
@@ -171,8 +222,17 @@ func (b *Builder) runContextCommand(args []string, allowRemote bool, allowLocalD
 		origPaths = strings.Join(origs, " ")
 	}
 
+	// The ownership and mode of the files are part of the cache key
+	cmdDesc := cmdName
+	if options.Chown != "" {
+		cmdDesc += " --chown=" + options.Chown
+	}
+	if options.Chmod != nil {
+		cmdDesc += " --chmod=" + formatChmod(*options.Chmod)
+	}
+
 	cmd := b.runConfig.Cmd
-	b.runConfig.Cmd = strslice.StrSlice(append(getShell(b.runConfig), "#(nop) %s %s in %s ", cmdName, srcHash, dest))
+	b.runConfig.Cmd = strslice.StrSlice(append(getShell(b.runConfig), "#(nop) %s %s in %s ", cmdDesc, srcHash, dest))
 	defer func(cmd strslice.StrSlice) { b.runConfig.Cmd = cmd }(cmd)
 
 	if hit, err := b.probeCache(); err != nil {
@@ -181,13 +241,13 @@ func (b *Builder) runContextCommand(args []string, allowRemote bool, allowLocalD
 		return nil
 	}
 
-	container, err := b.docker.ContainerCreate(types.ContainerCreateConfig{Config: b.runConfig})
+	container, err := b.docker.ContainerCreateOnBuild(types.ContainerCreateConfig{Config: b.runConfig})
 	if err != nil {
 		return err
 	}
 	b.tmpContainers[container.ID] = struct{}{}
 
-	comment := fmt.Sprintf("%s %s in %s", cmdName, origPaths, dest)
+	comment := fmt.Sprintf("%s %s in %s", cmdDesc, origPaths, dest)
 
 	// Twiddle the destination when its a relative path - meaning, make it
 	// relative to the WORKINGDIR
@@ -196,7 +256,7 @@ func (b *Builder) runContextCommand(args []string, allowRemote bool, allowLocalD
 	}
 
 	for _, info := range infos {
-		if err := b.docker.CopyOnBuild(container.ID, dest, info.FileInfo, info.decompress); err != nil {
+		if err := b.docker.CopyOnBuild(container.ID, dest, info.FileInfo, info.decompress, options); err != nil {
 			return err
 		}
 	}
@@ -204,7 +264,58 @@ func (b *Builder) runContextCommand(args []string, allowRemote bool, allowLocalD
 	return b.commit(container.ID, cmd, comment)
 }
 
+// heredoc returns the heredoc of the current instruction referred to by the
+// source src, if any.
+func (b *Builder) heredoc(src string) *parser.Heredoc {
+	name, ok := parser.HeredocName(src)
+	if !ok {
+		return nil
+	}
+	for i := range b.heredocs {
+		if b.heredocs[i].Name == name {
+			return &b.heredocs[i]
+		}
+	}
+	return nil
+}
+
+// writeHeredoc writes the content of a heredoc to a file named after the
+// heredoc in a temporary directory, so that it can be copied like any other
+// source.
+func writeHeredoc(heredoc *parser.Heredoc) (fi builder.FileInfo, err error) {
+	tmpDir, err := ioutils.TempDir("", "docker-heredoc")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(tmpDir)
+		}
+	}()
+
+	tmpFileName := filepath.Join(tmpDir, heredoc.Name)
+	if err = ioutil.WriteFile(tmpFileName, []byte(heredoc.Content), 0644); err != nil {
+		return
+	}
+	// Remove atime and mtime so that the content alone determines the layer
+	mTime := time.Time{}
+	if err = system.Chtimes(tmpFileName, mTime, mTime); err != nil {
+		return
+	}
+	tmpFileSt, err := os.Stat(tmpFileName)
+	if err != nil {
+		return
+	}
+
+	hash := sha256.Sum256([]byte(heredoc.Content))
+	return &builder.HashedFileInfo{FileInfo: builder.PathFileInfo{FileInfo: tmpFileSt, FilePath: tmpFileName}, FileHash: "heredoc:" + hex.EncodeToString(hash[:])}, nil
+}
+
 func (b *Builder) download(srcURL string) (fi builder.FileInfo, err error) {
+	if b.options.NetworkMode == networkNone {
+		return nil, fmt.Errorf("Can't download %s: the network is disabled for this build", srcURL)
+	}
+
 	// get filename from URL
 	u, err := url.Parse(srcURL)
 	if err != nil {
@@ -464,6 +575,11 @@ func (b *Builder) probeCache() (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	if len(cache) > 0 && !b.epoch.IsZero() && !b.createdAtEpoch(cache) {
+		// The cached image was not committed by a reproducible build with
+		// the same epoch.
+		cache = ""
+	}
 	if len(cache) == 0 {
 		logrus.Debugf("[BUILDER] Cache miss: %s", b.runConfig.Cmd)
 		b.cacheBusted = true
@@ -473,11 +589,79 @@ func (b *Builder) probeCache() (bool, error) {
 	fmt.Fprintf(b.Stdout, " ---> Using cache\n")
 	logrus.Debugf("[BUILDER] Use cached version: %s", b.runConfig.Cmd)
 	b.image = string(cache)
+	b.stepCached = true
 
 	return true, nil
 }
 
-func (b *Builder) create() (string, error) {
+// createdAtEpoch returns whether the image imageID was created at the epoch
+// of the build.
+func (b *Builder) createdAtEpoch(imageID string) bool {
+	img, err := b.docker.LookupImage(imageID)
+	if err != nil {
+		return false
+	}
+	created, err := time.Parse(time.RFC3339Nano, img.Created)
+	return err == nil && created.Equal(b.epoch)
+}
+
+// Values of the network and security options of RUN instructions.
+const (
+	networkDefault  = "default"
+	networkNone     = "none"
+	securitySandbox = "sandbox"
+)
+
+// runOptions holds the options of a RUN instruction changing the container
+// it runs in.
+type runOptions struct {
+	// network is networkNone to run the container without network access.
+	network string
+	// security is securitySandbox to run the container with less
+	// privileges.
+	security string
+}
+
+// cacheKey returns the entries to prepend to the command of the container
+// to tell it apart in the cache from the containers run with other options.
+// As for build-time variables, they start with "|", which no command can.
+func (o runOptions) cacheKey() []string {
+	var key []string
+	if o.network == networkNone {
+		key = append(key, "|network="+o.network)
+	}
+	if o.security != "" {
+		key = append(key, "|security="+o.security)
+	}
+	return key
+}
+
+// runOptions returns the options of a RUN instruction given the values of
+// its --network and --security flags. The network defaults to the one of the
+// build, which can't be enabled when the build disables it.
+func (b *Builder) runOptions(network, security string) (runOptions, error) {
+	opts := runOptions{network: network, security: security}
+	switch network {
+	case "":
+		opts.network = networkDefault
+		if b.options.NetworkMode == networkNone {
+			opts.network = networkNone
+		}
+	case networkDefault:
+		if b.options.NetworkMode == networkNone {
+			return runOptions{}, fmt.Errorf("RUN --network=%s isn't allowed: the network is disabled for this build", network)
+		}
+	case networkNone:
+	default:
+		return runOptions{}, fmt.Errorf("Invalid RUN --network value %q, must be %q or %q", network, networkNone, networkDefault)
+	}
+	if security != "" && security != securitySandbox {
+		return runOptions{}, fmt.Errorf("Invalid RUN --security value %q, must be %q", security, securitySandbox)
+	}
+	return opts, nil
+}
+
+func (b *Builder) create(opts runOptions) (string, error) {
 	if b.image == "" && !b.noBaseImage {
 		return "", fmt.Errorf("Please provide a source image with `from` prior to run")
 	}
@@ -501,11 +685,19 @@ func (b *Builder) create() (string, error) {
 		ShmSize:   b.options.ShmSize,
 		Resources: resources,
 	}
+	if opts.network == networkNone {
+		hostConfig.NetworkMode = container.NetworkMode(networkNone)
+	}
+	if opts.security == securitySandbox {
+		if err := sandbox(hostConfig); err != nil {
+			return "", err
+		}
+	}
 
 	config := *b.runConfig
 
 	// Create the container
-	c, err := b.docker.ContainerCreate(types.ContainerCreateConfig{
+	c, err := b.docker.ContainerCreateOnBuild(types.ContainerCreateConfig{
 		Config:     b.runConfig,
 		HostConfig: hostConfig,
 	})
@@ -653,7 +845,7 @@ func (b *Builder) parseDockerfile() error {
 		return err
 	}
 
-	return nil
+	return b.expandIncludes(b.dockerfile, contextPath(b.options.Dockerfile), nil)
 }
 
 // determine if build arg is part of built-in args or user
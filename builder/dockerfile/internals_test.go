@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/builder"
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/engine-api/types"
+	"golang.org/x/net/context"
 )
 
 func TestEmptyDockerfile(t *testing.T) {
@@ -122,3 +124,51 @@ func TestDockerfileOutsideTheBuildContext(t *testing.T) {
 		t.Fatalf("Wrong error message. Should be \"%s\". Got \"%s\"", expectedError, err.Error())
 	}
 }
+
+func TestParseChmod(t *testing.T) {
+	for _, value := range []string{"644", "0755", "4755", "1777"} {
+		mode, err := parseChmod(value)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %v", value, err)
+		}
+		if formatted := formatChmod(mode); strings.TrimLeft(formatted, "0") != strings.TrimLeft(value, "0") {
+			t.Fatalf("Expected %s to be formatted back to %s, got %s", value, value, formatted)
+		}
+	}
+
+	for _, value := range []string{"", "abc", "999", "17777", "-1"} {
+		if _, err := parseChmod(value); err == nil {
+			t.Fatalf("Expected an error parsing %q", value)
+		}
+	}
+}
+
+func TestNewBuilderSourceDateEpoch(t *testing.T) {
+	b, err := NewBuilder(context.Background(), &types.ImageBuildOptions{SourceDateEpoch: "1000000000"}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.epoch.Equal(time.Unix(1000000000, 0)) {
+		t.Fatalf("Unexpected epoch %s", b.epoch)
+	}
+	if date := b.automaticArgs["BUILD_DATE"]; date != "2001-09-09T01:46:40Z" {
+		t.Fatalf("Expected BUILD_DATE to be the epoch, got %s", date)
+	}
+
+	if _, err := NewBuilder(context.Background(), &types.ImageBuildOptions{SourceDateEpoch: "yesterday"}, nil, nil, nil); err == nil {
+		t.Fatal("Expected an error for an invalid epoch")
+	}
+}
+
+func TestNewBuilderVCSRef(t *testing.T) {
+	b, err := NewBuilder(context.Background(), &types.ImageBuildOptions{VCSRef: "abcdef"}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref := b.automaticArgs["VCS_REF"]; ref != "abcdef" {
+		t.Fatalf("Expected VCS_REF to be abcdef, got %s", ref)
+	}
+	if _, ok := b.options.BuildArgs["VCS_REF"]; ok {
+		t.Fatal("Expected VCS_REF not to be passed as a build arg")
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"strings"
 
 	"github.com/docker/docker/pkg/system"
+	"github.com/docker/engine-api/types/container"
+	"github.com/docker/engine-api/types/strslice"
 )
 
 // normaliseDest normalises the destination of a COPY/ADD command in a
@@ -24,3 +26,13 @@ func normaliseDest(cmdName, workingDir, requested string) (string, error) {
 	}
 	return dest, nil
 }
+
+// sandbox restricts the privileges of the container of a RUN instruction with
+// --security=sandbox: it can't gain new privileges, and only keeps the
+// capabilities needed to manage files and users.
+func sandbox(hostConfig *container.HostConfig) error {
+	hostConfig.CapDrop = strslice.StrSlice{"ALL"}
+	hostConfig.CapAdd = strslice.StrSlice{"CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID", "KILL", "SETGID", "SETUID"}
+	hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "no-new-privileges")
+	return nil
+}
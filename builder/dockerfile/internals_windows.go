@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/docker/docker/pkg/system"
+	"github.com/docker/engine-api/types/container"
 )
 
 // normaliseDest normalises the destination of a COPY/ADD command in a
@@ -54,3 +55,9 @@ func normaliseDest(cmdName, workingDir, requested string) (string, error) {
 	}
 	return dest, nil
 }
+
+// sandbox restricts the privileges of the container of a RUN instruction with
+// --security=sandbox, which isn't supported on Windows.
+func sandbox(hostConfig *container.HostConfig) error {
+	return fmt.Errorf("RUN --security=sandbox is not supported on Windows")
+}
@@ -0,0 +1,218 @@
+// Package lint implements static checks on a parsed Dockerfile.
+//
+// The parser only rejects Dockerfiles it cannot make sense of. The checks in
+// this package walk the AST produced by the parser and report instructions
+// which are valid but are likely mistakes or lead to images that are harder to
+// maintain.
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api"
+	"github.com/docker/docker/builder/dockerfile/command"
+	"github.com/docker/docker/builder/dockerfile/parser"
+	"github.com/docker/docker/pkg/urlutil"
+	"github.com/docker/docker/reference"
+)
+
+// Names of the rules checked by Check.
+const (
+	RuleUnknownInstruction = "unknown-instruction"
+	RuleRemoteAdd          = "remote-add"
+	RuleInstallRecommends  = "apt-install-recommends"
+	RuleUnpinnedBaseImage  = "unpinned-base-image"
+	RuleMaintainer         = "deprecated-maintainer"
+	RuleShellFormSignals   = "shell-form-signals"
+	RuleUnusedArg          = "unused-arg"
+)
+
+// Issue is a problem found in a Dockerfile.
+type Issue struct {
+	Rule    string `json:"rule"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("line %d: %s (%s)", i.Line, i.Message, i.Rule)
+}
+
+var aptGetInstall = regexp.MustCompile(`\bapt-get\s+(?:-\S+\s+)*install\b`)
+
+// checkFunc checks a single instruction of a Dockerfile.
+type checkFunc func(node *parser.Node) *Issue
+
+var checks = []checkFunc{
+	checkUnknownInstruction,
+	checkRemoteAdd,
+	checkInstallRecommends,
+	checkUnpinnedBaseImage,
+	checkMaintainer,
+	checkShellFormSignals,
+}
+
+// Check runs all the checks against the instructions of the Dockerfile
+// whose AST is rooted at ast, and returns the issues found ordered by line.
+func Check(ast *parser.Node) []Issue {
+	var issues []Issue
+	for _, node := range ast.Children {
+		for _, check := range checks {
+			if issue := check(node); issue != nil {
+				issues = append(issues, *issue)
+			}
+		}
+		// Check the trigger instructions registered by ONBUILD as well.
+		if node.Value == command.Onbuild && node.Next != nil && len(node.Next.Children) > 0 {
+			trigger := node.Next.Children[0]
+			for _, check := range checks {
+				if issue := check(trigger); issue != nil {
+					issue.Line = node.StartLine
+					issues = append(issues, *issue)
+				}
+			}
+		}
+	}
+	issues = append(issues, checkUnusedArgs(ast)...)
+	sort.Stable(byLine(issues))
+	return issues
+}
+
+func newIssue(node *parser.Node, rule, format string, a ...interface{}) *Issue {
+	return &Issue{
+		Rule:    rule,
+		Line:    node.StartLine,
+		Message: fmt.Sprintf(format, a...),
+	}
+}
+
+func args(node *parser.Node) []string {
+	var args []string
+	for n := node.Next; n != nil; n = n.Next {
+		args = append(args, n.Value)
+	}
+	return args
+}
+
+func checkUnknownInstruction(node *parser.Node) *Issue {
+	if _, ok := command.Commands[node.Value]; ok {
+		return nil
+	}
+	return newIssue(node, RuleUnknownInstruction, "Unknown instruction: %s", strings.ToUpper(node.Value))
+}
+
+func checkRemoteAdd(node *parser.Node) *Issue {
+	if node.Value != command.Add {
+		return nil
+	}
+	srcs := args(node)
+	if len(srcs) < 2 {
+		return nil
+	}
+	for _, src := range srcs[:len(srcs)-1] {
+		if urlutil.IsURL(src) {
+			return newIssue(node, RuleRemoteAdd, "ADD of the remote URL %s cannot be cached or verified, download it in a RUN instruction instead", src)
+		}
+	}
+	return nil
+}
+
+func checkInstallRecommends(node *parser.Node) *Issue {
+	if node.Value != command.Run {
+		return nil
+	}
+	line := strings.Join(args(node), " ")
+	if aptGetInstall.MatchString(line) && !strings.Contains(line, "--no-install-recommends") {
+		return newIssue(node, RuleInstallRecommends, "apt-get install without --no-install-recommends installs unneeded packages")
+	}
+	return nil
+}
+
+func checkUnpinnedBaseImage(node *parser.Node) *Issue {
+	if node.Value != command.From || node.Next == nil {
+		return nil
+	}
+	name := node.Next.Value
+	if name == api.NoBaseImageSpecifier || strings.Contains(name, "$") {
+		return nil
+	}
+	ref, err := reference.ParseNamed(name)
+	if err != nil {
+		// Leave it to the builder to report invalid references
+		return nil
+	}
+	if _, ok := ref.(reference.Canonical); ok {
+		return nil
+	}
+	if tagged, ok := ref.(reference.NamedTagged); ok && tagged.Tag() != reference.DefaultTag {
+		return nil
+	}
+	return newIssue(node, RuleUnpinnedBaseImage, "Base image %s is not pinned to a tag or digest", name)
+}
+
+func checkMaintainer(node *parser.Node) *Issue {
+	if node.Value != command.Maintainer {
+		return nil
+	}
+	return newIssue(node, RuleMaintainer, "MAINTAINER is deprecated, use a maintainer LABEL instead")
+}
+
+func checkShellFormSignals(node *parser.Node) *Issue {
+	if node.Value != command.Cmd && node.Value != command.Entrypoint {
+		return nil
+	}
+	if node.Next == nil || node.Attributes["json"] {
+		return nil
+	}
+	return newIssue(node, RuleShellFormSignals, "%s in shell form runs as a child of /bin/sh -c, which does not forward signals; use the JSON form", strings.ToUpper(node.Value))
+}
+
+// checkUnusedArgs reports ARG instructions which are never referenced by a
+// later instruction of their scope. As build args are part of the environment
+// of RUN instructions, an ARG followed by a RUN is always considered used.
+//
+// The scoping is the one of the builder: an ARG applies to the instructions
+// following it up to the next FROM, except for the ARGs preceding the first
+// FROM, which apply to all the stages.
+func checkUnusedArgs(ast *parser.Node) []Issue {
+	var issues []Issue
+	global := true
+	for i, node := range ast.Children {
+		if node.Value == command.From {
+			global = false
+		}
+		if node.Value != command.Arg || node.Next == nil {
+			continue
+		}
+		name := strings.SplitN(node.Next.Value, "=", 2)[0]
+		ref := regexp.MustCompile(`\$(?:` + regexp.QuoteMeta(name) + `\b|\{` + regexp.QuoteMeta(name) + `\b)`)
+
+		used := false
+		for _, later := range ast.Children[i+1:] {
+			// FROM doesn't expand build args.
+			if later.Value == command.From {
+				if global {
+					continue
+				}
+				break
+			}
+			if later.Value == command.Run || ref.MatchString(later.Original) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			issues = append(issues, *newIssue(node, RuleUnusedArg, "ARG %s is never used", name))
+		}
+	}
+	return issues
+}
+
+type byLine []Issue
+
+func (s byLine) Len() int           { return len(s) }
+func (s byLine) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byLine) Less(i, j int) bool { return s[i].Line < s[j].Line }
@@ -0,0 +1,63 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/builder/dockerfile/parser"
+)
+
+func checkDockerfile(t *testing.T, dockerfile string) []Issue {
+	ast, err := parser.Parse(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatalf("Error when parsing Dockerfile: %s", err)
+	}
+	return Check(ast)
+}
+
+func TestCheck(t *testing.T) {
+	testCases := []struct {
+		dockerfile string
+		rule       string
+		line       int
+	}{
+		{"FROM busybox:1.24\nFOO bar", RuleUnknownInstruction, 2},
+		{"FROM busybox:1.24\nADD http://example.com/file /file", RuleRemoteAdd, 2},
+		{"FROM debian:8\nRUN apt-get update && \\\n  apt-get install -y curl", RuleInstallRecommends, 2},
+		{"FROM busybox", RuleUnpinnedBaseImage, 1},
+		{"FROM busybox:latest", RuleUnpinnedBaseImage, 1},
+		{"FROM busybox:1.24\nMAINTAINER me", RuleMaintainer, 2},
+		{"FROM busybox:1.24\nCMD top", RuleShellFormSignals, 2},
+		{"FROM busybox:1.24\nONBUILD ENTRYPOINT top", RuleShellFormSignals, 2},
+		{"FROM busybox:1.24\nARG foo\nENV bar baz", RuleUnusedArg, 2},
+		{"FROM busybox:1.24\nARG foo=1\nFROM busybox:1.24\nENV bar $foo", RuleUnusedArg, 2},
+		{"ARG foo=1\nFROM busybox:1.24\nENV bar baz\nFROM busybox:1.24\nENV bar baz", RuleUnusedArg, 1},
+	}
+
+	for _, tc := range testCases {
+		issues := checkDockerfile(t, tc.dockerfile)
+		if len(issues) != 1 {
+			t.Fatalf("Expected one issue for %q, got %v", tc.dockerfile, issues)
+		}
+		if issues[0].Rule != tc.rule || issues[0].Line != tc.line {
+			t.Fatalf("Expected %s on line %d for %q, got %s", tc.rule, tc.line, tc.dockerfile, issues[0])
+		}
+	}
+}
+
+func TestCheckClean(t *testing.T) {
+	dockerfiles := []string{
+		"FROM scratch\nCOPY app /app\nENTRYPOINT [\"/app\"]",
+		"FROM busybox@sha256:a59906e33509d14c036c8678d687bd4eec81ed7c4b8ce907b888c607f6a1e0e6\nCMD [\"top\"]",
+		"FROM debian:8\nRUN apt-get install -y --no-install-recommends curl",
+		"FROM busybox:1.24\nARG version\nENV version ${version}",
+		"FROM busybox:1.24\nARG version\nRUN ./build.sh",
+		"ARG version=1\nFROM busybox:1.24\nENV version ${version}",
+		"ARG version=1\nFROM busybox:1.24\nENV bar baz\nFROM busybox:1.24\nLABEL version=$version",
+	}
+	for _, dockerfile := range dockerfiles {
+		if issues := checkDockerfile(t, dockerfile); len(issues) != 0 {
+			t.Fatalf("Expected no issues for %q, got %v", dockerfile, issues)
+		}
+	}
+}
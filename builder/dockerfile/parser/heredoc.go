@@ -0,0 +1,143 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/builder/dockerfile/command"
+)
+
+// Heredoc is a here-document following a RUN or COPY instruction, e.g.
+//
+//   COPY <<EOF /etc/app.conf
+//   key=value
+//   EOF
+//
+// Content holds the lines between the instruction and the line with the
+// delimiter Name, each of them terminated by a newline, exactly as they
+// appear in the Dockerfile.
+type Heredoc struct {
+	Name    string
+	Content string
+}
+
+var (
+	heredocMarker     = regexp.MustCompile(`^<<(-?)(["']?)([a-zA-Z_][a-zA-Z0-9_]*)(["']?)`)
+	heredocMarkerWord = regexp.MustCompile(`^<<-?["']?([a-zA-Z_][a-zA-Z0-9_]*)["']?$`)
+)
+
+// heredocCommands are the instructions which may be followed by heredocs.
+var heredocCommands = map[string]bool{
+	command.Run:  true,
+	command.Copy: true,
+}
+
+// HeredocName returns the name of the heredoc referred to by word, if word
+// is a heredoc marker such as <<EOF.
+func HeredocName(word string) (string, bool) {
+	m := heredocMarkerWord.FindStringSubmatch(word)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// heredocMarkers returns the submatches of heredocMarker for the heredoc
+// markers of the shell command line, in order. A marker is only recognised as
+// a word of its own, so the shift operators of arithmetic expansions, e.g.
+// $((a<<b)), the here-strings, e.g. <<<word, and the markers in quotes are
+// not heredocs.
+func heredocMarkers(line string) [][]string {
+	// operators are the characters which delimit the words of the shell.
+	const operators = " \t;&|()<>"
+
+	var (
+		markers    [][]string
+		quote      byte
+		arithmetic int
+		previous   byte = ' '
+	)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' && i+1 < len(line) {
+				i++
+			}
+		case c == '\\':
+			// The escaped character is part of a word.
+			i++
+			c = '\\'
+		case c == '\'' || c == '"':
+			quote = c
+		case strings.HasPrefix(line[i:], "$(("):
+			arithmetic += 2
+			i += 2
+			c = '('
+		case arithmetic > 0:
+			if c == '(' {
+				arithmetic++
+			} else if c == ')' {
+				arithmetic--
+			}
+		case c == '<' && previous != '<':
+			if m := heredocMarker.FindStringSubmatch(line[i:]); m != nil && strings.IndexByte(operators, previous) >= 0 {
+				end := i + len(m[0])
+				if end == len(line) || strings.IndexByte(operators, line[end]) >= 0 {
+					markers = append(markers, m)
+					i = end - 1
+					c = ' '
+					break
+				}
+			}
+			// Skip the whole operator, e.g. the <<< of a here-string.
+			for i+1 < len(line) && line[i+1] == '<' {
+				i++
+			}
+		}
+		previous = c
+	}
+	return markers
+}
+
+// parseHeredocs reads the content of the heredocs introduced by the
+// instruction in node from scanner, and returns the number of lines read.
+func parseHeredocs(node *Node, scanner *bufio.Scanner) (int, error) {
+	if !heredocCommands[node.Value] || node.Attributes["json"] {
+		return 0, nil
+	}
+
+	var lines int
+	for _, m := range heredocMarkers(node.Original) {
+		stripTabs, name := m[1] == "-", m[3]
+		if m[2] != m[4] {
+			return lines, fmt.Errorf("%s has a heredoc marker with unbalanced quotes: %s", strings.ToUpper(node.Value), m[0])
+		}
+
+		var content []string
+		terminated := false
+		for scanner.Scan() {
+			lines++
+			// The lines of a Dockerfile with CRLF line endings keep their
+			// \r, which is not part of the content nor of the delimiter.
+			line := strings.TrimSuffix(scanner.Text(), "\r")
+			if stripTabs {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if line == name {
+				terminated = true
+				break
+			}
+			content = append(content, line+"\n")
+		}
+		if !terminated {
+			return lines, fmt.Errorf("%s has an unterminated heredoc: %s", strings.ToUpper(node.Value), name)
+		}
+		node.Heredocs = append(node.Heredocs, Heredoc{Name: name, Content: strings.Join(content, "")})
+	}
+	return lines, nil
+}
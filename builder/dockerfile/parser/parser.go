@@ -8,6 +8,7 @@ import (
 	"io"
 	"regexp"
 	"strings"
+	"sync"
 	"unicode"
 
 	"github.com/docker/docker/builder/dockerfile/command"
@@ -32,8 +33,10 @@ type Node struct {
 	Attributes map[string]bool // special attributes for this node
 	Original   string          // original line used before parsing
 	Flags      []string        // only top Node should have this set
+	Heredocs   []Heredoc       // only top Node should have this set
 	StartLine  int             // the line in the original dockerfile where the node begins
 	EndLine    int             // the line in the original dockerfile where the node ends
+	Source     string          // the file the node was included from, empty for the dockerfile itself
 }
 
 var (
@@ -45,6 +48,10 @@ var (
 	tokenComment          = regexp.MustCompile(`^#.*$`)
 	lookingForDirectives  bool
 	directiveEscapeSeen   bool
+
+	// parseMu serializes calls to Parse, which keeps its state in the
+	// package level variables above.
+	parseMu sync.Mutex
 )
 
 const defaultTokenEscape = "\\"
@@ -76,6 +83,7 @@ func init() {
 		command.Expose:      parseStringsWhitespaceDelimited,
 		command.From:        parseString,
 		command.Healthcheck: parseHealthConfig,
+		command.Include:     parseString,
 		command.Label:       parseLabel,
 		command.Maintainer:  parseString,
 		command.Onbuild:     parseSubCommand,
@@ -146,6 +154,9 @@ func ParseLine(line string) (string, *Node, error) {
 // Parse is the main parse routine.
 // It handles an io.ReadWriteCloser and returns the root of the AST.
 func Parse(rwc io.Reader) (*Node, error) {
+	parseMu.Lock()
+	defer parseMu.Unlock()
+
 	directiveEscapeSeen = false
 	lookingForDirectives = true
 	setTokenEscape(defaultTokenEscape) // Assume the default token for escape
@@ -196,6 +207,12 @@ func Parse(rwc io.Reader) (*Node, error) {
 		}
 
 		if child != nil {
+			n, err := parseHeredocs(child, scanner)
+			if err != nil {
+				return nil, err
+			}
+			currentLine += n
+
 			// Update the line information for the current child.
 			child.StartLine = startLine
 			child.EndLine = currentLine
@@ -6,7 +6,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -164,3 +166,97 @@ func TestLineInformation(t *testing.T) {
 		}
 	}
 }
+
+func TestParseHeredocs(t *testing.T) {
+	df, err := os.Open(filepath.Join(testDir, "heredoc", "Dockerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer df.Close()
+
+	ast, err := Parse(df)
+	if err != nil {
+		t.Fatalf("Error parsing dockerfile: %v", err)
+	}
+
+	expected := []struct {
+		heredoc    Heredoc
+		start, end int
+	}{
+		{Heredoc{Name: "EOF", Content: "  echo \"hello\"\n\techo world\n"}, 2, 5},
+		{Heredoc{Name: "CONF", Content: "key = value\n"}, 6, 8},
+	}
+	for i, e := range expected {
+		child := ast.Children[i+1]
+		if len(child.Heredocs) != 1 || child.Heredocs[0] != e.heredoc {
+			t.Fatalf("Expected heredoc %+v for child %d, got %+v", e.heredoc, i+1, child.Heredocs)
+		}
+		if child.StartLine != e.start || child.EndLine != e.end {
+			t.Fatalf("Wrong line information for child %d: expected(%d-%d), actual(%d-%d)", i+1, e.start, e.end, child.StartLine, child.EndLine)
+		}
+	}
+	if ast.Children[3].StartLine != 9 {
+		t.Fatalf("Expected the instruction following the heredocs on line 9, got %d", ast.Children[3].StartLine)
+	}
+}
+
+func TestParseHeredocsCRLF(t *testing.T) {
+	dockerfile := "FROM busybox\r\nRUN <<EOF\r\necho hello\r\nEOF\r\nRUN cat <<-END\r\n\tworld\r\n\tEND\r\nCMD [\"true\"]\r\n"
+	ast, err := Parse(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatalf("Error parsing dockerfile: %v", err)
+	}
+	if len(ast.Children) != 4 {
+		t.Fatalf("Expected 4 instructions, got %d", len(ast.Children))
+	}
+	expected := []Heredoc{{Name: "EOF", Content: "echo hello\n"}, {Name: "END", Content: "world\n"}}
+	for i, e := range expected {
+		child := ast.Children[i+1]
+		if len(child.Heredocs) != 1 || child.Heredocs[0] != e {
+			t.Fatalf("Expected heredoc %+v for child %d, got %+v", e, i+1, child.Heredocs)
+		}
+	}
+}
+
+func TestHeredocMarkers(t *testing.T) {
+	tests := []struct {
+		line  string
+		names []string
+	}{
+		{"RUN <<EOF", []string{"EOF"}},
+		{"RUN cat <<-'EOF' >/tmp/out && cat <<\"END\"", []string{"EOF", "END"}},
+		{"RUN cat <<EOF|sort >out", []string{"EOF"}},
+		{"RUN echo $((a<<b))", nil},
+		{"RUN echo $(( (a << b) + $((c<<d)) ))", nil},
+		{"RUN cat <<<word", nil},
+		{"RUN cat <<< EOF", nil},
+		{"RUN echo \"<<EOF\" '<<END'", nil},
+		{"RUN echo \\<<EOF", nil},
+		{"RUN echo a<<EOF", nil},
+		{"RUN cat <<EOF-x", nil},
+		{"RUN echo $((1<<2)) && cat <<EOF", []string{"EOF"}},
+	}
+	for _, test := range tests {
+		var names []string
+		for _, m := range heredocMarkers(test.line) {
+			names = append(names, m[3])
+		}
+		if !reflect.DeepEqual(names, test.names) {
+			t.Errorf("Expected heredocs %v for %q, got %v", test.names, test.line, names)
+		}
+	}
+}
+
+func TestParseShiftOperatorsWithoutHeredocs(t *testing.T) {
+	dockerfile := "FROM busybox\nRUN echo $((a<<b)) && cat <<<word\nCMD [\"true\"]\n"
+	ast, err := Parse(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatalf("Error parsing dockerfile: %v", err)
+	}
+	if len(ast.Children) != 3 {
+		t.Fatalf("Expected 3 instructions, got %d", len(ast.Children))
+	}
+	if heredocs := ast.Children[1].Heredocs; len(heredocs) != 0 {
+		t.Fatalf("Expected no heredocs, got %+v", heredocs)
+	}
+}
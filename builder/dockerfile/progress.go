@@ -0,0 +1,141 @@
+package dockerfile
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/pkg/stringid"
+	"github.com/docker/engine-api/types"
+)
+
+// buildProgress sends the BuildEvents describing the progress of a build,
+// when the client asked for them.
+type buildProgress struct {
+	b       *Builder
+	started time.Time
+
+	mu          sync.Mutex
+	steps       int
+	cachedSteps int
+	failed      *types.BuildEvent
+}
+
+// progressStep is an instruction being dispatched.
+type progressStep struct {
+	event  types.BuildEvent
+	parent string
+}
+
+func newBuildProgress(b *Builder) *buildProgress {
+	return &buildProgress{b: b, started: time.Now()}
+}
+
+func (p *buildProgress) enabled() bool {
+	return p.b.options.Events && p.b.Aux != nil
+}
+
+func (p *buildProgress) emit(event types.BuildEvent) {
+	if err := p.b.Aux.Emit(types.BuildAux{Event: &event}); err != nil {
+		logrus.Debugf("[BUILDER] failed to send build event: %v", err)
+	}
+}
+
+// start records the start of the dispatch of n by the stage builder sb.
+func (p *buildProgress) start(sb *Builder, n *buildNode) *progressStep {
+	sb.stepCached = false
+	step := &progressStep{
+		event: types.BuildEvent{
+			Stage:       n.stage,
+			Step:        n.step + 1,
+			File:        n.ast.Source,
+			Line:        n.ast.StartLine,
+			Instruction: n.ast.Original,
+		},
+		parent: sb.image,
+	}
+	if p.enabled() {
+		event := step.event
+		event.Type = types.BuildEventStepStart
+		event.Time = time.Now()
+		p.emit(event)
+	}
+	step.event.Time = time.Now()
+	return step
+}
+
+// end records the end of step, which failed if err is not nil.
+func (p *buildProgress) end(sb *Builder, step *progressStep, err error) {
+	event := step.event
+	event.Type = types.BuildEventStepEnd
+	event.Duration = time.Since(step.event.Time)
+	event.Time = time.Now()
+	event.Cached = sb.stepCached
+
+	p.mu.Lock()
+	p.steps++
+	if sb.stepCached {
+		p.cachedSteps++
+	}
+	if err != nil {
+		event.Error = err.Error()
+		if p.failed == nil {
+			p.failed = &event
+		}
+	}
+	p.mu.Unlock()
+
+	if !p.enabled() {
+		return
+	}
+	if err == nil && sb.image != "" {
+		event.ImageID = stringid.TruncateID(sb.image)
+		if sb.image != step.parent {
+			event.Size = p.layerSize(sb)
+		}
+	}
+	p.emit(event)
+}
+
+// layerSize returns the size of the most recent layer of the image of sb.
+func (p *buildProgress) layerSize(sb *Builder) int64 {
+	history, err := sb.docker.ImageHistory(sb.image)
+	if err != nil || len(history) == 0 {
+		logrus.Debugf("[BUILDER] failed to get the history of %s: %v", sb.image, err)
+		return 0
+	}
+	return history[0].Size
+}
+
+// summary sends the summary of the build, which produced imageID or failed
+// with err.
+func (p *buildProgress) summary(imageID string, err error) {
+	if !p.enabled() {
+		return
+	}
+
+	p.mu.Lock()
+	event := types.BuildEvent{
+		Type:        types.BuildEventSummary,
+		Time:        time.Now(),
+		Duration:    time.Since(p.started),
+		Steps:       p.steps,
+		CachedSteps: p.cachedSteps,
+	}
+	if err != nil {
+		event.Error = err.Error()
+		if p.failed != nil {
+			event.Stage = p.failed.Stage
+			event.Step = p.failed.Step
+			event.Line = p.failed.Line
+			event.Instruction = p.failed.Instruction
+		}
+	}
+	p.mu.Unlock()
+
+	if imageID != "" {
+		event.ImageID = stringid.TruncateID(imageID)
+		event.ID = imageID
+	}
+	p.emit(event)
+}
@@ -0,0 +1,75 @@
+package dockerfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/builder/dockerfile/parser"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/streamformatter"
+	"github.com/docker/engine-api/types"
+)
+
+func TestBuildProgressEvents(t *testing.T) {
+	ast, err := parser.Parse(strings.NewReader("FROM busybox\n\nRUN false\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	b := &Builder{
+		options: &types.ImageBuildOptions{Events: true},
+		Aux:     &streamformatter.AuxFormatter{Writer: buf, StreamFormatter: streamformatter.NewJSONStreamFormatter()},
+		image:   "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	}
+	p := newBuildProgress(b)
+
+	step := p.start(b, &buildNode{stage: 0, step: 1, ast: ast.Children[1]})
+	b.stepCached = true
+	p.end(b, step, errors.New("failed"))
+	p.summary("", errors.New("failed"))
+
+	var events []types.BuildEvent
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		var aux types.BuildAux
+		if err := json.Unmarshal(*msg.Aux, &aux); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, *aux.Event)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+	start, end, summary := events[0], events[1], events[2]
+	if start.Type != types.BuildEventStepStart || start.Step != 2 || start.Line != 3 || start.Instruction != "RUN false" {
+		t.Fatalf("Unexpected start event %+v", start)
+	}
+	if end.Type != types.BuildEventStepEnd || end.Error != "failed" || !end.Cached || end.ImageID != "" {
+		t.Fatalf("Unexpected end event %+v", end)
+	}
+	if summary.Type != types.BuildEventSummary || summary.Line != 3 || summary.Steps != 1 || summary.CachedSteps != 1 || summary.Error != "failed" {
+		t.Fatalf("Unexpected summary event %+v", summary)
+	}
+}
+
+func TestBuildProgressDisabled(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	b := &Builder{
+		options: &types.ImageBuildOptions{},
+		Aux:     &streamformatter.AuxFormatter{Writer: buf, StreamFormatter: streamformatter.NewJSONStreamFormatter()},
+	}
+	p := newBuildProgress(b)
+	p.summary("sha256:0123456789abcdef", nil)
+	if buf.Len() != 0 {
+		t.Fatalf("Expected no events to be sent, got %q", buf.String())
+	}
+}
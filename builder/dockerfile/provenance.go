@@ -0,0 +1,150 @@
+package dockerfile
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/builder"
+	"github.com/docker/docker/pkg/stringid"
+	"github.com/docker/docker/pkg/urlutil"
+	"github.com/docker/docker/reference"
+)
+
+// Labels describing how an image was built, set when the ProvenanceLabels
+// build option is enabled. They follow the annotations of the OCI image
+// specification where one exists.
+const (
+	labelCreated    = "org.opencontainers.image.created"
+	labelRevision   = "org.opencontainers.image.revision"
+	labelSource     = "org.opencontainers.image.source"
+	labelBaseName   = "org.opencontainers.image.base.name"
+	labelBaseDigest = "org.opencontainers.image.base.digest"
+	labelDockerfile = "com.docker.image.dockerfile"
+)
+
+// setBaseImage records the image resolved for FROM name as the base image
+// of the build. It is described by its repository digest when one matches
+// name, and by its ID otherwise.
+func (b *Builder) setBaseImage(name string, img builder.Image) {
+	b.baseName, b.baseDigest = "", ""
+	if !b.options.ProvenanceLabels || img == nil {
+		return
+	}
+	b.baseName = name
+	b.baseDigest = img.ImageID()
+
+	ref, err := reference.ParseNamed(name)
+	if err != nil {
+		return
+	}
+	if canonical, ok := ref.(reference.Canonical); ok {
+		b.baseDigest = canonical.Digest().String()
+		return
+	}
+	inspect, err := b.docker.LookupImage(img.ImageID())
+	if err != nil {
+		return
+	}
+	for _, repoDigest := range inspect.RepoDigests {
+		r, err := reference.ParseNamed(repoDigest)
+		if err != nil {
+			continue
+		}
+		if canonical, ok := r.(reference.Canonical); ok && r.Name() == ref.Name() {
+			b.baseDigest = canonical.Digest().String()
+			return
+		}
+	}
+}
+
+// provenanceLabels returns the labels describing the build of the image. The
+// creation time is the source date epoch of a reproducible build, or else the
+// time the build started, as the BUILD_DATE build argument.
+func (b *Builder) provenanceLabels() map[string]string {
+	labels := map[string]string{
+		labelDockerfile: b.options.Dockerfile,
+	}
+	if !b.epoch.IsZero() {
+		labels[labelCreated] = b.epoch.UTC().Format(time.RFC3339)
+	} else if created := b.buildArgValue("BUILD_DATE"); created != "" {
+		labels[labelCreated] = created
+	}
+	if labels[labelDockerfile] == "" {
+		labels[labelDockerfile] = builder.DefaultDockerfileName
+	}
+	if revision := b.buildArgValue("VCS_REF"); revision != "" {
+		labels[labelRevision] = revision
+	}
+	if b.source != "" {
+		labels[labelSource] = b.source
+	}
+	if b.baseName != "" {
+		labels[labelBaseName] = b.baseName
+		labels[labelBaseDigest] = b.baseDigest
+	}
+	return labels
+}
+
+// buildArgValue returns the value of the build argument name passed to the
+// build, or else the one set automatically by the builder.
+func (b *Builder) buildArgValue(name string) string {
+	if value, ok := b.options.BuildArgs[name]; ok {
+		return value
+	}
+	return b.automaticArgs[name]
+}
+
+// setProvenanceLabels sets the provenance labels on the config of the image,
+// which the next instruction commits.
+func (b *Builder) setProvenanceLabels() {
+	if b.runConfig.Labels == nil {
+		b.runConfig.Labels = make(map[string]string)
+	}
+	for k, v := range b.provenanceLabels() {
+		b.runConfig.Labels[k] = v
+	}
+	b.provenanceSet = true
+}
+
+// addProvenanceLabels commits the provenance labels on top of the image
+// built so far, when the last instruction didn't commit them, e.g. if it is
+// a FROM.
+func (b *Builder) addProvenanceLabels() error {
+	labels := b.provenanceLabels()
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	args := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		args = append(args, k, labels[k])
+	}
+
+	fmt.Fprintf(b.Stdout, "Adding provenance labels\n")
+	b.flags = NewBFlags()
+	if err := label(b, args, nil, ""); err != nil {
+		return err
+	}
+	fmt.Fprintf(b.Stdout, " ---> %s\n", stringid.TruncateID(b.image))
+	return nil
+}
+
+// sourceURL returns the URL of the remote Git context remote, without the
+// credentials it may embed, or an empty string if it isn't one.
+func sourceURL(remote string) string {
+	if !urlutil.IsGitURL(remote) {
+		return ""
+	}
+	if !urlutil.IsURL(remote) {
+		return remote
+	}
+	u, err := url.Parse(remote)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	return u.String()
+}
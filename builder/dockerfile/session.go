@@ -0,0 +1,158 @@
+package dockerfile
+
+import (
+	"bytes"
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api"
+	"github.com/docker/docker/builder/dockerfile/command"
+	"github.com/docker/docker/builder/dockerfile/parser"
+	"github.com/docker/docker/builder/dockerignore"
+	"github.com/docker/docker/pkg/urlutil"
+	"github.com/docker/engine-api/types"
+	"golang.org/x/net/context"
+)
+
+// SyncContext records the build context described by request as the one of
+// its session, and returns the files the client needs to send to build it.
+func (bm *BuildManager) SyncContext(ctx context.Context, request types.BuildContextSyncRequest) (types.BuildContextSyncResponse, error) {
+	if bm.contexts == nil {
+		return types.BuildContextSyncResponse{}, errors.New("build context sessions are not supported by this daemon")
+	}
+	ast, err := parser.Parse(bytes.NewReader(request.DockerfileContent))
+	if err != nil {
+		return types.BuildContextSyncResponse{}, err
+	}
+	dockerfile := request.Dockerfile
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	required, err := bm.contexts.Sync(request.SessionID, request.Files, bm.contextFilter(ast, dockerfile))
+	if err != nil {
+		return types.BuildContextSyncResponse{}, err
+	}
+	return types.BuildContextSyncResponse{Required: required}, nil
+}
+
+// contextFilter returns a function reporting whether a file of the build
+// context may be used when building the Dockerfile whose AST is rooted at ast:
+// the Dockerfile itself, its ignore files, and the files matched by the
+// sources of ADD and COPY instructions, including the ONBUILD triggers of the
+// base images. When the sources can't be known in advance, every file is
+// considered used.
+func (bm *BuildManager) contextFilter(ast *parser.Node, dockerfile string) func(string) bool {
+	patterns := append([]string{filepath.ToSlash(dockerfile)}, dockerignore.FileNames(dockerfile)...)
+	all := false
+
+	addSources := func(node *parser.Node) {
+		srcs, ok := contextSources(node)
+		if !ok {
+			all = true
+		}
+		patterns = append(patterns, srcs...)
+	}
+
+	for _, node := range ast.Children {
+		switch node.Value {
+		case command.Add, command.Copy:
+			addSources(node)
+		case command.Include:
+			// The instructions of the included file are unknown until it
+			// is sent.
+			all = true
+		case command.From:
+			if node.Next == nil || node.Next.Value == api.NoBaseImageSpecifier {
+				continue
+			}
+			if strings.Contains(node.Next.Value, "$") {
+				all = true
+				continue
+			}
+			// The base image may not be pulled yet, in which case its
+			// triggers are unknown. It is only looked up to read them, so
+			// it isn't verified against the signature policy here, but
+			// when the build starts from it.
+			img, err := bm.backend.LookupImage(node.Next.Value)
+			if err != nil || img.Config == nil {
+				all = true
+				continue
+			}
+			for _, trigger := range img.Config.OnBuild {
+				triggerAST, err := parser.Parse(strings.NewReader(trigger))
+				if err != nil {
+					all = true
+					continue
+				}
+				for _, n := range triggerAST.Children {
+					addSources(n)
+				}
+			}
+		}
+	}
+
+	return func(p string) bool {
+		if all {
+			return true
+		}
+		for _, pattern := range patterns {
+			if matchContextSource(pattern, p) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// contextSources returns the sources of an ADD or COPY instruction which are
+// read from the build context, as slash separated paths relative to its root.
+// It returns false if they can't be determined before the build, as is the
+// case when a source is the root of the context or refers to a variable.
+func contextSources(node *parser.Node) ([]string, bool) {
+	if node.Value != command.Add && node.Value != command.Copy {
+		return nil, true
+	}
+
+	var args []string
+	for n := node.Next; n != nil; n = n.Next {
+		args = append(args, n.Value)
+	}
+	if len(args) < 2 {
+		return nil, true
+	}
+
+	var srcs []string
+	for _, src := range args[:len(args)-1] {
+		if _, ok := parser.HeredocName(src); ok {
+			continue
+		}
+		if urlutil.IsURL(src) {
+			continue
+		}
+		if strings.ContainsAny(src, "$\\`") {
+			return nil, false
+		}
+		src = path.Clean("/" + filepath.ToSlash(src))[1:]
+		if src == "" {
+			return nil, false
+		}
+		srcs = append(srcs, src)
+	}
+	return srcs, true
+}
+
+// matchContextSource reports whether the file p of the build context is
+// copied by the source pattern, either directly or as part of a directory.
+func matchContextSource(pattern, p string) bool {
+	for ; p != "."; p = path.Dir(p) {
+		if p == pattern {
+			return true
+		}
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
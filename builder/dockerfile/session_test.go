@@ -0,0 +1,50 @@
+package dockerfile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/builder/dockerfile/parser"
+)
+
+func TestContextSources(t *testing.T) {
+	ast, err := parser.Parse(strings.NewReader(`FROM scratch
+COPY a.txt ./src/ /dest/
+ADD http://example.com/file /dest/
+COPY $var /dest/`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srcs, ok := contextSources(ast.Children[1])
+	if !ok || !reflect.DeepEqual(srcs, []string{"a.txt", "src"}) {
+		t.Fatalf("Unexpected sources %v", srcs)
+	}
+	if srcs, ok := contextSources(ast.Children[2]); !ok || len(srcs) != 0 {
+		t.Fatalf("Expected remote sources to be ignored, got %v", srcs)
+	}
+	if _, ok := contextSources(ast.Children[3]); ok {
+		t.Fatal("Expected sources with variables to be unknown")
+	}
+}
+
+func TestMatchContextSource(t *testing.T) {
+	cases := []struct {
+		pattern, path string
+		match         bool
+	}{
+		{"a.txt", "a.txt", true},
+		{"a.txt", "b.txt", false},
+		{"src", "src/main.go", true},
+		{"src", "srcs/main.go", false},
+		{"*.go", "main.go", true},
+		{"*.go", "src/main.go", false},
+		{"src/*", "src/pkg/file.go", true},
+	}
+	for _, c := range cases {
+		if match := matchContextSource(c.pattern, c.path); match != c.match {
+			t.Errorf("matchContextSource(%q, %q) = %v, expected %v", c.pattern, c.path, match, c.match)
+		}
+	}
+}
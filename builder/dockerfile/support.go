@@ -1,6 +1,10 @@
 package dockerfile
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/docker/docker/builder/dockerfile/parser"
+)
 
 // handleJSONArgs parses command passed to CMD, ENTRYPOINT, RUN and SHELL instruction in Dockerfile
 // for exec form it returns untouched args slice
@@ -17,3 +21,21 @@ func handleJSONArgs(args []string, attributes map[string]bool) []string {
 	// literal string command, not an exec array
 	return []string{strings.Join(args, " ")}
 }
+
+// heredocScript returns the shell command of a RUN instruction followed by
+// heredocs. A RUN consisting of a single heredoc marker runs the content of
+// the heredoc as a script, otherwise the heredocs are appended to the command
+// line so that the shell feeds them to the command.
+func heredocScript(cmdLine string, heredocs []parser.Heredoc) string {
+	if len(heredocs) == 1 {
+		if name, ok := parser.HeredocName(strings.TrimSpace(cmdLine)); ok && name == heredocs[0].Name {
+			return heredocs[0].Content
+		}
+	}
+
+	script := cmdLine + "\n"
+	for _, heredoc := range heredocs {
+		script += heredoc.Content + heredoc.Name + "\n"
+	}
+	return script
+}
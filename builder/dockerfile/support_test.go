@@ -1,6 +1,10 @@
 package dockerfile
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/docker/docker/builder/dockerfile/parser"
+)
 
 type testCase struct {
 	name       string
@@ -63,3 +67,16 @@ func TestHandleJSONArgs(t *testing.T) {
 		}
 	}
 }
+
+func TestHeredocScript(t *testing.T) {
+	heredoc := parser.Heredoc{Name: "EOF", Content: "echo hello\n  echo world\n"}
+
+	if script := heredocScript("<<EOF", []parser.Heredoc{heredoc}); script != heredoc.Content {
+		t.Fatalf("Expected the heredoc content to be run, got %q", script)
+	}
+
+	expected := "python3 <<EOF\necho hello\n  echo world\nEOF\n"
+	if script := heredocScript("python3 <<EOF", []parser.Heredoc{heredoc}); script != expected {
+		t.Fatalf("Expected %q, got %q", expected, script)
+	}
+}
@@ -8,17 +8,19 @@ import (
 )
 
 // DockerIgnoreContext wraps a ModifiableContext to add a method
-// for handling the .dockerignore file at the root of the context.
+// for handling the .dockerignore file of the context.
 type DockerIgnoreContext struct {
 	ModifiableContext
 }
 
-// Process reads the .dockerignore file at the root of the embedded context.
-// If .dockerignore does not exist in the context, then nil is returned.
+// Process reads the file holding the ignore patterns of the embedded context:
+// the <Dockerfile>.dockerignore file next to the Dockerfile, given as the first
+// of filesToRemove, or the .dockerignore file at the root of the context.
+// If neither exists in the context, then nil is returned.
 //
-// It can take a list of files to be removed after .dockerignore is removed.
+// It can take a list of files to be removed after the ignore file is removed.
 // This is used for server-side implementations of builders that need to send
-// the .dockerignore file as well as the special files specified in filesToRemove,
+// the ignore file as well as the special files specified in filesToRemove,
 // but expect them to be excluded from the context after they were processed.
 //
 // For example, server-side Dockerfile builders are expected to pass in the name
@@ -27,21 +29,28 @@ type DockerIgnoreContext struct {
 // TODO: Don't require a ModifiableContext (use Context instead) and don't remove
 // files, instead handle a list of files to be excluded from the context.
 func (c DockerIgnoreContext) Process(filesToRemove []string) error {
-	f, err := c.Open(".dockerignore")
-	// Note that a missing .dockerignore file isn't treated as an error
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return err
+	names := []string{dockerignore.DefaultFile}
+	if len(filesToRemove) > 0 {
+		names = dockerignore.FileNames(filesToRemove[0])
 	}
-	excludes, _ := dockerignore.ReadAll(f)
-	filesToRemove = append([]string{".dockerignore"}, filesToRemove...)
-	for _, fileToRemove := range filesToRemove {
-		rm, _ := fileutils.Matches(fileToRemove, excludes)
-		if rm {
-			c.Remove(fileToRemove)
+	for _, name := range names {
+		f, err := c.Open(name)
+		// Note that a missing ignore file isn't treated as an error
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		excludes, _ := dockerignore.ReadAll(f)
+		filesToRemove = append([]string{name}, filesToRemove...)
+		for _, fileToRemove := range filesToRemove {
+			rm, _ := fileutils.Matches(fileToRemove, excludes)
+			if rm {
+				c.Remove(fileToRemove)
+			}
 		}
+		return nil
 	}
 	return nil
 }
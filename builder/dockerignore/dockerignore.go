@@ -5,10 +5,28 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"path"
 	"path/filepath"
 	"strings"
 )
 
+// DefaultFile is the name of the file holding the patterns of the files to
+// exclude from the build context, at the root of the context.
+const DefaultFile = ".dockerignore"
+
+// FileNames returns the names of the files which may hold the patterns to
+// exclude from the context of a build using dockerfile, in order of
+// precedence: <dockerfile>.dockerignore next to the Dockerfile, then the
+// .dockerignore file at the root of the context. Only the first one found is
+// used. The patterns are relative to the root of the context in both cases.
+func FileNames(dockerfile string) []string {
+	dockerfile = path.Clean(filepath.ToSlash(dockerfile))
+	if dockerfile == "." || dockerfile == "/" {
+		return []string{DefaultFile}
+	}
+	return []string{dockerfile + DefaultFile, DefaultFile}
+}
+
 // ReadAll reads a .dockerignore file and returns the list of file patterns
 // to ignore. Note this will trim whitespace from each line as well
 // as use GO's "clean" func to get the shortest/cleanest path for each.
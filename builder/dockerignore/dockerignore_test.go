@@ -5,9 +5,27 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
+func TestFileNames(t *testing.T) {
+	tests := []struct {
+		dockerfile string
+		expected   []string
+	}{
+		{"Dockerfile", []string{"Dockerfile.dockerignore", ".dockerignore"}},
+		{"build/Dockerfile.dev", []string{"build/Dockerfile.dev.dockerignore", ".dockerignore"}},
+		{"./build//Dockerfile", []string{"build/Dockerfile.dockerignore", ".dockerignore"}},
+		{"", []string{".dockerignore"}},
+	}
+	for _, test := range tests {
+		if names := FileNames(test.dockerfile); !reflect.DeepEqual(names, test.expected) {
+			t.Fatalf("Expected %v for %q, got %v", test.expected, test.dockerfile, names)
+		}
+	}
+}
+
 func TestReadAll(t *testing.T) {
 	tmpDir, err := ioutil.TempDir("", "dockerignore-test")
 	if err != nil {
@@ -26,3 +26,24 @@ func MakeGitContext(gitURL string) (ModifiableContext, error) {
 	}()
 	return MakeTarSumContext(c)
 }
+
+// MakeCachedGitContext returns a Context from gitURL that is checked out from
+// the repositories kept in cache, along with the ID of the commit checked out.
+func MakeCachedGitContext(cache *gitutils.Cache, gitURL string, opts gitutils.CheckoutOptions) (ModifiableContext, string, error) {
+	root, contextDir, commit, err := cache.Checkout(gitURL, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(root)
+
+	c, err := archive.Tar(contextDir, archive.Uncompressed)
+	if err != nil {
+		return nil, "", err
+	}
+	defer c.Close()
+	ctx, err := MakeTarSumContext(c)
+	if err != nil {
+		return nil, "", err
+	}
+	return ctx, commit, nil
+}
@@ -0,0 +1,341 @@
+package builder
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/chrootarchive"
+	"github.com/docker/docker/pkg/tarsum"
+	"github.com/docker/engine-api/types"
+)
+
+// maxContextSessions is the number of build contexts kept by a ContextStore.
+// When it is exceeded, the least recently used context is discarded.
+const maxContextSessions = 32
+
+var validSessionID = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,127}$`)
+
+// ContextStore keeps the build contexts synchronized by clients, so that a
+// client only needs to send the files which changed since the previous build
+// of the same session, and only the ones the build makes use of.
+type ContextStore struct {
+	root     string
+	mu       sync.Mutex
+	sessions map[string]*contextSession
+	created  uint64 // number of sessions created, used to name their directories
+}
+
+// contextSession is the build context of a session. It is locked from the
+// moment a build starts using it until the build context is closed.
+type contextSession struct {
+	sync.Mutex
+	root     string
+	lastUsed time.Time
+	files    map[string]types.BuildContextFile // files present in root, as announced by the client
+	sums     map[string]string                 // tarsum of the files present in root
+	manifest map[string]types.BuildContextFile // content of the context announced by the last sync
+}
+
+// NewContextStore creates a ContextStore keeping the build contexts of the
+// sessions in root.
+func NewContextStore(root string) (*ContextStore, error) {
+	// Sessions are only tracked in memory, the contexts left over by a
+	// previous daemon can't be trusted to match what their clients expect.
+	if err := os.RemoveAll(root); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, err
+	}
+	return &ContextStore{
+		root:     root,
+		sessions: make(map[string]*contextSession),
+	}, nil
+}
+
+func (s *ContextStore) session(id string) (*contextSession, error) {
+	if !validSessionID.MatchString(id) {
+		return nil, fmt.Errorf("invalid build session ID: %q", id)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sess, ok := s.sessions[id]; ok {
+		sess.lastUsed = time.Now()
+		return sess, nil
+	}
+
+	if len(s.sessions) >= maxContextSessions {
+		s.evict()
+	}
+	// The directory of an evicted session is removed in the background, so
+	// each session gets its own directory rather than one named after its ID
+	// only, which a session recreated with the same ID would share.
+	s.created++
+	root := filepath.Join(s.root, fmt.Sprintf("%s-%d", id, s.created))
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	sess := &contextSession{
+		root:     root,
+		lastUsed: time.Now(),
+		files:    make(map[string]types.BuildContextFile),
+		sums:     make(map[string]string),
+		manifest: make(map[string]types.BuildContextFile),
+	}
+	s.sessions[id] = sess
+	return sess, nil
+}
+
+// evict removes the least recently used session. It must be called with
+// s.mu held.
+func (s *ContextStore) evict() {
+	var (
+		oldestID string
+		oldest   *contextSession
+	)
+	for id, sess := range s.sessions {
+		if oldest == nil || sess.lastUsed.Before(oldest.lastUsed) {
+			oldestID, oldest = id, sess
+		}
+	}
+	if oldest == nil {
+		return
+	}
+	delete(s.sessions, oldestID)
+	go func() {
+		// Wait for a build still using the context to be done with it.
+		oldest.Lock()
+		defer oldest.Unlock()
+		os.RemoveAll(oldest.root)
+	}()
+}
+
+// Sync records files as the content of the build context of the session id,
+// and returns the paths of the files which have to be sent before the next
+// build of the session. Those are the files for which needed returns true,
+// and which were never received or changed since they were.
+//
+// Files are compared by their metadata and the digest of their content, so
+// that a file whose content changed is sent again even if its size and
+// modification time didn't. The files of clients which don't send digests are
+// compared by their metadata only.
+func (s *ContextStore) Sync(id string, files []types.BuildContextFile, needed func(path string) bool) ([]string, error) {
+	sess, err := s.session(id)
+	if err != nil {
+		return nil, err
+	}
+	sess.Lock()
+	defer sess.Unlock()
+
+	manifest := make(map[string]types.BuildContextFile, len(files))
+	for _, f := range files {
+		p, err := cleanContextPath(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		f.Path = p
+		manifest[p] = f
+	}
+
+	var required []string
+	for p, f := range manifest {
+		// Directories are recreated from the manifest, they never need
+		// to be sent.
+		if f.Mode.IsDir() {
+			continue
+		}
+		if old, ok := sess.files[p]; ok && sameContextFile(old, f) {
+			continue
+		}
+		// The copy received earlier, if any, is outdated.
+		delete(sess.files, p)
+		delete(sess.sums, p)
+		if needed(p) {
+			required = append(required, p)
+		}
+	}
+	for p := range sess.files {
+		if _, ok := manifest[p]; !ok {
+			delete(sess.files, p)
+			delete(sess.sums, p)
+		}
+	}
+	sess.manifest = manifest
+
+	sort.Strings(required)
+	return required, nil
+}
+
+// Context applies tarStream, which holds the files requested by the last
+// Sync of the session id, to the build context of the session and returns
+// it. The session is locked until the returned context is closed.
+func (s *ContextStore) Context(id string, tarStream io.Reader) (ModifiableContext, error) {
+	sess, err := s.session(id)
+	if err != nil {
+		return nil, err
+	}
+	sess.Lock()
+	if err := sess.apply(tarStream); err != nil {
+		sess.Unlock()
+		return nil, err
+	}
+
+	sums := make(tarsum.FileInfoSums, 0, len(sess.sums))
+	for name, sum := range sess.sums {
+		sums = append(sums, fileInfoSum{name: name, sum: sum})
+	}
+	return &sessionContext{tarSumContext: tarSumContext{root: sess.root, sums: sums}, session: sess}, nil
+}
+
+func (sess *contextSession) apply(tarStream io.Reader) error {
+	decompressedStream, err := archive.DecompressStream(tarStream)
+	if err != nil {
+		return err
+	}
+	sum, err := tarsum.NewTarSum(decompressedStream, true, tarsum.Version1)
+	if err != nil {
+		return err
+	}
+	if err := chrootarchive.Untar(sum, sess.root, nil); err != nil {
+		return err
+	}
+	for _, fi := range sum.GetSums() {
+		name := path.Clean(fi.Name())
+		if f, ok := sess.manifest[name]; ok && !f.Mode.IsDir() {
+			sess.files[name] = f
+			sess.sums[name] = fi.Sum()
+		}
+	}
+
+	// Every parent of a file is part of the context, even if the client
+	// didn't list it.
+	dirs := make(map[string]bool)
+	for p, f := range sess.manifest {
+		if f.Mode.IsDir() {
+			dirs[p] = true
+		}
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	// Remove whatever the client didn't announce, or announced as changed
+	// without sending it.
+	err = filepath.Walk(sess.root, func(fullpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sess.root, fullpath)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			if !dirs[rel] {
+				if err := os.RemoveAll(fullpath); err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if _, ok := sess.files[rel]; !ok {
+			return os.Remove(fullpath)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Recreate the directories, parents first so that their permissions
+	// and modification times are applied last.
+	var dirList []string
+	for dir := range dirs {
+		dirList = append(dirList, dir)
+	}
+	sort.Strings(dirList)
+	for _, dir := range dirList {
+		fullpath := filepath.Join(sess.root, filepath.FromSlash(dir))
+		if err := os.MkdirAll(fullpath, 0755); err != nil {
+			return err
+		}
+	}
+	for i := len(dirList) - 1; i >= 0; i-- {
+		f, ok := sess.manifest[dirList[i]]
+		if !ok {
+			continue
+		}
+		fullpath := filepath.Join(sess.root, filepath.FromSlash(f.Path))
+		if err := os.Chmod(fullpath, f.Mode.Perm()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(fullpath, f.ModTime, f.ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sessionContext is the build context of a session. Unlike a tarSumContext,
+// closing it keeps its files around for the next build of the session.
+type sessionContext struct {
+	tarSumContext
+	session *contextSession
+}
+
+func (c *sessionContext) Close() error {
+	c.session.Unlock()
+	return nil
+}
+
+func (c *sessionContext) Remove(p string) error {
+	cleanpath, err := cleanContextPath(p)
+	if err != nil {
+		return err
+	}
+	for name := range c.session.files {
+		if name == cleanpath || strings.HasPrefix(name, cleanpath+"/") {
+			delete(c.session.files, name)
+			delete(c.session.sums, name)
+		}
+	}
+	return c.tarSumContext.Remove(p)
+}
+
+type fileInfoSum struct {
+	name string
+	sum  string
+}
+
+func (fi fileInfoSum) Name() string { return fi.name }
+func (fi fileInfoSum) Sum() string  { return fi.sum }
+func (fi fileInfoSum) Pos() int64   { return 0 }
+
+// cleanContextPath returns p as a clean slash separated path relative to
+// the root of a build context.
+func cleanContextPath(p string) (string, error) {
+	cleaned := path.Clean("/" + filepath.ToSlash(p))[1:]
+	if cleaned == "" {
+		return "", fmt.Errorf("invalid path in build context: %q", p)
+	}
+	return cleaned, nil
+}
+
+func sameContextFile(a, b types.BuildContextFile) bool {
+	return a.Mode == b.Mode && a.Size == b.Size && a.ModTime.Equal(b.ModTime) && a.Digest == b.Digest
+}
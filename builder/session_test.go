@@ -0,0 +1,132 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/engine-api/types"
+)
+
+func TestContextStoreSync(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-context-store-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	store, err := NewContextStore(filepath.Join(root, "contexts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	files := []types.BuildContextFile{
+		{Path: "Dockerfile", Mode: 0644, Size: 10, ModTime: now},
+		{Path: "src", Mode: os.ModeDir | 0755, ModTime: now},
+		{Path: "src/main.go", Mode: 0644, Size: 100, ModTime: now},
+		{Path: "docs/README", Mode: 0644, Size: 20, ModTime: now},
+	}
+	needed := func(p string) bool { return p != "docs/README" }
+
+	required, err := store.Sync("session", files, needed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"Dockerfile", "src/main.go"}; !reflect.DeepEqual(required, expected) {
+		t.Fatalf("Expected %v to be required, got %v", expected, required)
+	}
+
+	// Pretend the files were received.
+	sess := store.sessions["session"]
+	for _, f := range files[:3] {
+		sess.files[f.Path] = f
+	}
+
+	files[2].ModTime = now.Add(time.Second)
+	required, err = store.Sync("session", files, needed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"src/main.go"}; !reflect.DeepEqual(required, expected) {
+		t.Fatalf("Expected %v to be required, got %v", expected, required)
+	}
+	if _, ok := sess.files["src/main.go"]; ok {
+		t.Fatal("Expected the outdated file to be forgotten")
+	}
+
+	// A file whose content changed is sent again, even if its metadata
+	// didn't change.
+	files[2].Digest = "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	sess.files["src/main.go"] = files[2]
+	files[2].Digest = "sha256:486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7"
+	required, err = store.Sync("session", files, needed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"src/main.go"}; !reflect.DeepEqual(required, expected) {
+		t.Fatalf("Expected the changed file %v to be required, got %v", expected, required)
+	}
+
+	required, err = store.Sync("session", files[1:], needed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sess.files["Dockerfile"]; ok || len(required) != 1 {
+		t.Fatalf("Expected the removed file to be forgotten, required %v", required)
+	}
+
+	if _, err := store.Sync("../escape", files, needed); err == nil {
+		t.Fatal("Expected an invalid session ID to be rejected")
+	}
+}
+
+func TestContextStoreEvictRecreatedSession(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-context-store-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	store, err := NewContextStore(filepath.Join(root, "contexts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evicted, err := store.session("session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keep the evicted session in use, so that its directory is only
+	// removed once the session created again with the same ID exists.
+	evicted.Lock()
+	store.mu.Lock()
+	store.evict()
+	store.mu.Unlock()
+
+	sess, err := store.session("session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.root == evicted.root {
+		t.Fatalf("Expected the recreated session not to reuse %s", evicted.root)
+	}
+	evicted.Unlock()
+
+	// Wait for the evicted session's directory to be removed.
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(evicted.root); os.IsNotExist(err) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := os.Stat(evicted.root); !os.IsNotExist(err) {
+		t.Fatalf("Expected %s to be removed, got %v", evicted.root, err)
+	}
+	if _, err := os.Stat(sess.root); err != nil {
+		t.Fatalf("Expected the recreated session's directory to be kept: %v", err)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	swarmrouter "github.com/docker/docker/api/server/router/swarm"
 	systemrouter "github.com/docker/docker/api/server/router/system"
 	"github.com/docker/docker/api/server/router/volume"
+	"github.com/docker/docker/builder"
 	"github.com/docker/docker/builder/dockerfile"
 	cliflags "github.com/docker/docker/cli/flags"
 	"github.com/docker/docker/cliconfig"
@@ -33,6 +34,7 @@ import (
 	"github.com/docker/docker/libcontainerd"
 	"github.com/docker/docker/opts"
 	"github.com/docker/docker/pkg/authorization"
+	"github.com/docker/docker/pkg/gitutils"
 	"github.com/docker/docker/pkg/jsonlog"
 	"github.com/docker/docker/pkg/listeners"
 	flag "github.com/docker/docker/pkg/mflag"
@@ -290,8 +292,21 @@ func (cli *DaemonCli) start() (err error) {
 		"graphdriver": d.GraphDriverName(),
 	}).Info("Docker daemon")
 
+	contexts, err := builder.NewContextStore(filepath.Join(cli.Config.Root, "builder", "contexts"))
+	if err != nil {
+		return fmt.Errorf("Error creating the build context store: %v", err)
+	}
+	gitCacheMaxSize, err := cli.Config.BuilderGCConfig.ParseGitCacheMaxSize()
+	if err != nil {
+		return err
+	}
+	gitCache, err := gitutils.NewCache(filepath.Join(cli.Config.Root, "builder", "git"), gitCacheMaxSize)
+	if err != nil {
+		return fmt.Errorf("Error creating the build git cache: %v", err)
+	}
+
 	cli.initMiddlewares(api, serverConfig)
-	initRouter(api, d, c)
+	initRouter(api, d, c, contexts, gitCache)
 
 	cli.d = d
 	cli.setupConfigReloadTrap()
@@ -408,7 +423,7 @@ func loadDaemonCliConfig(config *daemon.Config, flags *flag.FlagSet, commonConfi
 	return config, nil
 }
 
-func initRouter(s *apiserver.Server, d *daemon.Daemon, c *cluster.Cluster) {
+func initRouter(s *apiserver.Server, d *daemon.Daemon, c *cluster.Cluster, contexts *builder.ContextStore, gitCache *gitutils.Cache) {
 	decoder := runconfig.ContainerDecoder{}
 
 	routers := []router.Router{
@@ -416,7 +431,7 @@ func initRouter(s *apiserver.Server, d *daemon.Daemon, c *cluster.Cluster) {
 		image.NewRouter(d, decoder),
 		systemrouter.NewRouter(d, c),
 		volume.NewRouter(d),
-		build.NewRouter(dockerfile.NewBuildManager(d)),
+		build.NewRouter(dockerfile.NewBuildManager(d, contexts, gitCache)),
 		swarmrouter.NewRouter(c),
 	}
 	if d.NetworkControllerEnabled() {
@@ -278,7 +278,7 @@ func TestLoadDaemonConfigWithRegistryOptions(t *testing.T) {
 		t.Fatal("expected configuration, got nil")
 	}
 
-	m := loadedConfig.Mirrors
+	m := loadedConfig.Mirrors.Official
 	if len(m) != 1 {
 		t.Fatalf("expected 1 mirror, got %d", len(m))
 	}
@@ -292,3 +292,36 @@ func TestLoadDaemonConfigWithRegistryOptions(t *testing.T) {
 		t.Fatal("expected disable-legacy-registry to be true, got false")
 	}
 }
+
+func TestLoadDaemonConfigWithRegistryMirrorsByRegistry(t *testing.T) {
+	c := &daemon.Config{}
+	common := &cliflags.CommonFlags{}
+	flags := mflag.NewFlagSet("test", mflag.ContinueOnError)
+	c.ServiceOptions.InstallCliFlags(flags, absentFromHelp)
+
+	f, err := ioutil.TempFile("", "docker-config-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile := f.Name()
+	defer os.Remove(configFile)
+
+	f.Write([]byte(`{"registry-mirrors": {"myregistry:5000": ["https://mirror1", {"url": "https://mirror2", "insecure": true}]}}`))
+	f.Close()
+
+	loadedConfig, err := loadDaemonCliConfig(c, flags, common, configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loadedConfig == nil {
+		t.Fatal("expected configuration, got nil")
+	}
+
+	m := loadedConfig.Mirrors.Registries["myregistry:5000"]
+	if len(m) != 2 {
+		t.Fatalf("expected 2 mirrors, got %d", len(m))
+	}
+	if !m[1].Insecure {
+		t.Fatal("expected the second mirror to be insecure")
+	}
+}
@@ -3,10 +3,14 @@
 package daemon
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/docker/docker/container"
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/docker/docker/pkg/symlink"
+	"github.com/opencontainers/runc/libcontainer/user"
 )
 
 // checkIfPathIsInAVolume checks if the path is in a volume. If it is, it
@@ -25,7 +29,7 @@ func checkIfPathIsInAVolume(container *container.Container, absPath string) (boo
 	return toVolume, nil
 }
 
-func fixPermissions(source, destination string, uid, gid int, destExisted bool) error {
+func fixPermissions(source, destination string, uid, gid int, mode *os.FileMode, destExisted bool) error {
 	// If the destination didn't already exist, or the destination isn't a
 	// directory, then we should Lchown the destination. Otherwise, we shouldn't
 	// Lchown the destination.
@@ -40,11 +44,10 @@ func fixPermissions(source, destination string, uid, gid int, destExisted bool)
 	// We Walk on the source rather than on the destination because we don't
 	// want to change permissions on things we haven't created or modified.
 	return filepath.Walk(source, func(fullpath string, info os.FileInfo, err error) error {
-		// Do not alter the walk root iff. it existed before, as it doesn't fall under
-		// the domain of "things we should chown".
-		if !doChownDestination && (source == fullpath) {
-			return nil
-		}
+		// Do not chown the walk root iff. it existed before, as it doesn't fall under
+		// the domain of "things we should chown". The same goes for the mode
+		// given to COPY --chmod.
+		chown := doChownDestination || source != fullpath
 
 		// Path is prefixed by source: substitute with destination instead.
 		cleaned, err := filepath.Rel(source, fullpath)
@@ -53,6 +56,43 @@ func fixPermissions(source, destination string, uid, gid int, destExisted bool)
 		}
 
 		fullpath = filepath.Join(destination, cleaned)
-		return os.Lchown(fullpath, uid, gid)
+		if chown {
+			if err := os.Lchown(fullpath, uid, gid); err != nil {
+				return err
+			}
+		}
+		if chown && mode != nil && info.Mode()&os.ModeSymlink == 0 {
+			return os.Chmod(fullpath, *mode)
+		}
+		return nil
 	})
 }
+
+// copyOwner resolves the user and group given to COPY --chown against the
+// /etc/passwd and /etc/group files of the container, and maps them to the
+// IDs owning the files on the host.
+func (daemon *Daemon) copyOwner(c *container.Container, chown string) (int, int, error) {
+	passwdPath, err := symlink.FollowSymlinkInScope(filepath.Join(c.BaseFS, "/etc/passwd"), c.BaseFS)
+	if err != nil {
+		return 0, 0, err
+	}
+	groupPath, err := symlink.FollowSymlinkInScope(filepath.Join(c.BaseFS, "/etc/group"), c.BaseFS)
+	if err != nil {
+		return 0, 0, err
+	}
+	execUser, err := user.GetExecUserPath(chown, nil, passwdPath, groupPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to resolve --chown=%s: %v", chown, err)
+	}
+
+	uidMaps, gidMaps := daemon.GetUIDGIDMaps()
+	uid, err := idtools.ToHost(execUser.Uid, uidMaps)
+	if err != nil {
+		return 0, 0, err
+	}
+	gid, err := idtools.ToHost(execUser.Gid, gidMaps)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uid, gid, nil
+}
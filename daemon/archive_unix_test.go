@@ -0,0 +1,80 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestFixPermissionsChmodExistingDestination checks that the mode given to
+// COPY --chmod applies to the copied files, but not to an existing
+// destination directory, which was not created by the copy.
+func TestFixPermissionsChmodExistingDestination(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "fix-permissions-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	source := filepath.Join(tmpDir, "source")
+	destination := filepath.Join(tmpDir, "destination")
+	for _, dir := range []string{source, destination} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "file"), []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mode := os.FileMode(0600)
+	if err := fixPermissions(source, destination, os.Getuid(), os.Getgid(), &mode, true); err != nil {
+		t.Fatal(err)
+	}
+	for path, expected := range map[string]os.FileMode{
+		destination:                        0755,
+		filepath.Join(destination, "file"): mode,
+	} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != expected {
+			t.Fatalf("expected mode %v for %s, got %v", expected, path, fi.Mode().Perm())
+		}
+	}
+}
+
+// TestFixPermissionsChmodNewDestination checks that the mode given to COPY
+// --chmod applies to a destination directory created by the copy.
+func TestFixPermissionsChmodNewDestination(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "fix-permissions-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	source := filepath.Join(tmpDir, "source")
+	destination := filepath.Join(tmpDir, "destination")
+	for _, dir := range []string{source, destination} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mode := os.FileMode(0700)
+	if err := fixPermissions(source, destination, os.Getuid(), os.Getgid(), &mode, false); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != mode {
+		t.Fatalf("expected mode %v for %s, got %v", mode, destination, fi.Mode().Perm())
+	}
+}
@@ -1,6 +1,11 @@
 package daemon
 
-import "github.com/docker/docker/container"
+import (
+	"fmt"
+	"os"
+
+	"github.com/docker/docker/container"
+)
 
 // checkIfPathIsInAVolume checks if the path is in a volume. If it is, it
 // cannot be in a read-only volume. If it  is not in a volume, the container
@@ -12,7 +17,14 @@ func checkIfPathIsInAVolume(container *container.Container, absPath string) (boo
 	return false, nil
 }
 
-func fixPermissions(source, destination string, uid, gid int, destExisted bool) error {
-	// chown is not supported on Windows
+func fixPermissions(source, destination string, uid, gid int, mode *os.FileMode, destExisted bool) error {
+	// chown and chmod are not supported on Windows
+	if mode != nil {
+		return fmt.Errorf("--chmod is not supported on Windows")
+	}
 	return nil
 }
+
+func (daemon *Daemon) copyOwner(c *container.Container, chown string) (int, int, error) {
+	return 0, 0, fmt.Errorf("--chown is not supported on Windows")
+}
@@ -0,0 +1,518 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/container"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/pkg/ioutils"
+	"github.com/docker/docker/reference"
+	"github.com/docker/engine-api/types"
+	"github.com/docker/go-units"
+)
+
+// buildCacheGCInterval is the interval at which the build cache is saved and
+// garbage collected, in addition to after builds.
+const buildCacheGCInterval = 15 * time.Minute
+
+// noLimit is the maximum size of a build cache policy which doesn't limit
+// the size of the cache.
+const noLimit = -1
+
+// buildCachePolicy is the parsed form of BuilderGCConfig.
+type buildCachePolicy struct {
+	maxSize     int64
+	maxAge      time.Duration
+	keepStorage int64
+}
+
+// parseBuildCachePolicy parses and validates the build cache policy of
+// config.
+func parseBuildCachePolicy(config BuilderGCConfig) (buildCachePolicy, error) {
+	policy := buildCachePolicy{maxSize: noLimit, keepStorage: noLimit}
+	if config.MaxSize != "" {
+		size, err := units.RAMInBytes(config.MaxSize)
+		if err != nil || size < 0 {
+			return policy, fmt.Errorf("invalid builder cache max size: %s", config.MaxSize)
+		}
+		policy.maxSize, policy.keepStorage = size, size
+	}
+	if config.MaxAge != "" {
+		age, err := time.ParseDuration(config.MaxAge)
+		if err != nil || age <= 0 {
+			return policy, fmt.Errorf("invalid builder cache max age: %s", config.MaxAge)
+		}
+		policy.maxAge = age
+	}
+	if config.KeepStorage != "" {
+		if policy.maxSize == noLimit {
+			return policy, fmt.Errorf("builder cache keep storage requires a builder cache max size")
+		}
+		size, err := units.RAMInBytes(config.KeepStorage)
+		if err != nil || size < 0 || size > policy.maxSize {
+			return policy, fmt.Errorf("invalid builder cache keep storage: %s", config.KeepStorage)
+		}
+		policy.keepStorage = size
+	}
+	return policy, nil
+}
+
+// defaultGitCacheMaxSize is the max size of the repositories cached for the
+// Git build contexts when the configuration doesn't set one.
+const defaultGitCacheMaxSize = 5 * units.GiB
+
+// ParseGitCacheMaxSize parses and validates the max size of the repositories
+// cached for the Git build contexts of config. It is 0 if they are not
+// limited.
+func (config BuilderGCConfig) ParseGitCacheMaxSize() (int64, error) {
+	if config.GitCacheMaxSize == "" {
+		return defaultGitCacheMaxSize, nil
+	}
+	size, err := units.RAMInBytes(config.GitCacheMaxSize)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid builder git cache max size: %s", config.GitCacheMaxSize)
+	}
+	return size, nil
+}
+
+// enabled returns whether the policy requires the build cache to be garbage
+// collected.
+func (p buildCachePolicy) enabled() bool {
+	return p.maxSize != noLimit || p.maxAge > 0
+}
+
+// prunable returns the IDs of the unused entries of usage which must be
+// removed to enforce the policy at the time now: the entries unused for
+// longer than the max age, and then the least recently used ones until the
+// cache takes at most keepStorage if it exceeds the max size.
+func (p buildCachePolicy) prunable(usage *types.BuildCacheUsage, now time.Time) []string {
+	entries := make([]types.BuildCacheEntry, 0, len(usage.Entries))
+	for _, e := range usage.Entries {
+		if !e.InUse {
+			entries = append(entries, e)
+		}
+	}
+	// The entries are listed children first, which must be kept for the
+	// entries last used at the same time as their parent.
+	sort.Stable(byLastUsed(entries))
+
+	// A cache limited to 0 bytes keeps no unused image, even empty ones.
+	overSize := p.maxSize != noLimit && (usage.Size > p.maxSize || p.maxSize == 0)
+
+	var (
+		ids  []string
+		size = usage.Size
+	)
+	for _, e := range entries {
+		expired := p.maxAge > 0 && now.Sub(e.LastUsed) > p.maxAge
+		if !expired && !(overSize && (size > p.keepStorage || p.keepStorage == 0)) {
+			continue
+		}
+		ids = append(ids, e.ID)
+		size -= e.Size
+	}
+	return ids
+}
+
+type byLastUsed []types.BuildCacheEntry
+
+func (e byLastUsed) Len() int           { return len(e) }
+func (e byLastUsed) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e byLastUsed) Less(i, j int) bool { return e[i].LastUsed.Before(e[j].LastUsed) }
+
+// buildCache records when the images committed by builds were last used,
+// so that they can be garbage collected in LRU order. The record is kept in
+// memory and saved after builds, periodically and when the daemon shuts
+// down.
+type buildCache struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	path     string
+	policy   buildCachePolicy
+	lastUsed map[image.ID]time.Time
+	dirty    bool
+	// unrecorded is set if the build cache was never saved, e.g. by a
+	// daemon which didn't record it yet.
+	unrecorded bool
+	// builds is the number of builds in progress, and since the time the
+	// first of them started: the images used since then may belong to a
+	// build in progress.
+	builds  int
+	since   time.Time
+	pruning bool
+}
+
+// newBuildCache returns the build cache recorded in the file at path.
+func newBuildCache(path string, policy buildCachePolicy) (*buildCache, error) {
+	c := &buildCache{
+		path:     path,
+		policy:   policy,
+		lastUsed: make(map[image.ID]time.Time),
+	}
+	c.cond = sync.NewCond(&c.mu)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.unrecorded = true
+			return c, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &c.lastUsed); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// seed records the images of is built before the build cache was recorded,
+// as if they were used now: the images without references nor children, and
+// then their parents without references once all their children are in the
+// build cache. The record is saved so that it is seeded only once.
+func (c *buildCache) seed(is image.Store, rs reference.Store) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unrecorded {
+		return
+	}
+	c.unrecorded = false
+
+	parents := make(map[image.ID]image.ID)
+	for id, img := range is.Map() {
+		parents[id] = img.Parent
+	}
+	ids := intermediateImages(parents, func(id image.ID) bool { return len(rs.References(id)) > 0 })
+	now := time.Now().UTC()
+	for _, id := range ids {
+		c.lastUsed[id] = now
+	}
+	if err := c.save(); err != nil {
+		logrus.Errorf("Error saving the build cache: %v", err)
+		c.dirty = true
+		return
+	}
+	if len(ids) > 0 {
+		logrus.Infof("Recorded %d images built before the build cache was recorded", len(ids))
+	}
+}
+
+// intermediateImages returns the images, whose parents are parents, which
+// aren't referenced and whose children are all intermediate images too.
+func intermediateImages(parents map[image.ID]image.ID, referenced func(image.ID) bool) []image.ID {
+	children := make(map[image.ID]int, len(parents))
+	for _, p := range parents {
+		children[p]++
+	}
+	var queue, ids []image.ID
+	for id := range parents {
+		if children[id] == 0 && !referenced(id) {
+			queue = append(queue, id)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		ids = append(ids, id)
+
+		p := parents[id]
+		if _, ok := parents[p]; !ok {
+			continue
+		}
+		children[p]--
+		if children[p] == 0 && !referenced(p) {
+			queue = append(queue, p)
+		}
+	}
+	return ids
+}
+
+// save records the build cache. It must be called with the lock held.
+func (c *buildCache) save() error {
+	b, err := json.Marshal(c.lastUsed)
+	if err != nil {
+		return err
+	}
+	return ioutils.AtomicWriteFile(c.path, b, 0600)
+}
+
+// flush saves the build cache if it changed since it was last saved.
+func (c *buildCache) flush() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return
+	}
+	if err := c.save(); err != nil {
+		logrus.Errorf("Error saving the build cache: %v", err)
+		return
+	}
+	c.dirty = false
+}
+
+// touch records that the image id was committed or used by a build.
+func (c *buildCache) touch(id image.ID) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastUsed[id] = time.Now().UTC()
+	c.dirty = true
+}
+
+// usage returns the entries of the build cache, using the daemon to look up
+// their images, children first. The entries whose image was removed are
+// forgotten. An entry is last used when it, or an entry built on it, was
+// last used, and the entries built on it don't keep it in use, so that the
+// images are removed in LRU order rather than their leaves only. It must be
+// called with the lock held.
+func (c *buildCache) usage(daemon *Daemon) *types.BuildCacheUsage {
+	images := make(map[image.ID]*image.Image, len(c.lastUsed))
+	parents := make(map[image.ID]image.ID, len(c.lastUsed))
+	for id := range c.lastUsed {
+		img, err := daemon.imageStore.Get(id)
+		if err != nil {
+			delete(c.lastUsed, id)
+			c.dirty = true
+			continue
+		}
+		images[id] = img
+		parents[id] = img.Parent
+	}
+	lastUsed, depths := cacheLastUsed(c.lastUsed, parents)
+
+	ids := make([]image.ID, 0, len(images))
+	for id := range images {
+		ids = append(ids, id)
+	}
+	sort.Sort(byDepth{ids: ids, depths: depths})
+
+	usage := &types.BuildCacheUsage{Entries: []types.BuildCacheEntry{}}
+	for _, id := range ids {
+		e := types.BuildCacheEntry{
+			ID:       id.String(),
+			Size:     daemon.imageLayerSize(images[id]),
+			LastUsed: lastUsed[id],
+			InUse:    (c.builds > 0 && !lastUsed[id].Before(c.since)) || c.imageInUse(daemon, id),
+		}
+		usage.Entries = append(usage.Entries, e)
+		usage.Size += e.Size
+		if !e.InUse {
+			usage.Reclaimable += e.Size
+		}
+	}
+	return usage
+}
+
+// cacheLastUsed returns when the entries of the build cache, which were used
+// at the times of lastUsed and whose images have the parents of parents, were
+// last used themselves or through the entries built on them, along with the
+// number of entries each entry is built on.
+func cacheLastUsed(lastUsed map[image.ID]time.Time, parents map[image.ID]image.ID) (map[image.ID]time.Time, map[image.ID]int) {
+	effective := make(map[image.ID]time.Time, len(parents))
+	depths := make(map[image.ID]int, len(parents))
+	for id := range parents {
+		if lastUsed[id].After(effective[id]) {
+			effective[id] = lastUsed[id]
+		}
+		p := parents[id]
+		for {
+			if _, ok := parents[p]; !ok {
+				break
+			}
+			depths[id]++
+			if lastUsed[id].After(effective[p]) {
+				effective[p] = lastUsed[id]
+			}
+			p = parents[p]
+		}
+	}
+	return effective, depths
+}
+
+// byDepth sorts the IDs of the entries of the build cache children first.
+type byDepth struct {
+	ids    []image.ID
+	depths map[image.ID]int
+}
+
+func (s byDepth) Len() int      { return len(s.ids) }
+func (s byDepth) Swap(i, j int) { s.ids[i], s.ids[j] = s.ids[j], s.ids[i] }
+func (s byDepth) Less(i, j int) bool {
+	if s.depths[s.ids[i]] != s.depths[s.ids[j]] {
+		return s.depths[s.ids[i]] > s.depths[s.ids[j]]
+	}
+	return s.ids[i] < s.ids[j]
+}
+
+// prune removes the images of the build cache selected by policy, until
+// no more can be removed, since removing an image may make its parent
+// unused.
+func (c *buildCache) prune(daemon *Daemon, policy buildCachePolicy) *types.BuildCachePruneReport {
+	c.mu.Lock()
+	for c.pruning {
+		c.cond.Wait()
+	}
+	c.pruning = true
+	defer func() {
+		c.mu.Lock()
+		c.pruning = false
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	}()
+
+	report := &types.BuildCachePruneReport{ImagesDeleted: []string{}}
+	for {
+		usage := c.usage(daemon)
+		ids := policy.prunable(usage, time.Now().UTC())
+		// Builds don't start while the images are removed, but images
+		// may be removed while the build cache is looked up.
+		c.mu.Unlock()
+
+		sizes := make(map[string]int64)
+		for _, e := range usage.Entries {
+			sizes[e.ID] = e.Size
+		}
+		deleted := 0
+		for _, id := range ids {
+			if _, err := daemon.ImageDelete(id, false, false); err != nil {
+				logrus.Debugf("Not removing build cache image %s: %v", id, err)
+				continue
+			}
+			deleted++
+			report.ImagesDeleted = append(report.ImagesDeleted, id)
+			report.SpaceReclaimed += uint64(sizes[id])
+		}
+
+		c.mu.Lock()
+		if deleted == 0 {
+			if c.dirty {
+				if err := c.save(); err != nil {
+					logrus.Errorf("Error saving the build cache: %v", err)
+				} else {
+					c.dirty = false
+				}
+			}
+			c.mu.Unlock()
+			return report
+		}
+	}
+}
+
+// acquire records the start of a build, waiting for the build cache to be
+// pruned if it is.
+func (c *buildCache) acquire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.pruning {
+		c.cond.Wait()
+	}
+	if c.builds == 0 {
+		c.since = time.Now().UTC()
+	}
+	c.builds++
+}
+
+// release records the end of a build, and returns whether it was the last
+// build in progress.
+func (c *buildCache) release() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.builds--
+	return c.builds == 0
+}
+
+// imageInUse returns whether the image id is referenced, is the image of a
+// container or the parent of an image which is not in the build cache. It
+// must be called with the lock held.
+func (c *buildCache) imageInUse(daemon *Daemon, id image.ID) bool {
+	if len(daemon.referenceStore.References(id)) > 0 {
+		return true
+	}
+	for _, child := range daemon.imageStore.Children(id) {
+		if _, ok := c.lastUsed[child]; !ok {
+			return true
+		}
+	}
+	return daemon.containers.First(func(c *container.Container) bool {
+		return c.ImageID == id
+	}) != nil
+}
+
+// AcquireBuildCache prevents the images of the build cache used from now on
+// from being pruned until ReleaseBuildCache is called.
+func (daemon *Daemon) AcquireBuildCache() {
+	daemon.buildCache.acquire()
+}
+
+// ReleaseBuildCache releases the build cache acquired by AcquireBuildCache,
+// and saves and garbage collects it once no build is in progress.
+func (daemon *Daemon) ReleaseBuildCache() {
+	if !daemon.buildCache.release() {
+		return
+	}
+	if daemon.buildCache.policy.enabled() {
+		go daemon.buildCacheGC()
+	} else {
+		go daemon.buildCache.flush()
+	}
+}
+
+// BuildCacheUsage returns the images committed by builds and kept as a
+// cache for the next builds.
+func (daemon *Daemon) BuildCacheUsage() (*types.BuildCacheUsage, error) {
+	daemon.buildCache.mu.Lock()
+	defer daemon.buildCache.mu.Unlock()
+	return daemon.buildCache.usage(daemon), nil
+}
+
+// PruneBuildCache removes the images of the build cache which are not in
+// use, least recently used first, until the cache takes at most keepStorage
+// bytes.
+func (daemon *Daemon) PruneBuildCache(keepStorage int64) (*types.BuildCachePruneReport, error) {
+	policy := buildCachePolicy{maxSize: keepStorage, keepStorage: keepStorage}
+	return daemon.buildCache.prune(daemon, policy), nil
+}
+
+// buildCacheGC garbage collects the build cache according to the policy of
+// the daemon configuration.
+func (daemon *Daemon) buildCacheGC() {
+	report := daemon.buildCache.prune(daemon, daemon.buildCache.policy)
+	if len(report.ImagesDeleted) > 0 {
+		logrus.Infof("Removed %d build cache images, reclaiming %s", len(report.ImagesDeleted), units.HumanSize(float64(report.SpaceReclaimed)))
+	}
+}
+
+// buildCacheGCLoop periodically saves the build cache and garbage collects
+// it if the daemon configuration has a policy, to remove the images reaching
+// the max age, until stop is closed.
+func (daemon *Daemon) buildCacheGCLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(buildCacheGCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+		if daemon.buildCache.policy.enabled() {
+			daemon.buildCacheGC()
+		} else {
+			daemon.buildCache.flush()
+		}
+	}
+}
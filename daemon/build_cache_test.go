@@ -0,0 +1,136 @@
+package daemon
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/image"
+	"github.com/docker/engine-api/types"
+)
+
+func TestParseBuildCachePolicy(t *testing.T) {
+	valid := []struct {
+		config   BuilderGCConfig
+		expected buildCachePolicy
+	}{
+		{BuilderGCConfig{}, buildCachePolicy{maxSize: noLimit, keepStorage: noLimit}},
+		{BuilderGCConfig{MaxSize: "1k"}, buildCachePolicy{maxSize: 1024, keepStorage: 1024}},
+		{BuilderGCConfig{MaxSize: "1k", KeepStorage: "512b"}, buildCachePolicy{maxSize: 1024, keepStorage: 512}},
+		{BuilderGCConfig{MaxAge: "24h"}, buildCachePolicy{maxSize: noLimit, keepStorage: noLimit, maxAge: 24 * time.Hour}},
+	}
+	for _, c := range valid {
+		policy, err := parseBuildCachePolicy(c.config)
+		if err != nil {
+			t.Fatalf("Unexpected error for %+v: %v", c.config, err)
+		}
+		if policy != c.expected {
+			t.Fatalf("Expected policy %+v for %+v, got %+v", c.expected, c.config, policy)
+		}
+	}
+
+	invalid := []BuilderGCConfig{
+		{MaxSize: "lots"},
+		{MaxAge: "1w"},
+		{MaxAge: "-1h"},
+		{KeepStorage: "1k"},
+		{MaxSize: "1k", KeepStorage: "2k"},
+	}
+	for _, config := range invalid {
+		if _, err := parseBuildCachePolicy(config); err == nil {
+			t.Fatalf("Expected an error for %+v", config)
+		}
+	}
+}
+
+func TestBuildCachePolicyPrunable(t *testing.T) {
+	now := time.Now()
+	usage := &types.BuildCacheUsage{
+		Entries: []types.BuildCacheEntry{
+			{ID: "recent", Size: 100, LastUsed: now.Add(-time.Minute)},
+			{ID: "old", Size: 100, LastUsed: now.Add(-2 * time.Hour)},
+			{ID: "used", Size: 100, LastUsed: now.Add(-3 * time.Hour), InUse: true},
+			{ID: "empty", Size: 0, LastUsed: now.Add(-time.Hour)},
+		},
+		Size: 300,
+	}
+
+	cases := []struct {
+		policy   buildCachePolicy
+		expected []string
+	}{
+		{buildCachePolicy{maxSize: noLimit, keepStorage: noLimit}, nil},
+		{buildCachePolicy{maxSize: noLimit, keepStorage: noLimit, maxAge: 90 * time.Minute}, []string{"old"}},
+		{buildCachePolicy{maxSize: 300, keepStorage: 300}, nil},
+		{buildCachePolicy{maxSize: 250, keepStorage: 250}, []string{"old"}},
+		{buildCachePolicy{maxSize: 250, keepStorage: 100}, []string{"old", "empty", "recent"}},
+		{buildCachePolicy{maxSize: 0, keepStorage: 0}, []string{"old", "empty", "recent"}},
+	}
+	for _, c := range cases {
+		if actual := c.policy.prunable(usage, now); !reflect.DeepEqual(actual, c.expected) {
+			t.Fatalf("Expected %+v to prune %v, got %v", c.policy, c.expected, actual)
+		}
+	}
+}
+
+func TestCacheLastUsed(t *testing.T) {
+	now := time.Now()
+	// base <- parent <- child, and parent <- other, where base is not in
+	// the cache.
+	lastUsed := map[image.ID]time.Time{
+		"parent": now.Add(-3 * time.Hour),
+		"child":  now.Add(-time.Hour),
+		"other":  now.Add(-2 * time.Hour),
+	}
+	parents := map[image.ID]image.ID{
+		"parent": "base",
+		"child":  "parent",
+		"other":  "parent",
+	}
+
+	effective, depths := cacheLastUsed(lastUsed, parents)
+	expected := map[image.ID]time.Time{
+		"parent": now.Add(-time.Hour),
+		"child":  now.Add(-time.Hour),
+		"other":  now.Add(-2 * time.Hour),
+	}
+	if !reflect.DeepEqual(effective, expected) {
+		t.Fatalf("Expected the entries to be last used at %v, got %v", expected, effective)
+	}
+	if depths["parent"] != 0 || depths["child"] != 1 || depths["other"] != 1 {
+		t.Fatalf("Unexpected depths %v", depths)
+	}
+
+	ids := []image.ID{"parent", "other", "child"}
+	sort.Sort(byDepth{ids: ids, depths: depths})
+	if ids[2] != "parent" {
+		t.Fatalf("Expected the children to be listed first, got %v", ids)
+	}
+}
+
+func TestIntermediateImages(t *testing.T) {
+	// tagged <- base <- a <- b, base <- c <- d (tagged), e
+	parents := map[image.ID]image.ID{
+		"tagged": "",
+		"base":   "tagged",
+		"a":      "base",
+		"b":      "a",
+		"c":      "base",
+		"d":      "c",
+		"e":      "",
+	}
+	referenced := func(id image.ID) bool { return id == "tagged" || id == "d" }
+
+	ids := intermediateImages(parents, referenced)
+	sort.Sort(byID(ids))
+	if expected := []image.ID{"a", "b", "e"}; !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("Expected intermediate images %v, got %v", expected, ids)
+	}
+}
+
+type byID []image.ID
+
+func (s byID) Len() int           { return len(s) }
+func (s byID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byID) Less(i, j int) bool { return s[i] < s[j] }
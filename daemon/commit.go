@@ -149,6 +149,16 @@ func (daemon *Daemon) Commit(name string, c *backend.ContainerCommitConfig) (str
 	if err != nil {
 		return "", err
 	}
+	reproducible := !c.SourceDateEpoch.IsZero()
+	if reproducible {
+		sortedTar, err := archive.Reproducible(rwTar, c.SourceDateEpoch)
+		rwTar.Close()
+		if err != nil {
+			rwTar = nil
+			return "", err
+		}
+		rwTar = sortedTar
+	}
 	defer func() {
 		if rwTar != nil {
 			rwTar.Close()
@@ -177,9 +187,17 @@ func (daemon *Daemon) Commit(name string, c *backend.ContainerCommitConfig) (str
 	}
 	defer layer.ReleaseAndLog(daemon.layerStore, l)
 
+	created := time.Now().UTC()
+	containerID, containerConfig := container.ID, *container.Config
+	if reproducible {
+		// The ID and hostname of the container are random.
+		created = c.SourceDateEpoch.UTC()
+		containerID, containerConfig.Hostname, newConfig.Hostname = "", "", ""
+	}
+
 	h := image.History{
 		Author:     c.Author,
-		Created:    time.Now().UTC(),
+		Created:    created,
 		CreatedBy:  strings.Join(container.Config.Cmd, " "),
 		Comment:    c.Comment,
 		EmptyLayer: true,
@@ -198,8 +216,8 @@ func (daemon *Daemon) Commit(name string, c *backend.ContainerCommitConfig) (str
 			Config:          newConfig,
 			Architecture:    runtime.GOARCH,
 			OS:              runtime.GOOS,
-			Container:       container.ID,
-			ContainerConfig: *container.Config,
+			Container:       containerID,
+			ContainerConfig: containerConfig,
 			Author:          c.Author,
 			Created:         h.Created,
 		},
@@ -224,6 +242,10 @@ func (daemon *Daemon) Commit(name string, c *backend.ContainerCommitConfig) (str
 		}
 	}
 
+	if c.BuildCache {
+		daemon.buildCache.touch(id)
+	}
+
 	if c.Repo != "" {
 		newTag, err := reference.WithName(c.Repo) // todo: should move this to API layer
 		if err != nil {
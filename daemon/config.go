@@ -41,6 +41,7 @@ const (
 var flatOptions = map[string]bool{
 	"cluster-store-opts": true,
 	"log-opts":           true,
+	"registry-mirrors":   true,
 	"runtimes":           true,
 }
 
@@ -68,6 +69,25 @@ type CommonTLSOptions struct {
 	KeyFile  string `json:"tlskey,omitempty"`
 }
 
+// BuilderGCConfig defines the policy of the garbage collection of the
+// images committed by builds, which are kept as a cache for the next builds.
+// Sizes are given in a human readable form (e.g. "10GB"), and the age as a
+// duration (e.g. "168h").
+type BuilderGCConfig struct {
+	// MaxSize is the size of the build cache beyond which unused images
+	// are removed, least recently used first.
+	MaxSize string `json:"builder-cache-max-size,omitempty"`
+	// MaxAge is the time after which unused images are removed.
+	MaxAge string `json:"builder-cache-max-age,omitempty"`
+	// KeepStorage is the size the build cache is reduced to once it
+	// exceeds MaxSize. It defaults to MaxSize.
+	KeepStorage string `json:"builder-cache-keep-storage,omitempty"`
+	// GitCacheMaxSize is the size of the repositories cached for the Git
+	// build contexts beyond which the least recently used ones are
+	// removed.
+	GitCacheMaxSize string `json:"builder-git-cache-max-size,omitempty"`
+}
+
 // CommonConfig defines the configuration of a docker daemon which is
 // common across platforms.
 // It includes json tags to deserialize configuration from a file
@@ -116,6 +136,20 @@ type CommonConfig struct {
 	// may take place at a time for each push.
 	MaxConcurrentUploads *int `json:"max-concurrent-uploads,omitempty"`
 
+	// BlobCache is the directory or http(s) URL of a blob cache, shared
+	// by the daemons of several hosts, consulted before downloading
+	// layers from registries.
+	BlobCache string `json:"blob-cache,omitempty"`
+
+	// UploadChunkSize is the size of the chunks layers are pushed in, so
+	// that interrupted uploads are resumed. Layers are pushed as a single
+	// stream if it is empty.
+	UploadChunkSize string `json:"upload-chunk-size,omitempty"`
+
+	// SignaturePolicy is the path of the signature verification policy
+	// of the images pulled and run by the daemon.
+	SignaturePolicy string `json:"signature-policy,omitempty"`
+
 	Debug     bool     `json:"debug,omitempty"`
 	Hosts     []string `json:"hosts,omitempty"`
 	LogLevel  string   `json:"log-level,omitempty"`
@@ -126,6 +160,7 @@ type CommonConfig struct {
 	// deserialization without the full struct.
 	CommonTLSOptions
 	LogConfig
+	BuilderGCConfig
 	bridgeConfig // bridgeConfig holds bridge network specific configuration.
 	registry.ServiceOptions
 
@@ -162,8 +197,15 @@ func (config *Config) InstallCommonFlags(cmd *flag.FlagSet, usageFn func(string)
 	cmd.StringVar(&config.ClusterStore, []string{"-cluster-store"}, "", usageFn("Set the cluster store"))
 	cmd.Var(opts.NewNamedMapOpts("cluster-store-opts", config.ClusterOpts, nil), []string{"-cluster-store-opt"}, usageFn("Set cluster store options"))
 	cmd.StringVar(&config.CorsHeaders, []string{"-api-cors-header"}, "", usageFn("Set CORS headers in the remote API"))
+	cmd.StringVar(&config.BuilderGCConfig.MaxSize, []string{"-builder-cache-max-size"}, "", usageFn("Size of the build cache beyond which unused images are removed"))
+	cmd.StringVar(&config.BuilderGCConfig.MaxAge, []string{"-builder-cache-max-age"}, "", usageFn("Duration after which unused build cache images are removed"))
+	cmd.StringVar(&config.BuilderGCConfig.KeepStorage, []string{"-builder-cache-keep-storage"}, "", usageFn("Size the build cache is reduced to once it exceeds its max size"))
+	cmd.StringVar(&config.BuilderGCConfig.GitCacheMaxSize, []string{"-builder-git-cache-max-size"}, "", usageFn("Size of the repositories cached for Git build contexts beyond which unused ones are removed"))
 	cmd.IntVar(&maxConcurrentDownloads, []string{"-max-concurrent-downloads"}, defaultMaxConcurrentDownloads, usageFn("Set the max concurrent downloads for each pull"))
 	cmd.IntVar(&maxConcurrentUploads, []string{"-max-concurrent-uploads"}, defaultMaxConcurrentUploads, usageFn("Set the max concurrent uploads for each push"))
+	cmd.StringVar(&config.BlobCache, []string{"-blob-cache"}, "", usageFn("Directory or http(s) URL of a blob cache shared by daemons"))
+	cmd.StringVar(&config.UploadChunkSize, []string{"-upload-chunk-size"}, "", usageFn("Size of the chunks layers are pushed in, to resume interrupted uploads"))
+	cmd.StringVar(&config.SignaturePolicy, []string{"-signature-policy"}, "", usageFn("Path of the image signature verification policy"))
 
 	config.MaxConcurrentDownloads = &maxConcurrentDownloads
 	config.MaxConcurrentUploads = &maxConcurrentUploads
@@ -424,6 +466,19 @@ func ValidateConfiguration(config *Config) error {
 		return fmt.Errorf("invalid max concurrent uploads: %d", *config.MaxConcurrentUploads)
 	}
 
+	// validate UploadChunkSize
+	if _, err := parseUploadChunkSize(config.UploadChunkSize); err != nil {
+		return err
+	}
+
+	// validate the build cache policy
+	if _, err := parseBuildCachePolicy(config.BuilderGCConfig); err != nil {
+		return err
+	}
+	if _, err := config.BuilderGCConfig.ParseGitCacheMaxSize(); err != nil {
+		return err
+	}
+
 	// validate that "default" runtime is not reset
 	if runtimes := config.GetAllRuntimes(); len(runtimes) > 0 {
 		if _, ok := runtimes[types.DefaultRuntimeName]; ok {
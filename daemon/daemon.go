@@ -26,11 +26,14 @@ import (
 	"github.com/docker/docker/container"
 	"github.com/docker/docker/daemon/events"
 	"github.com/docker/docker/daemon/exec"
+	"github.com/docker/docker/daemon/trust"
 	"github.com/docker/engine-api/types"
 	containertypes "github.com/docker/engine-api/types/container"
 	"github.com/docker/libnetwork/cluster"
 	// register graph drivers
 	_ "github.com/docker/docker/daemon/graphdriver/register"
+	"github.com/docker/docker/distribution"
+	"github.com/docker/docker/distribution/blobcache"
 	dmetadata "github.com/docker/docker/distribution/metadata"
 	"github.com/docker/docker/distribution/xfer"
 	"github.com/docker/docker/image"
@@ -67,6 +70,10 @@ var (
 	errSystemNotSupported = fmt.Errorf("The Docker daemon is not supported on this platform.")
 )
 
+// partialDownloadMaxAge is the time after which the partial layer downloads
+// which were not resumed are removed when the daemon starts.
+const partialDownloadMaxAge = 7 * 24 * time.Hour
+
 // Daemon holds information about the Docker daemon.
 type Daemon struct {
 	ID                        string
@@ -77,6 +84,8 @@ type Daemon struct {
 	downloadManager           *xfer.LayerDownloadManager
 	uploadManager             *xfer.LayerUploadManager
 	distributionMetadataStore dmetadata.Store
+	downloadRoot              string
+	trustVerifier             *trust.Verifier
 	trustKey                  libtrust.PrivateKey
 	idIndex                   *truncindex.TruncIndex
 	configStore               *Config
@@ -94,6 +103,8 @@ type Daemon struct {
 	gidMaps                   []idtools.IDMap
 	layerStore                layer.Store
 	imageStore                image.Store
+	buildCache                *buildCache
+	buildCacheStop            chan struct{}
 	nameIndex                 *registrar.Registrar
 	linkIndex                 *linkIndex
 	containerd                libcontainerd.Client
@@ -496,6 +507,14 @@ func NewDaemon(config *Config, registryService registry.Service, containerdRemot
 
 	logrus.Debugf("Max Concurrent Downloads: %d", *config.MaxConcurrentDownloads)
 	d.downloadManager = xfer.NewLayerDownloadManager(d.layerStore, *config.MaxConcurrentDownloads)
+	if config.BlobCache != "" {
+		cache, err := blobcache.New(config.BlobCache)
+		if err != nil {
+			return nil, err
+		}
+		logrus.Debugf("Blob cache: %s", config.BlobCache)
+		d.downloadManager.SetBlobCache(cache)
+	}
 	logrus.Debugf("Max Concurrent Uploads: %d", *config.MaxConcurrentUploads)
 	d.uploadManager = xfer.NewLayerUploadManager(*config.MaxConcurrentUploads)
 
@@ -531,6 +550,13 @@ func NewDaemon(config *Config, registryService registry.Service, containerdRemot
 		return nil, err
 	}
 
+	// The partial layer downloads are kept across restarts, until they
+	// are resumed or expire.
+	downloadRoot := filepath.Join(imageRoot, "downloads")
+	if err := distribution.CleanupPartialDownloads(downloadRoot, partialDownloadMaxAge); err != nil {
+		logrus.Warnf("Failed to clean up partial downloads: %v", err)
+	}
+
 	eventsService := events.New()
 
 	referenceStore, err := reference.NewReferenceStore(filepath.Join(imageRoot, "repositories.json"))
@@ -538,6 +564,15 @@ func NewDaemon(config *Config, registryService registry.Service, containerdRemot
 		return nil, fmt.Errorf("Couldn't create Tag store repositories: %s", err)
 	}
 
+	buildCachePolicy, err := parseBuildCachePolicy(config.BuilderGCConfig)
+	if err != nil {
+		return nil, err
+	}
+	d.buildCache, err = newBuildCache(filepath.Join(config.Root, "builder", "cache.json"), buildCachePolicy)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := restoreCustomImage(d.imageStore, d.layerStore, referenceStore); err != nil {
 		return nil, fmt.Errorf("Couldn't restore custom images: %s", err)
 	}
@@ -567,6 +602,7 @@ func NewDaemon(config *Config, registryService registry.Service, containerdRemot
 	d.execCommands = exec.NewStore()
 	d.referenceStore = referenceStore
 	d.distributionMetadataStore = distributionMetadataStore
+	d.downloadRoot = downloadRoot
 	d.trustKey = trustKey
 	d.idIndex = truncindex.NewTruncIndex([]string{})
 	d.statsCollector = d.newStatsCollector(1 * time.Second)
@@ -575,6 +611,13 @@ func NewDaemon(config *Config, registryService registry.Service, containerdRemot
 		Config: config.LogConfig.Config,
 	}
 	d.RegistryService = registryService
+	if config.SignaturePolicy != "" {
+		policy, err := trust.LoadPolicy(config.SignaturePolicy)
+		if err != nil {
+			return nil, err
+		}
+		d.trustVerifier = trust.NewVerifier(policy, trustDir, registryService)
+	}
 	d.EventsService = eventsService
 	d.volumes = volStore
 	d.root = config.Root
@@ -597,6 +640,10 @@ func NewDaemon(config *Config, registryService registry.Service, containerdRemot
 		return nil, err
 	}
 
+	d.buildCache.seed(d.imageStore, d.referenceStore)
+	d.buildCacheStop = make(chan struct{})
+	go d.buildCacheGCLoop(d.buildCacheStop)
+
 	return d, nil
 }
 
@@ -642,6 +689,10 @@ func (daemon *Daemon) shutdownContainer(c *container.Container) error {
 // Shutdown stops the daemon.
 func (daemon *Daemon) Shutdown() error {
 	daemon.shutdown = true
+	if daemon.buildCacheStop != nil {
+		close(daemon.buildCacheStop)
+	}
+	daemon.buildCache.flush()
 	// Keep mounts and networking running on daemon shutdown if
 	// we are to keep containers running and restore them.
 	if daemon.configStore.LiveRestore {
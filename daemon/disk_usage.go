@@ -0,0 +1,114 @@
+package daemon
+
+import (
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/directory"
+	"github.com/docker/docker/volume"
+	"github.com/docker/engine-api/types"
+)
+
+// SystemDiskUsage returns the disk space used by the images, containers,
+// volumes and build cache of the daemon. The layers of the images listed
+// are counted as shared when more than one of them uses it.
+func (daemon *Daemon) SystemDiskUsage() (*types.DiskUsage, error) {
+	containers, err := daemon.Containers(&types.ContainerListOptions{All: true, Size: true})
+	if err != nil {
+		return nil, err
+	}
+	imageContainers := make(map[string]int64)
+	for _, c := range containers {
+		imageContainers[c.ImageID]++
+	}
+
+	images, err := daemon.Images("", "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	// The size of each layer is computed once, and the layers used by
+	// more than one of the images listed are shared.
+	allImages := daemon.imageStore.Map()
+	layerSizes := make(map[layer.ChainID]int64)
+	for _, img := range allImages {
+		for _, chainID := range layerChainIDs(img) {
+			if _, ok := layerSizes[chainID]; !ok {
+				layerSizes[chainID] = daemon.layerDiffSize(chainID)
+			}
+		}
+	}
+	layerRefs := make(map[layer.ChainID]int)
+	for _, i := range images {
+		if img, ok := allImages[image.ID(i.ID)]; ok {
+			for _, chainID := range layerChainIDs(img) {
+				layerRefs[chainID]++
+			}
+		}
+	}
+
+	du := &types.DiskUsage{
+		Images:     images,
+		Containers: containers,
+		Volumes:    []*types.Volume{},
+	}
+	for _, size := range layerSizes {
+		du.LayersSize += size
+	}
+	for _, i := range images {
+		i.Containers = imageContainers[i.ID]
+		if img, ok := allImages[image.ID(i.ID)]; ok {
+			for _, chainID := range layerChainIDs(img) {
+				if layerRefs[chainID] > 1 {
+					i.SharedSize += layerSizes[chainID]
+				}
+			}
+		}
+	}
+
+	vols, _, err := daemon.volumes.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vols {
+		apiV := volumeToAPIType(v)
+		apiV.Mountpoint = v.Path()
+		apiV.UsageData = &types.VolumeUsageData{Size: -1, RefCount: len(daemon.volumes.Refs(v))}
+		if v.DriverName() == volume.DefaultDriverName {
+			if size, err := directory.Size(v.Path()); err == nil {
+				apiV.UsageData.Size = size
+			}
+		}
+		du.Volumes = append(du.Volumes, apiV)
+	}
+
+	du.BuildCache, err = daemon.BuildCacheUsage()
+	if err != nil {
+		return nil, err
+	}
+	return du, nil
+}
+
+// layerChainIDs returns the chain IDs of the layers of img, from the bottom
+// one to the top one.
+func layerChainIDs(img *image.Image) []layer.ChainID {
+	chainIDs := make([]layer.ChainID, len(img.RootFS.DiffIDs))
+	for i := range img.RootFS.DiffIDs {
+		chainIDs[i] = layer.CreateChainID(img.RootFS.DiffIDs[:i+1])
+	}
+	return chainIDs
+}
+
+// layerDiffSize returns the size of the changes of the layer chainID, or 0
+// if it can't be computed.
+func (daemon *Daemon) layerDiffSize(chainID layer.ChainID) int64 {
+	l, err := daemon.layerStore.Get(chainID)
+	if err != nil {
+		return 0
+	}
+	defer layer.ReleaseAndLog(daemon.layerStore, l)
+	size, err := l.DiffSize()
+	if err != nil {
+		return 0
+	}
+	return size
+}
@@ -0,0 +1,31 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+)
+
+func TestLayerChainIDs(t *testing.T) {
+	diffIDs := []layer.DiffID{
+		layer.DiffID("sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4"),
+		layer.DiffID("sha256:86e0e091d0da6bde2456dbb48306f3956bbeb2eae1b5b9a43045843f69fe4aaa"),
+	}
+	img := &image.Image{RootFS: &image.RootFS{Type: "layers", DiffIDs: diffIDs}}
+
+	chainIDs := layerChainIDs(img)
+	if len(chainIDs) != len(diffIDs) {
+		t.Fatalf("Expected %d chain IDs, got %d", len(diffIDs), len(chainIDs))
+	}
+	if chainIDs[0] != layer.ChainID(diffIDs[0]) {
+		t.Fatalf("Expected the bottom chain ID to be %s, got %s", diffIDs[0], chainIDs[0])
+	}
+	if chainIDs[1] != img.RootFS.ChainID() {
+		t.Fatalf("Expected the top chain ID to be %s, got %s", img.RootFS.ChainID(), chainIDs[1])
+	}
+
+	if chainIDs := layerChainIDs(&image.Image{RootFS: image.NewRootFS()}); len(chainIDs) != 0 {
+		t.Fatalf("Expected no chain ID for an empty image, got %v", chainIDs)
+	}
+}
@@ -64,11 +64,16 @@ func (daemon *Daemon) GetImage(refOrID string) (*image.Image, error) {
 }
 
 // GetImageOnBuild looks up a Docker image referenced by `name`.
+// The image is verified against the signature policy, since it is the base
+// image of a build.
 func (daemon *Daemon) GetImageOnBuild(name string) (builder.Image, error) {
 	img, err := daemon.GetImage(name)
 	if err != nil {
 		return nil, err
 	}
+	if err := daemon.verifyImageSignature(name, img.ID()); err != nil {
+		return nil, err
+	}
 	return img, nil
 }
 
@@ -120,5 +125,6 @@ func (daemon *Daemon) GetCachedImageOnBuild(imgID string, cfg *containertypes.Co
 	if cache == nil || err != nil {
 		return "", err
 	}
+	daemon.buildCache.touch(cache.ID())
 	return cache.ID().String(), nil
 }
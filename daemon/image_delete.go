@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/docker/docker/container"
+	"github.com/docker/docker/distribution/metadata"
 	"github.com/docker/docker/errors"
 	"github.com/docker/docker/image"
 	"github.com/docker/docker/pkg/stringid"
@@ -288,6 +289,8 @@ func (daemon *Daemon) imageDeleteHelper(imgID image.ID, records *[]types.ImageDe
 	if err != nil {
 		return err
 	}
+	// The image may not have been pulled from a manifest list.
+	metadata.NewPlatformService(daemon.distributionMetadataStore).Delete(imgID)
 
 	daemon.LogImageEvent(imgID.String(), imgID.String(), "delete")
 	*records = append(*records, types.ImageDelete{Deleted: imgID.String()})
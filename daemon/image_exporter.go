@@ -1,24 +1,35 @@
 package daemon
 
 import (
+	"fmt"
 	"io"
 
+	"github.com/docker/docker/image"
 	"github.com/docker/docker/image/tarexport"
 )
 
 // ExportImage exports a list of images to the given output stream. The
 // exported images are archived into a tar when written to the output
 // stream. All images with the given tag and all versions containing
-// the same tag are exported. names is the set of tags to export, and
-// outStream is the writer which the images are written to.
-func (daemon *Daemon) ExportImage(names []string, outStream io.Writer) error {
-	imageExporter := tarexport.NewTarExporter(daemon.imageStore, daemon.layerStore, daemon.referenceStore, daemon)
+// the same tag are exported. names is the set of tags to export, format
+// the format of the archive, "docker" (the default) or "oci" for an OCI
+// image layout, and outStream is the writer which the images are written to.
+func (daemon *Daemon) ExportImage(names []string, format string, outStream io.Writer) error {
+	var imageExporter image.Exporter
+	switch format {
+	case "", "docker":
+		imageExporter = tarexport.NewTarExporter(daemon.imageStore, daemon.layerStore, daemon.referenceStore, daemon)
+	case "oci":
+		imageExporter = tarexport.NewOCIExporter(daemon.imageStore, daemon.layerStore, daemon.referenceStore, daemon)
+	default:
+		return fmt.Errorf("invalid image archive format: %q", format)
+	}
 	return imageExporter.Save(names, outStream)
 }
 
 // LoadImage uploads a set of images into the repository. This is the
-// complement of ImageExport.  The input stream is an uncompressed tar
-// ball containing images and metadata.
+// complement of ImageExport.  The input stream is a tar ball containing
+// images and metadata, or an OCI image layout.
 func (daemon *Daemon) LoadImage(inTar io.ReadCloser, outStream io.Writer, quiet bool) error {
 	imageExporter := tarexport.NewTarExporter(daemon.imageStore, daemon.layerStore, daemon.referenceStore, daemon)
 	return imageExporter.Load(inTar, outStream, quiet)
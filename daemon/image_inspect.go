@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/docker/docker/distribution/metadata"
 	"github.com/docker/docker/layer"
 	"github.com/docker/docker/reference"
 	"github.com/docker/engine-api/types"
@@ -73,6 +74,15 @@ func (daemon *Daemon) LookupImage(name string) (*types.ImageInspect, error) {
 		RootFS:          rootFSToAPIType(img.RootFS),
 	}
 
+	if p, err := metadata.NewPlatformService(daemon.distributionMetadataStore).Get(img.ID()); err == nil {
+		imageInspect.Platform = &types.ImagePlatform{
+			Architecture: p.Architecture,
+			OS:           p.OS,
+			OSVersion:    p.OSVersion,
+			Variant:      p.Variant,
+		}
+	}
+
 	imageInspect.GraphDriver.Name = daemon.GraphDriverName()
 
 	imageInspect.GraphDriver.Data = layerMetadata
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
 	"github.com/docker/docker/builder"
 	"github.com/docker/docker/distribution"
 	"github.com/docker/docker/pkg/progress"
@@ -15,8 +16,10 @@ import (
 )
 
 // PullImage initiates a pull operation. image is the repository name to pull, and
-// tag may be either empty, or indicate a specific tag to pull.
-func (daemon *Daemon) PullImage(ctx context.Context, image, tag string, metaHeaders map[string][]string, authConfig *types.AuthConfig, outStream io.Writer) error {
+// tag may be either empty, or indicate a specific tag to pull. platform is the
+// os/architecture[/variant] the entry of manifest lists is selected for, the
+// platform of the daemon if empty.
+func (daemon *Daemon) PullImage(ctx context.Context, image, tag, platform string, metaHeaders map[string][]string, authConfig *types.AuthConfig, outStream io.Writer) error {
 	// Special case: "pull -a" may send an image name with a
 	// trailing :. This is ugly, but let's not break API
 	// compatibility.
@@ -41,7 +44,16 @@ func (daemon *Daemon) PullImage(ctx context.Context, image, tag string, metaHead
 		}
 	}
 
-	return daemon.pullImageWithReference(ctx, ref, metaHeaders, authConfig, outStream)
+	var pullPlatform *manifestlist.PlatformSpec
+	if platform != "" {
+		p, err := distribution.ParsePlatform(platform)
+		if err != nil {
+			return err
+		}
+		pullPlatform = &p
+	}
+
+	return daemon.pullImageWithReference(ctx, ref, pullPlatform, metaHeaders, authConfig, outStream)
 }
 
 // PullOnBuild tells Docker to pull image referenced by `name`.
@@ -67,13 +79,24 @@ func (daemon *Daemon) PullOnBuild(ctx context.Context, name string, authConfigs
 		pullRegistryAuth = &resolvedConfig
 	}
 
-	if err := daemon.pullImageWithReference(ctx, ref, nil, pullRegistryAuth, output); err != nil {
+	if err := daemon.pullImageWithReference(ctx, ref, nil, nil, pullRegistryAuth, output); err != nil {
 		return nil, err
 	}
 	return daemon.GetImage(name)
 }
 
-func (daemon *Daemon) pullImageWithReference(ctx context.Context, ref reference.Named, metaHeaders map[string][]string, authConfig *types.AuthConfig, outStream io.Writer) error {
+func (daemon *Daemon) pullImageWithReference(ctx context.Context, ref reference.Named, platform *manifestlist.PlatformSpec, metaHeaders map[string][]string, authConfig *types.AuthConfig, outStream io.Writer) error {
+	// The images of the repositories the signature policy requires to be
+	// signed are pulled by their signed digest.
+	var trustedRef reference.Canonical
+	if daemon.trustVerifier != nil {
+		var err error
+		trustedRef, err = daemon.trustVerifier.VerifyPull(ctx, ref, authConfig)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Include a buffer so that slow client connections don't affect
 	// transfer performance.
 	progressChan := make(chan progress.Progress, 100)
@@ -97,10 +120,36 @@ func (daemon *Daemon) pullImageWithReference(ctx context.Context, ref reference.
 		ImageStore:       daemon.imageStore,
 		ReferenceStore:   daemon.referenceStore,
 		DownloadManager:  daemon.downloadManager,
+		Platform:         platform,
+		DownloadDir:      daemon.downloadRoot,
 	}
 
-	err := distribution.Pull(ctx, ref, imagePullConfig)
+	var err error
+	if trustedRef == nil {
+		err = distribution.Pull(ctx, ref, imagePullConfig)
+	} else {
+		err = daemon.pullTrustedReference(ctx, ref, trustedRef, imagePullConfig)
+	}
 	close(progressChan)
 	<-writesDone
 	return err
 }
+
+// pullTrustedReference pulls the image of ref by its signed digest trustedRef,
+// and tags it with ref if ref is tagged.
+func (daemon *Daemon) pullTrustedReference(ctx context.Context, ref reference.Named, trustedRef reference.Canonical, imagePullConfig *distribution.ImagePullConfig) error {
+	if err := distribution.Pull(ctx, trustedRef, imagePullConfig); err != nil {
+		return err
+	}
+	tagged, ok := ref.(reference.NamedTagged)
+	if !ok {
+		return nil
+	}
+
+	imageID, err := daemon.referenceStore.Get(trustedRef)
+	if err != nil {
+		return err
+	}
+	progress.Messagef(imagePullConfig.ProgressOutput, "", "Tagging %s as %s", trustedRef.String(), tagged.String())
+	return daemon.TagImageWithReference(imageID, tagged)
+}
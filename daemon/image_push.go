@@ -1,12 +1,14 @@
 package daemon
 
 import (
+	"fmt"
 	"io"
 
 	"github.com/docker/docker/distribution"
 	"github.com/docker/docker/pkg/progress"
 	"github.com/docker/docker/reference"
 	"github.com/docker/engine-api/types"
+	"github.com/docker/go-units"
 	"golang.org/x/net/context"
 )
 
@@ -24,6 +26,11 @@ func (daemon *Daemon) PushImage(ctx context.Context, image, tag string, metaHead
 		}
 	}
 
+	uploadChunkSize, err := parseUploadChunkSize(daemon.configStore.UploadChunkSize)
+	if err != nil {
+		return err
+	}
+
 	// Include a buffer so that slow client connections don't affect
 	// transfer performance.
 	progressChan := make(chan progress.Progress, 100)
@@ -49,6 +56,7 @@ func (daemon *Daemon) PushImage(ctx context.Context, image, tag string, metaHead
 		ReferenceStore:   daemon.referenceStore,
 		TrustKey:         daemon.trustKey,
 		UploadManager:    daemon.uploadManager,
+		UploadChunkSize:  uploadChunkSize,
 	}
 
 	err = distribution.Push(ctx, ref, imagePushConfig)
@@ -56,3 +64,16 @@ func (daemon *Daemon) PushImage(ctx context.Context, image, tag string, metaHead
 	<-writesDone
 	return err
 }
+
+// parseUploadChunkSize parses the upload chunk size of the daemon
+// configuration, which is 0 if it is empty.
+func parseUploadChunkSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	size, err := units.RAMInBytes(s)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid upload chunk size: %s", s)
+	}
+	return size, nil
+}
@@ -0,0 +1,26 @@
+package daemon
+
+import (
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/reference"
+	"golang.org/x/net/context"
+)
+
+// verifyImageSignature verifies the image imageName, whose ID is imgID,
+// against the signature policy of the daemon, before creating a container
+// from it.
+func (daemon *Daemon) verifyImageSignature(imageName string, imgID image.ID) error {
+	if daemon.trustVerifier == nil {
+		return nil
+	}
+
+	// imageName is only the reference of the image if it resolves to it,
+	// rather than being an ID.
+	var name reference.Named
+	if ref, err := reference.ParseNamed(imageName); err == nil {
+		if id, err := daemon.referenceStore.Get(reference.WithDefaultTag(ref)); err == nil && id == imgID {
+			name = ref
+		}
+	}
+	return daemon.trustVerifier.VerifyImage(context.Background(), name, daemon.referenceStore.References(imgID))
+}
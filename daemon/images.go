@@ -191,3 +191,14 @@ func newImage(image *image.Image, size int64) *types.Image {
 	}
 	return newImage
 }
+
+// imageLayerSize returns the size of the layer img adds to its parent.
+func (daemon *Daemon) imageLayerSize(img *image.Image) int64 {
+	if len(img.RootFS.DiffIDs) == 0 {
+		return 0
+	}
+	if len(img.History) > 0 && img.History[len(img.History)-1].EmptyLayer {
+		return 0
+	}
+	return daemon.layerDiffSize(img.RootFS.ChainID())
+}
@@ -0,0 +1,246 @@
+package daemon
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/pkg/directory"
+	"github.com/docker/docker/reference"
+	"github.com/docker/docker/runconfig"
+	"github.com/docker/docker/volume"
+	"github.com/docker/engine-api/types"
+	"github.com/docker/engine-api/types/filters"
+	timetypes "github.com/docker/engine-api/types/time"
+	"github.com/docker/libnetwork"
+)
+
+var (
+	acceptedContainersPruneFilters = map[string]bool{"label": true, "until": true}
+	acceptedImagesPruneFilters     = map[string]bool{"dangling": true, "label": true, "until": true}
+	acceptedVolumesPruneFilters    = map[string]bool{"label": true}
+	acceptedNetworksPruneFilters   = map[string]bool{"label": true}
+)
+
+// ContainersPrune removes the containers which are not running and match
+// pruneFilters, and returns them with the size of their writable layer.
+func (daemon *Daemon) ContainersPrune(pruneFilters filters.Args) (*types.ContainersPruneReport, error) {
+	if err := pruneFilters.Validate(acceptedContainersPruneFilters); err != nil {
+		return nil, err
+	}
+	until, err := getUntilFromPruneFilters(pruneFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &types.ContainersPruneReport{ContainersDeleted: []string{}}
+	for _, c := range daemon.List() {
+		if c.IsRunning() || c.IsRestarting() {
+			continue
+		}
+		if !until.IsZero() && !c.Created.Before(until) {
+			continue
+		}
+		if !pruneFilters.MatchKVList("label", c.Config.Labels) {
+			continue
+		}
+		sizeRw, _ := daemon.getSize(c)
+		if err := daemon.ContainerRm(c.ID, &types.ContainerRmConfig{}); err != nil {
+			logrus.Warnf("Failed to prune container %s: %v", c.ID, err)
+			continue
+		}
+		if sizeRw > 0 {
+			rep.SpaceReclaimed += uint64(sizeRw)
+		}
+		rep.ContainersDeleted = append(rep.ContainersDeleted, c.ID)
+	}
+	return rep, nil
+}
+
+// ImagesPrune removes the images which match pruneFilters and aren't used
+// by a container: only the dangling ones, unless the dangling filter is
+// false, in which case the tagged images are removed as well. The parents
+// the removed images leave dangling are removed too.
+func (daemon *Daemon) ImagesPrune(pruneFilters filters.Args) (*types.ImagesPruneReport, error) {
+	if err := pruneFilters.Validate(acceptedImagesPruneFilters); err != nil {
+		return nil, err
+	}
+	danglingOnly := true
+	if pruneFilters.Include("dangling") {
+		if pruneFilters.ExactMatch("dangling", "false") || pruneFilters.ExactMatch("dangling", "0") {
+			danglingOnly = false
+		} else if !pruneFilters.ExactMatch("dangling", "true") && !pruneFilters.ExactMatch("dangling", "1") {
+			return nil, fmt.Errorf("Invalid filter 'dangling=%s'", pruneFilters.Get("dangling"))
+		}
+	}
+	until, err := getUntilFromPruneFilters(pruneFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	usedImages := make(map[image.ID]bool)
+	for _, c := range daemon.List() {
+		usedImages[c.ImageID] = true
+	}
+
+	// The layers of the removed images are released, so their size is
+	// computed beforehand.
+	allImages := daemon.imageStore.Map()
+	sizes := make(map[string]int64)
+	for id, img := range allImages {
+		sizes[id.String()] = daemon.imageLayerSize(img)
+	}
+
+	rep := &types.ImagesPruneReport{ImagesDeleted: []types.ImageDelete{}}
+	for id, img := range allImages {
+		if usedImages[id] {
+			continue
+		}
+		// The image may have been removed along with one of its children.
+		if _, err := daemon.imageStore.Get(id); err != nil {
+			continue
+		}
+		if !until.IsZero() && !img.Created.Before(until) {
+			continue
+		}
+		var labels map[string]string
+		if img.Config != nil {
+			labels = img.Config.Labels
+		}
+		if !pruneFilters.MatchKVList("label", labels) {
+			continue
+		}
+
+		refs := daemon.referenceStore.References(id)
+		if len(refs) == 0 {
+			// The intermediate images are removed along with their
+			// children.
+			if !daemon.imageIsDangling(id) {
+				continue
+			}
+			deleted, err := daemon.ImageDelete(id.String(), false, true)
+			if err != nil {
+				logrus.Warnf("Failed to prune image %s: %v", id, err)
+				continue
+			}
+			rep.ImagesDeleted = append(rep.ImagesDeleted, deleted...)
+			continue
+		}
+
+		if danglingOnly {
+			// Images only referenced by digest are untagged.
+			tagged := false
+			for _, ref := range refs {
+				if _, ok := ref.(reference.NamedTagged); ok {
+					tagged = true
+					break
+				}
+			}
+			if tagged {
+				continue
+			}
+		}
+		for _, ref := range refs {
+			deleted, err := daemon.ImageDelete(ref.String(), false, true)
+			if err != nil {
+				logrus.Warnf("Failed to prune image %s: %v", ref, err)
+				continue
+			}
+			rep.ImagesDeleted = append(rep.ImagesDeleted, deleted...)
+		}
+	}
+
+	for _, d := range rep.ImagesDeleted {
+		if d.Deleted != "" && sizes[d.Deleted] > 0 {
+			rep.SpaceReclaimed += uint64(sizes[d.Deleted])
+		}
+	}
+	return rep, nil
+}
+
+// VolumesPrune removes the volumes which aren't used by a container and
+// match pruneFilters. The space reclaimed is only known for the volumes of
+// the local driver.
+func (daemon *Daemon) VolumesPrune(pruneFilters filters.Args) (*types.VolumesPruneReport, error) {
+	if err := pruneFilters.Validate(acceptedVolumesPruneFilters); err != nil {
+		return nil, err
+	}
+
+	vols, _, err := daemon.volumes.List()
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &types.VolumesPruneReport{VolumesDeleted: []string{}}
+	for _, v := range daemon.volumes.FilterByUsed(vols, false) {
+		var labels map[string]string
+		if lv, ok := v.(volume.LabeledVolume); ok {
+			labels = lv.Labels()
+		}
+		if !pruneFilters.MatchKVList("label", labels) {
+			continue
+		}
+		var size int64
+		if v.DriverName() == volume.DefaultDriverName {
+			size, _ = directory.Size(v.Path())
+		}
+		if err := daemon.VolumeRm(v.Name()); err != nil {
+			logrus.Warnf("Failed to prune volume %s: %v", v.Name(), err)
+			continue
+		}
+		if size > 0 {
+			rep.SpaceReclaimed += uint64(size)
+		}
+		rep.VolumesDeleted = append(rep.VolumesDeleted, v.Name())
+	}
+	return rep, nil
+}
+
+// NetworksPrune removes the networks which aren't predefined or managed by
+// the swarm, have no endpoint and match pruneFilters.
+func (daemon *Daemon) NetworksPrune(pruneFilters filters.Args) (*types.NetworksPruneReport, error) {
+	if err := pruneFilters.Validate(acceptedNetworksPruneFilters); err != nil {
+		return nil, err
+	}
+
+	rep := &types.NetworksPruneReport{NetworksDeleted: []string{}}
+	daemon.netController.WalkNetworks(func(nw libnetwork.Network) bool {
+		if runconfig.IsPreDefinedNetwork(nw.Name()) || nw.Info().Dynamic() || len(nw.Endpoints()) > 0 {
+			return false
+		}
+		if !pruneFilters.MatchKVList("label", nw.Info().Labels()) {
+			return false
+		}
+		if err := daemon.DeleteNetwork(nw.ID()); err != nil {
+			logrus.Warnf("Failed to prune network %s: %v", nw.Name(), err)
+			return false
+		}
+		rep.NetworksDeleted = append(rep.NetworksDeleted, nw.Name())
+		return false
+	})
+	return rep, nil
+}
+
+// getUntilFromPruneFilters returns the time given by the until filter,
+// either a timestamp or a duration before now, or the zero time if the
+// filter isn't set.
+func getUntilFromPruneFilters(pruneFilters filters.Args) (time.Time, error) {
+	var until time.Time
+	if !pruneFilters.Include("until") {
+		return until, nil
+	}
+	values := pruneFilters.Get("until")
+	if len(values) > 1 {
+		return until, fmt.Errorf("more than one until filter specified")
+	}
+	ts, err := timetypes.GetTimestamp(values[0], time.Now())
+	if err != nil {
+		return until, err
+	}
+	seconds, nanoseconds, err := timetypes.ParseTimestamps(ts, 0)
+	if err != nil {
+		return until, err
+	}
+	return time.Unix(seconds, nanoseconds), nil
+}
@@ -0,0 +1,40 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/engine-api/types/filters"
+)
+
+func TestGetUntilFromPruneFilters(t *testing.T) {
+	until, err := getUntilFromPruneFilters(filters.NewArgs())
+	if err != nil || !until.IsZero() {
+		t.Fatalf("Expected no until time, got %v, %v", until, err)
+	}
+
+	args := filters.NewArgs()
+	args.Add("until", "1h")
+	until, err = getUntilFromPruneFilters(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Now().Add(-time.Hour); until.Sub(expected) > time.Minute || expected.Sub(until) > time.Minute {
+		t.Fatalf("Expected until to be about %v, got %v", expected, until)
+	}
+
+	args = filters.NewArgs()
+	args.Add("until", "2016-09-01T10:00:00Z")
+	until, err = getUntilFromPruneFilters(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2016, 9, 1, 10, 0, 0, 0, time.UTC); !until.Equal(expected) {
+		t.Fatalf("Expected until to be %v, got %v", expected, until)
+	}
+
+	args.Add("until", "1h")
+	if _, err := getUntilFromPruneFilters(args); err == nil {
+		t.Fatal("Expected an error for several until filters")
+	}
+}
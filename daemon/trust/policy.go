@@ -0,0 +1,152 @@
+// Package trust implements the image signature verification policy which the
+// daemon enforces when pulling images and creating containers, whatever the
+// content trust settings of the clients. The policy has a rule for each
+// registry, namespace or repository, which accepts all its images, rejects
+// them, or only accepts the images whose digests are signed in the trust data
+// of a Notary server, as with client side content trust.
+package trust
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/docker/docker/reference"
+)
+
+const (
+	// RuleAccept accepts all the images of a repository.
+	RuleAccept = "accept"
+	// RuleReject rejects all the images of a repository.
+	RuleReject = "reject"
+	// RuleSigned only accepts the images of a repository whose digests are
+	// signed.
+	RuleSigned = "signed"
+)
+
+// Rule is the verification rule of the images of a repository.
+type Rule struct {
+	// Type is RuleAccept, RuleReject or RuleSigned.
+	Type string `json:"type"`
+	// Server is the URL of the Notary server with the trust data of the
+	// repository, for RuleSigned. It defaults to the one of the registry.
+	Server string `json:"server,omitempty"`
+	// Offline verifies the digests against the trust data of the trust
+	// directory of the daemon only, without updating it from the server.
+	Offline bool `json:"offline,omitempty"`
+	// RootKeys are the IDs of the root keys the trust data must be signed
+	// with, instead of the ones of the first trust data the daemon gets.
+	RootKeys []string `json:"rootkeys,omitempty"`
+	// RootCA is the path of a CA certificate which must have issued the
+	// root certificates of the trust data.
+	RootCA string `json:"rootca,omitempty"`
+}
+
+// Policy is the verification policy of the images of the daemon.
+type Policy struct {
+	// Default is the rule of the repositories no other rule matches. It
+	// accepts all the images if it is empty.
+	Default Rule `json:"default"`
+	// Repositories are the rules of repositories, by repository name,
+	// namespace, e.g. "myregistry:5000/team", or registry hostname, e.g.
+	// "docker.io".
+	Repositories map[string]Rule `json:"repositories,omitempty"`
+}
+
+// LoadPolicy reads and validates the policy in the JSON file path.
+func LoadPolicy(path string) (*Policy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policy Policy
+	if err := json.Unmarshal(b, &policy); err != nil {
+		return nil, fmt.Errorf("invalid signature policy %s: %v", path, err)
+	}
+	if err := policy.normalize(); err != nil {
+		return nil, fmt.Errorf("invalid signature policy %s: %v", path, err)
+	}
+	return &policy, nil
+}
+
+// normalize validates the rules of the policy, and normalizes the names of
+// their repositories.
+func (p *Policy) normalize() error {
+	if p.Default.Type == "" {
+		p.Default.Type = RuleAccept
+	}
+	if err := p.Default.validate(); err != nil {
+		return fmt.Errorf("default rule: %v", err)
+	}
+
+	repositories := make(map[string]Rule, len(p.Repositories))
+	for name, rule := range p.Repositories {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("rule of %s: %v", name, err)
+		}
+		key, err := ruleKey(name)
+		if err != nil {
+			return err
+		}
+		if _, exists := repositories[key]; exists {
+			return fmt.Errorf("duplicate rules for %s", key)
+		}
+		repositories[key] = rule
+	}
+	p.Repositories = repositories
+	return nil
+}
+
+func (r Rule) validate() error {
+	switch r.Type {
+	case RuleAccept, RuleReject:
+		if r.Server != "" || r.Offline || len(r.RootKeys) > 0 || r.RootCA != "" {
+			return fmt.Errorf("trust data options are only supported by the %q rules", RuleSigned)
+		}
+	case RuleSigned:
+		if r.Server != "" && !strings.HasPrefix(r.Server, "https://") {
+			return fmt.Errorf("valid https URL required for trust server, got %s", r.Server)
+		}
+	default:
+		return fmt.Errorf("invalid rule type %q", r.Type)
+	}
+	return nil
+}
+
+// ruleKey normalizes the name of the repositories of a rule, which is a
+// registry hostname, or the name of a repository or a namespace.
+func ruleKey(name string) (string, error) {
+	if !strings.Contains(name, "/") && (strings.ContainsAny(name, ".:") || name == "localhost") {
+		ref, err := reference.ParseNamed(name + "/repository")
+		if err != nil {
+			return "", fmt.Errorf("invalid registry hostname %s: %v", name, err)
+		}
+		return ref.Hostname(), nil
+	}
+	ref, err := reference.ParseNamed(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid repository name %s: %v", name, err)
+	}
+	if !reference.IsNameOnly(ref) {
+		return "", fmt.Errorf("invalid repository name %s: rules apply to repositories, not to tags or digests", name)
+	}
+	return ref.FullName(), nil
+}
+
+// RuleFor returns the rule of the repository name: the one of the repository,
+// or else the one of its closest namespace or of its registry, or else the
+// default one.
+func (p *Policy) RuleFor(name reference.Named) Rule {
+	key := name.FullName()
+	for {
+		if rule, ok := p.Repositories[key]; ok {
+			return rule
+		}
+		i := strings.LastIndex(key, "/")
+		if i < 0 {
+			return p.Default
+		}
+		key = key[:i]
+	}
+}
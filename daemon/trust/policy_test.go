@@ -0,0 +1,193 @@
+package trust
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/reference"
+	"github.com/docker/docker/registry"
+	"golang.org/x/net/context"
+)
+
+func writePolicy(t *testing.T, dir, policy string) string {
+	path := filepath.Join(dir, "policy.json")
+	if err := ioutil.WriteFile(path, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func parseNamed(t *testing.T, name string) reference.Named {
+	ref, err := reference.ParseNamed(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trust-policy-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	policy, err := LoadPolicy(writePolicy(t, dir, `{
+		"default": {"type": "reject"},
+		"repositories": {
+			"index.docker.io": {"type": "signed"},
+			"busybox": {"type": "accept"},
+			"myregistry:5000/team": {"type": "signed", "server": "https://notary.example.com"},
+			"myregistry:5000/team/legacy": {"type": "accept"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"busybox", RuleAccept},
+		{"ubuntu", RuleSigned},
+		{"docker.io/library/ubuntu", RuleSigned},
+		{"myregistry:5000/team/app", RuleSigned},
+		{"myregistry:5000/team/legacy", RuleAccept},
+		{"myregistry:5000/other", RuleReject},
+		{"otherregistry/team/app", RuleSigned},
+		{"otherregistry.com/app", RuleReject},
+	}
+	for _, test := range tests {
+		if rule := policy.RuleFor(parseNamed(t, test.name)); rule.Type != test.expected {
+			t.Errorf("expected rule %s for %s, got %s", test.expected, test.name, rule.Type)
+		}
+	}
+	if rule := policy.RuleFor(parseNamed(t, "myregistry:5000/team/app")); rule.Server != "https://notary.example.com" {
+		t.Errorf("unexpected server %q", rule.Server)
+	}
+
+	policy, err = LoadPolicy(writePolicy(t, dir, `{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule := policy.RuleFor(parseNamed(t, "ubuntu")); rule.Type != RuleAccept {
+		t.Errorf("expected the empty policy to accept all the images, got %s", rule.Type)
+	}
+
+	invalid := []string{
+		`{"default": {"type": "maybe"}}`,
+		`{"repositories": {"ubuntu": {}}}`,
+		`{"repositories": {"ubuntu:latest": {"type": "signed"}}}`,
+		`{"repositories": {"ubuntu": {"type": "accept", "server": "https://notary.example.com"}}}`,
+		`{"repositories": {"ubuntu": {"type": "signed", "server": "http://notary.example.com"}}}`,
+		`{"repositories": {"ubuntu": {"type": "signed"}, "docker.io/library/ubuntu": {"type": "accept"}}}`,
+		`{"repositories": []}`,
+	}
+	for _, p := range invalid {
+		if _, err := LoadPolicy(writePolicy(t, dir, p)); err == nil {
+			t.Errorf("expected policy %s to be invalid", p)
+		}
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trust-verifier-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	policy, err := LoadPolicy(writePolicy(t, dir, `{
+		"default": {"type": "signed", "offline": true},
+		"repositories": {
+			"busybox": {"type": "accept"},
+			"evil": {"type": "reject"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := NewVerifier(policy, filepath.Join(dir, "trust"), registry.NewService(registry.ServiceOptions{}))
+	ctx := context.Background()
+
+	if ref, err := v.VerifyPull(ctx, parseNamed(t, "busybox:latest"), nil); err != nil || ref != nil {
+		t.Fatalf("expected busybox to be accepted, got %v, %v", ref, err)
+	}
+	if _, err := v.VerifyPull(ctx, parseNamed(t, "evil:latest"), nil); err == nil || !strings.Contains(err.Error(), "rejects") {
+		t.Fatalf("expected evil to be rejected, got %v", err)
+	}
+	if _, err := v.VerifyPull(ctx, parseNamed(t, "ubuntu"), nil); err == nil || !strings.Contains(err.Error(), "all the tags") {
+		t.Fatalf("expected pulling all the tags to be rejected, got %v", err)
+	}
+	// There is no trust data for ubuntu in the trust directory.
+	if _, err := v.VerifyPull(ctx, parseNamed(t, "ubuntu:latest"), nil); err == nil {
+		t.Fatal("expected an image without trust data to be rejected")
+	}
+
+	signed := parseNamed(t, "ubuntu@sha256:f0cd5ca10b07f35512fc2f1cbf9a6cefbdb5cba70ac6b0c9e5988f4497f71937")
+	tests := []struct {
+		name     reference.Named
+		refs     []reference.Named
+		accepted bool
+	}{
+		{parseNamed(t, "busybox"), nil, true},
+		{parseNamed(t, "evil"), nil, false},
+		{parseNamed(t, "ubuntu"), []reference.Named{parseNamed(t, "ubuntu:latest")}, false},
+		{parseNamed(t, "ubuntu"), []reference.Named{signed}, false},
+		{nil, nil, false},
+		{nil, []reference.Named{parseNamed(t, "evil:latest"), parseNamed(t, "busybox:latest")}, true},
+		{nil, []reference.Named{parseNamed(t, "evil:latest")}, false},
+	}
+	for i, test := range tests {
+		err := v.VerifyImage(ctx, test.name, test.refs)
+		if test.accepted && err != nil {
+			t.Errorf("%d: expected image to be accepted, got %v", i, err)
+		} else if !test.accepted && err == nil {
+			t.Errorf("%d: expected image to be rejected", i)
+		}
+	}
+}
+
+func TestVerifierVerifiedDigests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trust-verified-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	policy, err := LoadPolicy(writePolicy(t, dir, `{"default": {"type": "signed", "offline": true}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trustDir := filepath.Join(dir, "trust")
+	v := NewVerifier(policy, trustDir, registry.NewService(registry.ServiceOptions{}))
+	ctx := context.Background()
+
+	name := parseNamed(t, "ubuntu")
+	signed := parseNamed(t, "ubuntu@sha256:f0cd5ca10b07f35512fc2f1cbf9a6cefbdb5cba70ac6b0c9e5988f4497f71937")
+	refs := []reference.Named{signed}
+	if err := v.VerifyImage(ctx, name, refs); err == nil {
+		t.Fatal("expected an image without trust data to be rejected")
+	}
+
+	// The digests verified when pulling are accepted without trust data,
+	// also by a new verifier.
+	v.recordVerified(name, policy.RuleFor(name), signed.(reference.Canonical).Digest())
+	if err := v.VerifyImage(ctx, name, refs); err != nil {
+		t.Fatalf("expected the verified digest to be accepted, got %v", err)
+	}
+	v = NewVerifier(policy, trustDir, registry.NewService(registry.ServiceOptions{}))
+	if err := v.VerifyImage(ctx, nil, refs); err != nil {
+		t.Fatalf("expected the recorded verified digest to be accepted, got %v", err)
+	}
+
+	// Changing the rule of the repository discards its verified digests.
+	policy.Default.RootKeys = []string{"0123456789abcdef"}
+	if err := v.VerifyImage(ctx, name, refs); err == nil {
+		t.Fatal("expected a digest verified under another rule to be rejected")
+	}
+}
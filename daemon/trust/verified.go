@@ -0,0 +1,112 @@
+package trust
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/docker/pkg/ioutils"
+)
+
+// maxVerifiedDigests is the number of verified digests recorded for each
+// repository; the oldest ones are verified against the trust data again.
+const maxVerifiedDigests = 100
+
+// verifiedRepository is the record of the digests of a repository which were
+// verified under the rule whose digest is Rule.
+type verifiedRepository struct {
+	Rule    digest.Digest   `json:"rule"`
+	Digests []digest.Digest `json:"digests"`
+}
+
+// verifiedDigests records the digests the verifier verified, by repository,
+// so that the containers of the images pulled with the policy can be created
+// without getting the trust data again, which expires if it is not updated.
+type verifiedDigests struct {
+	mu           sync.Mutex
+	path         string
+	repositories map[string]verifiedRepository
+}
+
+// loadVerifiedDigests loads the verified digests recorded in the JSON file
+// path. An unreadable record is discarded, since the digests can be verified
+// again.
+func loadVerifiedDigests(path string) *verifiedDigests {
+	vd := &verifiedDigests{
+		path:         path,
+		repositories: make(map[string]verifiedRepository),
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.Warnf("Failed to read the verified image digests: %v", err)
+		}
+		return vd
+	}
+	if err := json.Unmarshal(b, &vd.repositories); err != nil {
+		logrus.Warnf("Discarding the invalid verified image digests %s: %v", path, err)
+		vd.repositories = make(map[string]verifiedRepository)
+	}
+	return vd
+}
+
+// ruleDigest returns the digest of rule, which invalidates the digests
+// verified under a previous rule of a repository.
+func ruleDigest(rule Rule) digest.Digest {
+	b, err := json.Marshal(rule)
+	if err != nil {
+		return ""
+	}
+	return digest.FromBytes(b)
+}
+
+// contains returns whether dgst was verified under rule for the repository
+// name.
+func (vd *verifiedDigests) contains(name string, rule Rule, dgst digest.Digest) bool {
+	vd.mu.Lock()
+	defer vd.mu.Unlock()
+
+	repo, ok := vd.repositories[name]
+	if !ok || repo.Rule != ruleDigest(rule) {
+		return false
+	}
+	for _, d := range repo.Digests {
+		if d == dgst {
+			return true
+		}
+	}
+	return false
+}
+
+// add records that dgst was verified under rule for the repository name.
+func (vd *verifiedDigests) add(name string, rule Rule, dgst digest.Digest) error {
+	vd.mu.Lock()
+	defer vd.mu.Unlock()
+
+	ruleDgst := ruleDigest(rule)
+	repo := vd.repositories[name]
+	if repo.Rule != ruleDgst {
+		repo = verifiedRepository{Rule: ruleDgst}
+	}
+	digests := []digest.Digest{dgst}
+	for _, d := range repo.Digests {
+		if d != dgst && len(digests) < maxVerifiedDigests {
+			digests = append(digests, d)
+		}
+	}
+	repo.Digests = digests
+	vd.repositories[name] = repo
+
+	b, err := json.Marshal(vd.repositories)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(vd.path), 0700); err != nil {
+		return err
+	}
+	return ioutils.AtomicWriteFile(vd.path, b, 0600)
+}
@@ -0,0 +1,260 @@
+package trust
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/docker/dockerversion"
+	"github.com/docker/docker/reference"
+	"github.com/docker/docker/registry"
+	"github.com/docker/engine-api/types"
+	"github.com/docker/notary/client"
+	"github.com/docker/notary/passphrase"
+	"github.com/docker/notary/trustpinning"
+	"github.com/docker/notary/tuf/data"
+	"golang.org/x/net/context"
+)
+
+// releasesRole is the delegation role of the signed images, besides the
+// targets role.
+var releasesRole = path.Join(data.CanonicalTargetsRole, "releases")
+
+// Verifier verifies images against a policy.
+type Verifier struct {
+	policy          *Policy
+	trustDir        string
+	registryService registry.Service
+	verified        *verifiedDigests
+}
+
+// NewVerifier returns a verifier of images against policy, which stores the
+// trust data of the repositories in trustDir.
+func NewVerifier(policy *Policy, trustDir string, registryService registry.Service) *Verifier {
+	return &Verifier{
+		policy:          policy,
+		trustDir:        trustDir,
+		registryService: registryService,
+		verified:        loadVerifiedDigests(filepath.Join(trustDir, "verified.json")),
+	}
+}
+
+// VerifyPull verifies ref, the reference of an image to pull. It returns the
+// canonical reference of the signed digest the image must be pulled by, or
+// nil if the policy accepts all the images of the repository.
+func (v *Verifier) VerifyPull(ctx context.Context, ref reference.Named, authConfig *types.AuthConfig) (reference.Canonical, error) {
+	rule := v.policy.RuleFor(ref)
+	switch rule.Type {
+	case RuleAccept:
+		return nil, nil
+	case RuleReject:
+		return nil, fmt.Errorf("the signature policy rejects the images of %s", ref.FullName())
+	}
+
+	var tagged reference.NamedTagged
+	switch r := ref.(type) {
+	case reference.Canonical:
+	case reference.NamedTagged:
+		tagged = r
+	default:
+		return nil, fmt.Errorf("pulling all the tags of %s is not supported, since the signature policy requires its images to be signed", ref.FullName())
+	}
+
+	repo, err := v.notaryRepository(ctx, ref, rule, authConfig)
+	if err != nil {
+		return nil, err
+	}
+	if tagged == nil {
+		canonical := ref.(reference.Canonical)
+		if err := verifyDigest(repo, canonical.Digest()); err != nil {
+			return nil, fmt.Errorf("the signature policy rejects %s: %v", ref.String(), err)
+		}
+		v.recordVerified(ref, rule, canonical.Digest())
+		return canonical, nil
+	}
+
+	t, err := repo.GetTargetByName(tagged.Tag(), releasesRole, data.CanonicalTargetsRole)
+	if err != nil {
+		return nil, fmt.Errorf("the signature policy rejects %s: %v", ref.String(), err)
+	}
+	// Only trust the targets of the top level targets role or of the
+	// releases delegation role, like client side content trust.
+	if t.Role != releasesRole && t.Role != data.CanonicalTargetsRole {
+		return nil, fmt.Errorf("the signature policy rejects %s: no trust data for %s", ref.String(), tagged.Tag())
+	}
+	dgst, err := targetDigest(t.Target)
+	if err != nil {
+		return nil, err
+	}
+	v.recordVerified(ref, rule, dgst)
+	return reference.WithDigest(ref, dgst)
+}
+
+// recordVerified records that dgst, a digest of the repository of ref, was
+// verified under rule.
+func (v *Verifier) recordVerified(ref reference.Named, rule Rule, dgst digest.Digest) {
+	if err := v.verified.add(ref.FullName(), rule, dgst); err != nil {
+		logrus.Warnf("Failed to record the verified digest %s of %s: %v", dgst, ref.FullName(), err)
+	}
+}
+
+// VerifyImage verifies an image to create a container from, whose references
+// are refs. name is the reference the image is created from, or nil if it is
+// created from its ID, in which case the image is accepted if the rule of any
+// of its repositories accepts it. The digests verified when pulling are
+// accepted without getting the trust data again; the other ones are verified
+// against the trust data of the Notary servers, or only against the stored
+// trust data for the offline rules.
+func (v *Verifier) VerifyImage(ctx context.Context, name reference.Named, refs []reference.Named) error {
+	var names []reference.Named
+	if name != nil {
+		names = append(names, name)
+	} else {
+		seen := make(map[string]bool)
+		for _, ref := range refs {
+			if !seen[ref.FullName()] {
+				seen[ref.FullName()] = true
+				names = append(names, ref)
+			}
+		}
+	}
+
+	if len(names) == 0 {
+		switch v.policy.Default.Type {
+		case RuleAccept:
+			return nil
+		case RuleReject:
+			return errors.New("the signature policy rejects the images without repository")
+		default:
+			return errors.New("the signature policy rejects the images without signed digest")
+		}
+	}
+
+	var err error
+	for _, name := range names {
+		if err = v.verifyImageOf(ctx, name, refs); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// verifyImageOf verifies an image of the repository name whose references are
+// refs.
+func (v *Verifier) verifyImageOf(ctx context.Context, name reference.Named, refs []reference.Named) error {
+	rule := v.policy.RuleFor(name)
+	switch rule.Type {
+	case RuleAccept:
+		return nil
+	case RuleReject:
+		return fmt.Errorf("the signature policy rejects the images of %s", name.FullName())
+	}
+
+	var canonicals []reference.Canonical
+	for _, ref := range refs {
+		canonical, ok := ref.(reference.Canonical)
+		if !ok || canonical.FullName() != name.FullName() {
+			continue
+		}
+		if v.verified.contains(name.FullName(), rule, canonical.Digest()) {
+			return nil
+		}
+		canonicals = append(canonicals, canonical)
+	}
+
+	if len(canonicals) > 0 {
+		repo, err := v.notaryRepository(ctx, name, rule, nil)
+		if err != nil {
+			return err
+		}
+		for _, canonical := range canonicals {
+			err := verifyDigest(repo, canonical.Digest())
+			if err == nil {
+				v.recordVerified(name, rule, canonical.Digest())
+				return nil
+			}
+			logrus.Debugf("Failed to verify the signature of %s: %v", canonical.String(), err)
+		}
+	}
+	return fmt.Errorf("the signature policy rejects the images of %s without signed digest; pull the image again to verify its signature", name.FullName())
+}
+
+// verifyDigest checks that dgst is the digest of a target of repo.
+func verifyDigest(repo *client.NotaryRepository, dgst digest.Digest) error {
+	targets, err := repo.ListTargets(releasesRole, data.CanonicalTargetsRole)
+	if err != nil {
+		return err
+	}
+	for _, t := range targets {
+		if t.Role != releasesRole && t.Role != data.CanonicalTargetsRole {
+			continue
+		}
+		if targetDgst, err := targetDigest(t.Target); err == nil && targetDgst == dgst {
+			return nil
+		}
+	}
+	return fmt.Errorf("digest %s is not signed", dgst)
+}
+
+func targetDigest(t client.Target) (digest.Digest, error) {
+	h, ok := t.Hashes["sha256"]
+	if !ok {
+		return "", errors.New("no valid hash, expecting sha256")
+	}
+	return digest.NewDigestFromHex("sha256", hex.EncodeToString(h)), nil
+}
+
+// notaryRepository returns the trust data of the repository name, which is
+// updated from the Notary server unless the rule is offline.
+func (v *Verifier) notaryRepository(ctx context.Context, name reference.Named, rule Rule, authConfig *types.AuthConfig) (*client.NotaryRepository, error) {
+	repoInfo, err := v.registryService.ResolveRepository(name)
+	if err != nil {
+		return nil, err
+	}
+
+	server := rule.Server
+	if server == "" {
+		if repoInfo.Index.Official {
+			server = registry.NotaryServer
+		} else {
+			server = "https://" + repoInfo.Index.Name
+		}
+	}
+
+	var tr http.RoundTripper
+	if !rule.Offline {
+		if authConfig == nil {
+			authConfig = &types.AuthConfig{}
+		}
+		u, err := url.Parse(server)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig, err := v.registryService.TLSConfig(u.Host)
+		if err != nil {
+			return nil, err
+		}
+		tr, err = registry.NotaryTransport(server, tlsConfig, dockerversion.DockerUserAgent(ctx), nil, repoInfo.FullName(), *authConfig, "pull")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var trustPinning trustpinning.TrustPinConfig
+	if len(rule.RootKeys) > 0 {
+		trustPinning.Certs = map[string][]string{repoInfo.FullName(): rule.RootKeys}
+		trustPinning.DisableTOFU = true
+	}
+	if rule.RootCA != "" {
+		trustPinning.CA = map[string]string{repoInfo.FullName(): rule.RootCA}
+		trustPinning.DisableTOFU = true
+	}
+
+	return client.NewNotaryRepository(v.trustDir, repoInfo.FullName(), server, tr, passphrase.ConstantRetriever(""), trustPinning)
+}
@@ -0,0 +1,80 @@
+// Package blobcache implements the blob caches which the daemons of several
+// hosts may share, so that they download each layer blob from its registry
+// once. A cache is either a directory, e.g. on a network file system, or an
+// HTTP server storing the blobs PUT at its URL.
+package blobcache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/distribution/digest"
+	"github.com/docker/docker/distribution/xfer"
+)
+
+// ErrBlobNotCached is returned when a blob is not found in a cache.
+var ErrBlobNotCached = errors.New("blob not cached")
+
+// New returns the blob cache at location, which is either the absolute path
+// of a directory or an http(s) URL.
+func New(location string) (xfer.BlobCache, error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blob cache URL %q: %v", location, err)
+		}
+		return NewHTTPCache(u, nil), nil
+	}
+	if !filepath.IsAbs(location) {
+		return nil, fmt.Errorf("blob cache %q is neither an absolute path nor an http(s) URL", location)
+	}
+	return NewFSCache(location)
+}
+
+// blobPath returns the path of the blob dgst relative to the root of a
+// cache.
+func blobPath(dgst digest.Digest) string {
+	return string(dgst.Algorithm()) + "/" + dgst.Hex()
+}
+
+// copyVerified copies r to the temporary file f, and returns the size of
+// the blob dgst, or an error if r isn't the blob dgst.
+func copyVerified(f *os.File, dgst digest.Digest, r io.Reader) (int64, error) {
+	verifier, err := digest.NewDigestVerifier(dgst)
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(io.MultiWriter(f, verifier), r)
+	if err != nil {
+		return 0, err
+	}
+	if !verifier.Verified() {
+		return 0, fmt.Errorf("blob does not match digest %s", dgst)
+	}
+	return size, nil
+}
+
+// spool copies the blob dgst read from r to a temporary file, and returns it
+// rewound, with its size.
+func spool(dgst digest.Digest, r io.Reader) (*os.File, int64, error) {
+	f, err := ioutil.TempFile("", "blobcache")
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := copyVerified(f, dgst, r)
+	if err == nil {
+		_, err = f.Seek(0, os.SEEK_SET)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, 0, err
+	}
+	return f, size, nil
+}
@@ -0,0 +1,120 @@
+package blobcache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/distribution/digest"
+	"github.com/docker/docker/distribution/xfer"
+	"golang.org/x/net/context"
+)
+
+func testCache(t *testing.T, cache xfer.BlobCache) {
+	ctx := context.Background()
+	blob := []byte("blob content")
+	dgst := digest.FromBytes(blob)
+
+	if _, _, err := cache.Get(ctx, dgst); err != ErrBlobNotCached {
+		t.Fatalf("expected ErrBlobNotCached, got %v", err)
+	}
+
+	if err := cache.Put(ctx, dgst, strings.NewReader("other content")); err == nil {
+		t.Fatal("expected a blob not matching its digest to be rejected")
+	}
+	if _, _, err := cache.Get(ctx, dgst); err != ErrBlobNotCached {
+		t.Fatalf("expected a rejected blob not to be cached, got %v", err)
+	}
+
+	if err := cache.Put(ctx, dgst, bytes.NewReader(blob)); err != nil {
+		t.Fatal(err)
+	}
+	rc, size, err := cache.Get(ctx, dgst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, blob) || size != int64(len(blob)) {
+		t.Fatalf("got %q (size %d), expected %q", b, size, blob)
+	}
+}
+
+func TestFSCache(t *testing.T) {
+	root, err := ioutil.TempDir("", "blobcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	cache, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCache(t, cache)
+}
+
+func TestHTTPCache(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		blobs = make(map[string][]byte)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case "GET":
+			b, ok := blobs[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(b)
+		case "PUT":
+			b, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			blobs[r.URL.Path] = b
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+
+	cache, err := New(server.URL + "/cache/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCache(t, cache)
+
+	dgst := digest.FromBytes([]byte("blob content"))
+	if _, ok := blobs["/cache/"+string(dgst.Algorithm())+"/"+dgst.Hex()]; !ok {
+		t.Fatalf("blob not stored at the expected path: %v", blobs)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("relative/path"); err == nil {
+		t.Fatal("expected a relative path to be rejected")
+	}
+	cache, err := New("https://cache.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("https://cache.example.com")
+	if c, ok := cache.(*HTTPCache); !ok || c.base.String() != u.String() {
+		t.Fatalf("unexpected cache %#v", cache)
+	}
+}
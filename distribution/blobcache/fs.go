@@ -0,0 +1,89 @@
+package blobcache
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/distribution/digest"
+	"golang.org/x/net/context"
+)
+
+// FSCache is a blob cache storing the blobs in a directory, as
+// <algorithm>/<hex> files. The directory may be shared by several daemons,
+// since the blobs are renamed into place once complete and verified.
+type FSCache struct {
+	root string
+}
+
+// NewFSCache returns the blob cache in the directory root, creating it if it
+// doesn't exist.
+func NewFSCache(root string) (*FSCache, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &FSCache{root: root}, nil
+}
+
+func (c *FSCache) path(dgst digest.Digest) string {
+	return filepath.Join(c.root, filepath.FromSlash(blobPath(dgst)))
+}
+
+// Get returns a reader of the blob dgst and its size, or ErrBlobNotCached if
+// the cache doesn't have it.
+func (c *FSCache) Get(ctx context.Context, dgst digest.Digest) (io.ReadCloser, int64, error) {
+	if err := dgst.Validate(); err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(c.path(dgst))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, ErrBlobNotCached
+		}
+		return nil, 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, fi.Size(), nil
+}
+
+// Put stores the blob dgst read from r, unless the cache already has it.
+func (c *FSCache) Put(ctx context.Context, dgst digest.Digest, r io.Reader) error {
+	if err := dgst.Validate(); err != nil {
+		return err
+	}
+	path := c.path(dgst)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// The temporary file is in the same directory, so that renaming it is
+	// atomic.
+	f, err := ioutil.TempFile(dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = copyVerified(f, dgst, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
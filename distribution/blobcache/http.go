@@ -0,0 +1,106 @@
+package blobcache
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/digest"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// HTTPCache is a blob cache served over HTTP, e.g. by a WebDAV server or a
+// caching proxy of the local network. The blob dgst is fetched with a GET
+// request, and stored with a PUT request, at <url>/<algorithm>/<hex>.
+type HTTPCache struct {
+	base   *url.URL
+	client *http.Client
+}
+
+// NewHTTPCache returns the blob cache at base, which is accessed with
+// client, or with a client giving up on an unreachable or unresponsive
+// server after a few seconds if client is nil.
+func NewHTTPCache(base *url.URL, client *http.Client) *HTTPCache {
+	if client == nil {
+		client = &http.Client{
+			// The blobs may be large, so only connecting and waiting
+			// for the responses is limited in time.
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				Dial: (&net.Dialer{
+					Timeout:   5 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).Dial,
+				TLSHandshakeTimeout:   5 * time.Second,
+				ResponseHeaderTimeout: 10 * time.Second,
+			},
+		}
+	}
+	return &HTTPCache{base: base, client: client}
+}
+
+func (c *HTTPCache) url(dgst digest.Digest) string {
+	u := *c.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + blobPath(dgst)
+	return u.String()
+}
+
+// Get returns a reader of the blob dgst and its size, or ErrBlobNotCached if
+// the server doesn't have it.
+func (c *HTTPCache) Get(ctx context.Context, dgst digest.Digest) (io.ReadCloser, int64, error) {
+	if err := dgst.Validate(); err != nil {
+		return nil, 0, err
+	}
+	resp, err := ctxhttp.Get(ctx, c.client, c.url(dgst))
+	if err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, 0, ErrBlobNotCached
+	case resp.StatusCode != http.StatusOK:
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("unexpected status getting blob %s from the blob cache: %s", dgst, resp.Status)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// Put stores the blob dgst read from r on the server. The blob is verified
+// before being sent, so that the server never gets a truncated or corrupted
+// blob.
+func (c *HTTPCache) Put(ctx context.Context, dgst digest.Digest, r io.Reader) error {
+	if err := dgst.Validate(); err != nil {
+		return err
+	}
+	f, size, err := spool(dgst, r)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+
+	req, err := http.NewRequest("PUT", c.url(dgst), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := ctxhttp.Do(ctx, c.client, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status putting blob %s in the blob cache: %s", dgst, resp.Status)
+	}
+	return nil
+}
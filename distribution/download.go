@@ -0,0 +1,117 @@
+package distribution
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/distribution/digest"
+)
+
+// partialDownloadPath returns the path of the partial download of the blob
+// dgst in dir.
+func partialDownloadPath(dir string, dgst digest.Digest) string {
+	return filepath.Join(dir, string(dgst.Algorithm())+"-"+dgst.Hex())
+}
+
+// errPartialDownloadBusy is returned when opening a partial download which
+// another transfer uses, such as the one of the same blob at another depth
+// of another image.
+var errPartialDownloadBusy = errors.New("partial download in use by another transfer")
+
+// partialDownloadsInUse are the paths of the partial downloads opened by the
+// transfers. The download directory belongs to a single daemon, so keeping
+// track of them in the process is enough for two transfers never to write
+// the same file.
+var partialDownloadsInUse = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: make(map[string]bool)}
+
+// openPartialDownloadFile opens the partial download of the blob dgst in
+// dir, creating it if there is none, or returns errPartialDownloadBusy if
+// another transfer has it open. It must be closed with
+// closePartialDownloadFile.
+func openPartialDownloadFile(dir string, dgst digest.Digest) (*os.File, error) {
+	if err := dgst.Validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	p := partialDownloadPath(dir, dgst)
+
+	partialDownloadsInUse.Lock()
+	defer partialDownloadsInUse.Unlock()
+	if partialDownloadsInUse.paths[p] {
+		return nil, errPartialDownloadBusy
+	}
+	f, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	partialDownloadsInUse.paths[p] = true
+	return f, nil
+}
+
+// closePartialDownloadFile closes the partial download f, removing it if
+// remove is set, and lets other transfers open it.
+func closePartialDownloadFile(f *os.File, remove bool) error {
+	f.Close()
+	var err error
+	if remove {
+		if err = os.RemoveAll(f.Name()); err != nil {
+			logrus.Errorf("Failed to remove partial download: %s", f.Name())
+		}
+	}
+
+	partialDownloadsInUse.Lock()
+	delete(partialDownloadsInUse.paths, f.Name())
+	partialDownloadsInUse.Unlock()
+	return err
+}
+
+// closeDownloadFile closes the download file f, which is a partial download
+// if partial is set, removing it if remove is set.
+func closeDownloadFile(f *os.File, partial, remove bool) error {
+	if partial {
+		return closePartialDownloadFile(f, remove)
+	}
+	f.Close()
+	if !remove {
+		return nil
+	}
+	err := os.RemoveAll(f.Name())
+	if err != nil {
+		logrus.Errorf("Failed to remove temp file: %s", f.Name())
+	}
+	return err
+}
+
+// CleanupPartialDownloads removes the partial downloads of dir which were
+// not resumed for maxAge, so that the ones of the images which are never
+// pulled again don't accumulate.
+func CleanupPartialDownloads(dir string, maxAge time.Duration) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, f := range files {
+		if time.Since(f.ModTime()) < maxAge {
+			continue
+		}
+		p := filepath.Join(dir, f.Name())
+		logrus.Debugf("removing partial download %s", p)
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package distribution
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/digest"
+	distreference "github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/client"
+	"github.com/docker/docker/pkg/progress"
+	"golang.org/x/net/context"
+)
+
+type discardProgress struct{}
+
+func (discardProgress) WriteProgress(progress.Progress) error {
+	return nil
+}
+
+// TestDownloadResumesPartialDownload checks that the layer download resumes
+// the partial download of a previous pull with a range request, and removes
+// it once the download is handed off.
+func TestDownloadResumesPartialDownload(t *testing.T) {
+	blob := bytes.Repeat([]byte("resumable layer "), 1024)
+	dgst := digest.FromBytes(blob)
+
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/blobs/"+dgst.String()) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+	}))
+	defer server.Close()
+
+	name, err := distreference.ParseNamed("test/layer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := client.NewRepository(context.Background(), name, server.URL, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	downloadDir, err := ioutil.TempDir("", "partial-downloads-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(downloadDir)
+
+	partialPath := partialDownloadPath(downloadDir, dgst)
+	if err := ioutil.WriteFile(partialPath, blob[:1000], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ld := &v2LayerDescriptor{digest: dgst, repo: repo, downloadDir: downloadDir}
+	rc, size, err := ld.Download(context.Background(), discardProgress{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ld.Close()
+
+	if size != int64(len(blob)) {
+		t.Fatalf("unexpected size %d, expected %d", size, len(blob))
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes=1000-" {
+		t.Fatalf("unexpected range requests %q", ranges)
+	}
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, blob) {
+		t.Fatal("downloaded data doesn't match the blob")
+	}
+
+	rc.Close()
+	if _, err := os.Stat(partialPath); !os.IsNotExist(err) {
+		t.Fatalf("partial download not removed: %v", err)
+	}
+}
+
+// TestDownloadCompletePartialDownload checks that a complete partial
+// download is used without contacting the registry.
+func TestDownloadCompletePartialDownload(t *testing.T) {
+	blob := []byte("complete layer")
+	dgst := digest.FromBytes(blob)
+
+	downloadDir, err := ioutil.TempDir("", "partial-downloads-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(downloadDir)
+
+	if err := ioutil.WriteFile(partialDownloadPath(downloadDir, dgst), blob, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The descriptor has no repository to download from.
+	ld := &v2LayerDescriptor{digest: dgst, downloadDir: downloadDir}
+	rc, size, err := ld.Download(context.Background(), discardProgress{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if size != int64(len(blob)) {
+		t.Fatalf("unexpected size %d, expected %d", size, len(blob))
+	}
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, blob) {
+		t.Fatal("downloaded data doesn't match the blob")
+	}
+}
+
+// TestDownloadBusyPartialDownload checks that a transfer of a blob whose
+// partial download another transfer uses downloads it to a temporary file
+// instead.
+func TestDownloadBusyPartialDownload(t *testing.T) {
+	blob := bytes.Repeat([]byte("shared layer "), 1024)
+	dgst := digest.FromBytes(blob)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/blobs/"+dgst.String()) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+	}))
+	defer server.Close()
+
+	name, err := distreference.ParseNamed("test/layer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := client.NewRepository(context.Background(), name, server.URL, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	downloadDir, err := ioutil.TempDir("", "partial-downloads-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(downloadDir)
+
+	partialPath := partialDownloadPath(downloadDir, dgst)
+	first := &v2LayerDescriptor{digest: dgst, repo: repo, downloadDir: downloadDir}
+	firstRC, _, err := first.Download(context.Background(), discardProgress{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Close()
+
+	// The first transfer hasn't closed the partial download yet.
+	second := &v2LayerDescriptor{digest: dgst, repo: repo, downloadDir: downloadDir}
+	secondRC, _, err := second.Download(context.Background(), discardProgress{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Close()
+
+	for _, rc := range []io.ReadCloser{firstRC, secondRC} {
+		data, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, blob) {
+			t.Fatal("downloaded data doesn't match the blob")
+		}
+	}
+	secondRC.Close()
+	if _, err := os.Stat(partialPath); err != nil {
+		t.Fatalf("partial download of the first transfer removed by the second one: %v", err)
+	}
+	firstRC.Close()
+
+	// The partial download can be opened again once closed.
+	f, err := openPartialDownloadFile(downloadDir, dgst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closePartialDownloadFile(f, true)
+}
+
+func TestCleanupPartialDownloads(t *testing.T) {
+	downloadDir, err := ioutil.TempDir("", "partial-downloads-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(downloadDir)
+
+	oldPath := partialDownloadPath(downloadDir, digest.FromBytes([]byte("old")))
+	newPath := partialDownloadPath(downloadDir, digest.FromBytes([]byte("new")))
+	for _, p := range []string{oldPath, newPath} {
+		if err := ioutil.WriteFile(p, []byte("partial"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(oldPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CleanupPartialDownloads(downloadDir, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Fatalf("expired partial download not removed: %v", err)
+	}
+	if _, err := os.Stat(newPath); err != nil {
+		t.Fatalf("recent partial download removed: %v", err)
+	}
+
+	if err := CleanupPartialDownloads(downloadDir+"-missing", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,56 @@
+package metadata
+
+import (
+	"encoding/json"
+
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/docker/image"
+)
+
+// PlatformService maps the images pulled from a manifest list to the
+// platform of the manifest list entry which was selected.
+type PlatformService struct {
+	store Store
+}
+
+// NewPlatformService creates a new image ID to platform mapping service.
+func NewPlatformService(store Store) *PlatformService {
+	return &PlatformService{
+		store: store,
+	}
+}
+
+// namespace returns the namespace used by this service.
+func (ps *PlatformService) namespace() string {
+	return "platform-by-imageid"
+}
+
+func (ps *PlatformService) key(id image.ID) string {
+	return string(digest.Digest(id).Algorithm()) + "/" + digest.Digest(id).Hex()
+}
+
+// Get returns the platform the image id was selected for.
+func (ps *PlatformService) Get(id image.ID) (manifestlist.PlatformSpec, error) {
+	var p manifestlist.PlatformSpec
+	jsonBytes, err := ps.store.Get(ps.namespace(), ps.key(id))
+	if err != nil {
+		return p, err
+	}
+	err = json.Unmarshal(jsonBytes, &p)
+	return p, err
+}
+
+// Set records that the image id was selected for the platform p.
+func (ps *PlatformService) Set(id image.ID, p manifestlist.PlatformSpec) error {
+	jsonBytes, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return ps.store.Set(ps.namespace(), ps.key(id), jsonBytes)
+}
+
+// Delete forgets the platform of the image id.
+func (ps *PlatformService) Delete(id image.ID) error {
+	return ps.store.Delete(ps.namespace(), ps.key(id))
+}
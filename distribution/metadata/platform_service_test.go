@@ -0,0 +1,49 @@
+package metadata
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/docker/image"
+)
+
+func TestPlatformService(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "platform-service-test")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	metadataStore, err := NewFSMetadataStore(tmpDir)
+	if err != nil {
+		t.Fatalf("could not create metadata store: %v", err)
+	}
+	platformService := NewPlatformService(metadataStore)
+
+	id := image.ID("sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4")
+	if _, err := platformService.Get(id); err == nil {
+		t.Fatal("expected an error for an image without platform")
+	}
+
+	platform := manifestlist.PlatformSpec{OS: "linux", Architecture: "arm", Variant: "v7"}
+	if err := platformService.Set(id, platform); err != nil {
+		t.Fatalf("error calling Set: %v", err)
+	}
+	p, err := platformService.Get(id)
+	if err != nil {
+		t.Fatalf("error calling Get: %v", err)
+	}
+	if !reflect.DeepEqual(p, platform) {
+		t.Fatalf("expected %+v, got %+v", platform, p)
+	}
+
+	if err := platformService.Delete(id); err != nil {
+		t.Fatalf("error calling Delete: %v", err)
+	}
+	if _, err := platformService.Get(id); err == nil {
+		t.Fatal("expected an error after Delete")
+	}
+}
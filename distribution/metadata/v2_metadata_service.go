@@ -1,10 +1,16 @@
 package metadata
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"net/url"
 
 	"github.com/docker/distribution/digest"
 	"github.com/docker/docker/layer"
+	"github.com/docker/docker/reference"
+	"github.com/docker/engine-api/types"
 )
 
 // V2MetadataService maps layer IDs to a set of known metadata for
@@ -17,11 +23,25 @@ type V2MetadataService struct {
 type V2Metadata struct {
 	Digest           digest.Digest
 	SourceRepository string
+	// HMAC hashes above attributes with recent authconfig digest used as a key in order to determine matching
+	// metadata entries accompanied by the same credentials without actually exposing them.
+	HMAC string `json:",omitempty"`
+}
+
+// repositoryAccess is a repository of a registry which layers were pulled
+// from or pushed to with the credentials whose key hashes the repository
+// name into HMAC.
+type repositoryAccess struct {
+	Repository string
+	HMAC       string `json:",omitempty"`
 }
 
 // maxMetadata is the number of metadata entries to keep per layer DiffID.
 const maxMetadata = 50
 
+// maxRepositories is the number of source repositories to keep per registry.
+const maxRepositories = 50
+
 // NewV2MetadataService creates a new diff ID to v2 metadata mapping service.
 func NewV2MetadataService(store Store) *V2MetadataService {
 	return &V2MetadataService{
@@ -37,6 +57,10 @@ func (serv *V2MetadataService) digestNamespace() string {
 	return "diffid-by-digest"
 }
 
+func (serv *V2MetadataService) repositoryNamespace() string {
+	return "repositories-by-registry"
+}
+
 func (serv *V2MetadataService) diffIDKey(diffID layer.DiffID) string {
 	return string(digest.Digest(diffID).Algorithm()) + "/" + digest.Digest(diffID).Hex()
 }
@@ -45,6 +69,12 @@ func (serv *V2MetadataService) digestKey(dgst digest.Digest) string {
 	return string(dgst.Algorithm()) + "/" + dgst.Hex()
 }
 
+func (serv *V2MetadataService) repositoryKey(hostname string) string {
+	// Escape the port separator, which is not allowed in file names on
+	// Windows.
+	return url.QueryEscape(hostname)
+}
+
 // GetMetadata finds the metadata associated with a layer DiffID.
 func (serv *V2MetadataService) GetMetadata(diffID layer.DiffID) ([]V2Metadata, error) {
 	jsonBytes, err := serv.store.Get(serv.diffIDNamespace(), serv.diffIDKey(diffID))
@@ -70,6 +100,74 @@ func (serv *V2MetadataService) GetDiffID(dgst digest.Digest) (layer.DiffID, erro
 	return layer.DiffID(diffIDBytes), nil
 }
 
+// authConfigKeyInput is a reduced AuthConfig structure holding just relevant credential data eligible for
+// hmac key creation.
+type authConfigKeyInput struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+
+	IdentityToken string `json:"identitytoken,omitempty"`
+	RegistryToken string `json:"registrytoken,omitempty"`
+}
+
+// ComputeV2MetadataHMACKey returns a key for the given "authConfig" that can be used to hash v2 metadata
+// entries. A nil authConfig is the one of anonymous requests, whose key is
+// the one of an empty authConfig.
+func ComputeV2MetadataHMACKey(authConfig *types.AuthConfig) ([]byte, error) {
+	if authConfig == nil {
+		authConfig = &types.AuthConfig{}
+	}
+	key := authConfigKeyInput{
+		Username:      authConfig.Username,
+		Password:      authConfig.Password,
+		Auth:          authConfig.Auth,
+		IdentityToken: authConfig.IdentityToken,
+		RegistryToken: authConfig.RegistryToken,
+	}
+	buf, err := json.Marshal(&key)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(digest.FromBytes(buf)), nil
+}
+
+// ComputeV2MetadataHMAC returns a hmac for the given "meta" using the given key.
+func ComputeV2MetadataHMAC(key []byte, meta *V2Metadata) string {
+	if len(key) == 0 || meta == nil {
+		return ""
+	}
+	return computeHMAC(key, string(meta.Digest), meta.SourceRepository)
+}
+
+// CheckV2MetadataHMAC return true if the given "meta" is tagged with a hmac hashed by the given "key".
+func CheckV2MetadataHMAC(meta *V2Metadata, key []byte) bool {
+	if len(meta.HMAC) == 0 || len(key) == 0 {
+		return len(meta.HMAC) == 0 && len(key) == 0
+	}
+	return checkHMAC(key, meta.HMAC, string(meta.Digest), meta.SourceRepository)
+}
+
+func computeHMAC(key []byte, values ...string) string {
+	mac := hmac.New(sha256.New, key)
+	for _, v := range values {
+		mac.Write([]byte(v))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func checkHMAC(key []byte, expected string, values ...string) bool {
+	expectedMac, err := hex.DecodeString(expected)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, key)
+	for _, v := range values {
+		mac.Write([]byte(v))
+	}
+	return hmac.Equal(expectedMac, mac.Sum(nil))
+}
+
 // Add associates metadata with a layer DiffID. If too many metadata entries are
 // present, the oldest one is dropped.
 func (serv *V2MetadataService) Add(diffID layer.DiffID, metadata V2Metadata) error {
@@ -102,7 +200,103 @@ func (serv *V2MetadataService) Add(diffID layer.DiffID, metadata V2Metadata) err
 		return err
 	}
 
-	return serv.store.Set(serv.digestNamespace(), serv.digestKey(metadata.Digest), []byte(diffID))
+	err = serv.store.Set(serv.digestNamespace(), serv.digestKey(metadata.Digest), []byte(diffID))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AddWithHMAC associates metadata with a layer DiffID, tagged with a hmac of
+// the credentials whose key is "key", and records its source repository
+// among the repositories of its registry the credentials have access to.
+func (serv *V2MetadataService) AddWithHMAC(diffID layer.DiffID, key []byte, meta V2Metadata) error {
+	if len(key) == 0 {
+		return serv.Add(diffID, meta)
+	}
+	meta.HMAC = ComputeV2MetadataHMAC(key, &meta)
+	if err := serv.Add(diffID, meta); err != nil {
+		return err
+	}
+	return serv.addRepository(meta.SourceRepository, key)
+}
+
+// GetRepositories returns the repositories of the registry hostname which
+// layers were pulled from or pushed to with the credentials of one of
+// hmacKeys, from the oldest to the newest.
+func (serv *V2MetadataService) GetRepositories(hostname string, hmacKeys ...[]byte) ([]string, error) {
+	records, err := serv.getRepositoryAccess(hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	var repositories []string
+	seen := make(map[string]bool)
+	for _, r := range records {
+		if seen[r.Repository] {
+			continue
+		}
+		for _, key := range hmacKeys {
+			if len(key) > 0 && checkHMAC(key, r.HMAC, r.Repository) {
+				seen[r.Repository] = true
+				repositories = append(repositories, r.Repository)
+				break
+			}
+		}
+	}
+	return repositories, nil
+}
+
+func (serv *V2MetadataService) getRepositoryAccess(hostname string) ([]repositoryAccess, error) {
+	jsonBytes, err := serv.store.Get(serv.repositoryNamespace(), serv.repositoryKey(hostname))
+	if err != nil {
+		return nil, err
+	}
+
+	var records []repositoryAccess
+	if err := json.Unmarshal(jsonBytes, &records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// addRepository records that the credentials whose key is "key" have access
+// to repository, among the repositories of its registry. If too many
+// repositories are present, the least recently recorded one is dropped.
+func (serv *V2MetadataService) addRepository(repository string, key []byte) error {
+	if repository == "" {
+		return nil
+	}
+	named, err := reference.ParseNamed(repository)
+	if err != nil {
+		return nil
+	}
+
+	record := repositoryAccess{Repository: repository, HMAC: computeHMAC(key, repository)}
+	oldRecords, err := serv.getRepositoryAccess(named.Hostname())
+	if err != nil {
+		oldRecords = nil
+	}
+	records := make([]repositoryAccess, 0, len(oldRecords)+1)
+	for _, r := range oldRecords {
+		if r != record {
+			records = append(records, r)
+		}
+	}
+
+	records = append(records, record)
+	if len(records) > maxRepositories {
+		records = records[len(records)-maxRepositories:]
+	}
+
+	jsonBytes, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	return serv.store.Set(serv.repositoryNamespace(), serv.repositoryKey(named.Hostname()), jsonBytes)
 }
 
 // Remove unassociates a metadata entry from a layer DiffID.
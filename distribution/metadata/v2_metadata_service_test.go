@@ -10,6 +10,7 @@ import (
 
 	"github.com/docker/distribution/digest"
 	"github.com/docker/docker/layer"
+	"github.com/docker/engine-api/types"
 )
 
 func TestV2MetadataService(t *testing.T) {
@@ -113,3 +114,77 @@ func randomDigest() digest.Digest {
 	d := hex.EncodeToString(b[:])
 	return digest.Digest("sha256:" + d)
 }
+
+func TestV2MetadataServiceRepositories(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "v2-metadata-repositories-test")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	metadataStore, err := NewFSMetadataStore(tmpDir)
+	if err != nil {
+		t.Fatalf("could not create metadata store: %v", err)
+	}
+	V2MetadataService := NewV2MetadataService(metadataStore)
+
+	userKey, err := ComputeV2MetadataHMACKey(&types.AuthConfig{Username: "user", Password: "secret"})
+	if err != nil {
+		t.Fatalf("error computing hmac key: %v", err)
+	}
+	otherKey, err := ComputeV2MetadataHMACKey(nil)
+	if err != nil {
+		t.Fatalf("error computing hmac key: %v", err)
+	}
+
+	diffID := layer.DiffID("sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4")
+	for _, repository := range []string{"docker.io/library/busybox", "myregistry:5000/foo", "docker.io/library/busybox", "myregistry:5000/bar", ""} {
+		if err := V2MetadataService.AddWithHMAC(diffID, userKey, V2Metadata{Digest: randomDigest(), SourceRepository: repository}); err != nil {
+			t.Fatalf("error calling AddWithHMAC: %v", err)
+		}
+	}
+	if err := V2MetadataService.AddWithHMAC(diffID, otherKey, V2Metadata{Digest: randomDigest(), SourceRepository: "myregistry:5000/baz"}); err != nil {
+		t.Fatalf("error calling AddWithHMAC: %v", err)
+	}
+
+	repositories, err := V2MetadataService.GetRepositories("myregistry:5000", userKey)
+	if err != nil {
+		t.Fatalf("error calling GetRepositories: %v", err)
+	}
+	if expected := []string{"myregistry:5000/foo", "myregistry:5000/bar"}; !reflect.DeepEqual(repositories, expected) {
+		t.Fatalf("expected repositories %v, got %v", expected, repositories)
+	}
+
+	repositories, err = V2MetadataService.GetRepositories("myregistry:5000", userKey, otherKey)
+	if err != nil {
+		t.Fatalf("error calling GetRepositories: %v", err)
+	}
+	if expected := []string{"myregistry:5000/foo", "myregistry:5000/bar", "myregistry:5000/baz"}; !reflect.DeepEqual(repositories, expected) {
+		t.Fatalf("expected repositories %v, got %v", expected, repositories)
+	}
+
+	repositories, err = V2MetadataService.GetRepositories("docker.io", userKey)
+	if err != nil {
+		t.Fatalf("error calling GetRepositories: %v", err)
+	}
+	if expected := []string{"docker.io/library/busybox"}; !reflect.DeepEqual(repositories, expected) {
+		t.Fatalf("expected repositories %v, got %v", expected, repositories)
+	}
+
+	repositories, err = V2MetadataService.GetRepositories("docker.io", otherKey)
+	if err != nil {
+		t.Fatalf("error calling GetRepositories: %v", err)
+	}
+	if len(repositories) != 0 {
+		t.Fatalf("expected no repositories, got %v", repositories)
+	}
+
+	metadata, err := V2MetadataService.GetMetadata(diffID)
+	if err != nil {
+		t.Fatalf("error calling GetMetadata: %v", err)
+	}
+	last := metadata[len(metadata)-1]
+	if !CheckV2MetadataHMAC(&last, otherKey) || CheckV2MetadataHMAC(&last, userKey) {
+		t.Fatalf("expected metadata %v to be tagged with the hmac of the other key only", last)
+	}
+}
@@ -0,0 +1,136 @@
+package distribution
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/docker/pkg/platform"
+)
+
+// armVariants are the variants of the arm architecture, from the most to
+// the least recent. A CPU of a variant runs the images of the older ones.
+var armVariants = []string{"v8", "v7", "v6", "v5"}
+
+// DefaultPlatform returns the platform of the daemon, which is the one the
+// images are pulled for unless another one is requested.
+func DefaultPlatform() manifestlist.PlatformSpec {
+	p := manifestlist.PlatformSpec{
+		OS:           runtime.GOOS,
+		Architecture: runtime.GOARCH,
+	}
+	if p.Architecture == "arm" {
+		// The variant is given by the machine name of the kernel, such
+		// as armv7l, or aarch64 for a 32 bits daemon on a 64 bits kernel.
+		machine := strings.ToLower(platform.Architecture)
+		switch {
+		case machine == "aarch64" || strings.HasPrefix(machine, "armv8"):
+			p.Variant = "v8"
+		case strings.HasPrefix(machine, "armv7"):
+			p.Variant = "v7"
+		case strings.HasPrefix(machine, "armv6"):
+			p.Variant = "v6"
+		case strings.HasPrefix(machine, "armv5"):
+			p.Variant = "v5"
+		}
+	}
+	return p
+}
+
+// ParsePlatform parses a platform of the form os/architecture[/variant],
+// such as linux/arm/v7.
+func ParsePlatform(s string) (manifestlist.PlatformSpec, error) {
+	parts := strings.Split(strings.ToLower(s), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return manifestlist.PlatformSpec{}, fmt.Errorf("invalid platform %q: the format is os/architecture[/variant]", s)
+	}
+	p := manifestlist.PlatformSpec{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		if parts[2] == "" {
+			return manifestlist.PlatformSpec{}, fmt.Errorf("invalid platform %q: empty variant", s)
+		}
+		p.Variant = parts[2]
+	}
+	p.Architecture, p.Variant = normalizeArchitecture(p.Architecture, p.Variant)
+	return p, nil
+}
+
+// normalizeArchitecture returns the GOARCH name of the architecture arch
+// and its variant, arch possibly being the machine name of a kernel or a
+// Debian architecture.
+func normalizeArchitecture(arch, variant string) (string, string) {
+	switch arch {
+	case "x86_64", "x86-64":
+		return "amd64", variant
+	case "i386":
+		return "386", variant
+	case "aarch64", "arm64":
+		// arm64 only has the v8 variant.
+		if variant == "v8" {
+			variant = ""
+		}
+		return "arm64", variant
+	case "armhf":
+		return "arm", "v7"
+	case "armel":
+		return "arm", "v6"
+	}
+	return arch, variant
+}
+
+// platformString returns p as os/architecture[/variant].
+func platformString(p manifestlist.PlatformSpec) string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// selectManifest returns the entry of the manifest list manifests which
+// runs on the platform p. An entry of the same variant is preferred, then
+// one of the most recent older variant p runs, and then one without
+// variant. If p has no variant, the entries without variant are preferred.
+func selectManifest(manifests []manifestlist.ManifestDescriptor, p manifestlist.PlatformSpec) (manifestlist.ManifestDescriptor, bool) {
+	variants := []string{p.Variant}
+	if p.Architecture == "arm" {
+		for i, v := range armVariants {
+			if v == p.Variant {
+				variants = armVariants[i:]
+				break
+			}
+		}
+	}
+
+	var (
+		selected manifestlist.ManifestDescriptor
+		rank     = -1
+	)
+	for _, m := range manifests {
+		arch, variant := normalizeArchitecture(m.Platform.Architecture, m.Platform.Variant)
+		if m.Platform.OS != p.OS || arch != p.Architecture {
+			continue
+		}
+		// The lower the rank, the better the match.
+		r := -1
+		for i, v := range variants {
+			if v == variant {
+				r = i
+				break
+			}
+		}
+		if r == -1 {
+			if variant != "" && p.Variant != "" {
+				continue
+			}
+			// Entries without variant match any variant, and any
+			// variant matches a platform without variant.
+			r = len(variants)
+		}
+		if rank == -1 || r < rank {
+			selected, rank = m, r
+		}
+	}
+	return selected, rank != -1
+}
@@ -0,0 +1,92 @@
+package distribution
+
+import (
+	"testing"
+
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+)
+
+func TestParsePlatform(t *testing.T) {
+	valid := map[string]manifestlist.PlatformSpec{
+		"linux/amd64":      {OS: "linux", Architecture: "amd64"},
+		"Linux/x86_64":     {OS: "linux", Architecture: "amd64"},
+		"linux/arm/v7":     {OS: "linux", Architecture: "arm", Variant: "v7"},
+		"linux/armhf":      {OS: "linux", Architecture: "arm", Variant: "v7"},
+		"linux/aarch64":    {OS: "linux", Architecture: "arm64"},
+		"linux/arm64/v8":   {OS: "linux", Architecture: "arm64"},
+		"windows/amd64":    {OS: "windows", Architecture: "amd64"},
+		"linux/ppc64le/v2": {OS: "linux", Architecture: "ppc64le", Variant: "v2"},
+	}
+	for s, expected := range valid {
+		p, err := ParsePlatform(s)
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %v", s, err)
+		}
+		if p.OS != expected.OS || p.Architecture != expected.Architecture || p.Variant != expected.Variant {
+			t.Fatalf("Expected %q to parse as %+v, got %+v", s, expected, p)
+		}
+	}
+
+	for _, s := range []string{"", "linux", "linux/", "/amd64", "linux/arm/", "linux/arm/v7/extra"} {
+		if _, err := ParsePlatform(s); err == nil {
+			t.Fatalf("Expected an error for %q", s)
+		}
+	}
+}
+
+func TestSelectManifest(t *testing.T) {
+	entry := func(os, arch, variant string) manifestlist.ManifestDescriptor {
+		m := manifestlist.ManifestDescriptor{
+			Platform: manifestlist.PlatformSpec{OS: os, Architecture: arch, Variant: variant},
+		}
+		m.Digest = digest.FromBytes([]byte(os + arch + variant))
+		return m
+	}
+	manifests := []manifestlist.ManifestDescriptor{
+		entry("linux", "amd64", ""),
+		entry("linux", "arm", "v5"),
+		entry("linux", "arm", "v6"),
+		entry("linux", "arm", "v8"),
+		entry("linux", "arm64", "v8"),
+		entry("windows", "amd64", ""),
+	}
+
+	cases := []struct {
+		platform manifestlist.PlatformSpec
+		expected manifestlist.ManifestDescriptor
+	}{
+		{manifestlist.PlatformSpec{OS: "linux", Architecture: "amd64"}, manifests[0]},
+		{manifestlist.PlatformSpec{OS: "windows", Architecture: "amd64"}, manifests[5]},
+		{manifestlist.PlatformSpec{OS: "linux", Architecture: "arm", Variant: "v7"}, manifests[2]},
+		{manifestlist.PlatformSpec{OS: "linux", Architecture: "arm", Variant: "v6"}, manifests[2]},
+		{manifestlist.PlatformSpec{OS: "linux", Architecture: "arm", Variant: "v8"}, manifests[3]},
+		{manifestlist.PlatformSpec{OS: "linux", Architecture: "arm"}, manifests[1]},
+		{manifestlist.PlatformSpec{OS: "linux", Architecture: "arm64"}, manifests[4]},
+	}
+	for _, c := range cases {
+		m, ok := selectManifest(manifests, c.platform)
+		if !ok {
+			t.Fatalf("Expected a manifest for %+v", c.platform)
+		}
+		if m.Digest != c.expected.Digest {
+			t.Fatalf("Expected %+v for %+v, got %+v", c.expected.Platform, c.platform, m.Platform)
+		}
+	}
+
+	for _, p := range []manifestlist.PlatformSpec{
+		{OS: "linux", Architecture: "arm", Variant: "v4"},
+		{OS: "linux", Architecture: "s390x"},
+		{OS: "solaris", Architecture: "amd64"},
+	} {
+		if m, ok := selectManifest(manifests, p); ok {
+			t.Fatalf("Expected no manifest for %+v, got %+v", p, m.Platform)
+		}
+	}
+
+	// An entry without variant runs on any variant.
+	manifests = []manifestlist.ManifestDescriptor{entry("linux", "arm", "v8"), entry("linux", "arm", "")}
+	if m, ok := selectManifest(manifests, manifestlist.PlatformSpec{OS: "linux", Architecture: "arm", Variant: "v7"}); !ok || m.Digest != manifests[1].Digest {
+		t.Fatalf("Expected the entry without variant, got %+v", m.Platform)
+	}
+}
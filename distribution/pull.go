@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/docker/distribution/manifest/manifestlist"
 	"github.com/docker/docker/api"
 	"github.com/docker/docker/distribution/metadata"
 	"github.com/docker/docker/distribution/xfer"
@@ -39,6 +40,13 @@ type ImagePullConfig struct {
 	ReferenceStore reference.Store
 	// DownloadManager manages concurrent pulls.
 	DownloadManager *xfer.LayerDownloadManager
+	// Platform is the platform the entry of manifest lists is selected
+	// for, the platform of the daemon if nil.
+	Platform *manifestlist.PlatformSpec
+	// DownloadDir is the directory the layers are downloaded to, where
+	// the interrupted downloads are kept to be resumed by the next pulls.
+	// The layers are downloaded to temporary files if it is empty.
+	DownloadDir string
 }
 
 // Puller is an interface that abstracts pulling for different API versions.
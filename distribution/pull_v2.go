@@ -51,6 +51,9 @@ type v2Puller struct {
 	config            *ImagePullConfig
 	repoInfo          *registry.RepositoryInfo
 	repo              distribution.Repository
+	// hmacKey is the key of the credentials of the pull, which tags the
+	// metadata of the layers pulled with them.
+	hmacKey []byte
 	// confirmedV2 is set to true if we confirm we're talking to a v2
 	// registry. This is used to limit fallbacks to the v1 protocol.
 	confirmedV2 bool
@@ -64,6 +67,11 @@ func (p *v2Puller) Pull(ctx context.Context, ref reference.Named) (err error) {
 		return err
 	}
 
+	p.hmacKey, err = metadata.ComputeV2MetadataHMACKey(p.config.AuthConfig)
+	if err != nil {
+		return err
+	}
+
 	if err = p.pullV2Repository(ctx, ref); err != nil {
 		if _, ok := err.(fallbackError); ok {
 			return err
@@ -131,9 +139,15 @@ type v2LayerDescriptor struct {
 	repoInfo          *registry.RepositoryInfo
 	repo              distribution.Repository
 	V2MetadataService *metadata.V2MetadataService
+	hmacKey           []byte
 	tmpFile           *os.File
 	verifier          digest.Verifier
 	src               distribution.Descriptor
+	// downloadDir is the directory of the partial downloads, which are
+	// kept when the download fails to be resumed by the next pull.
+	downloadDir string
+	// partial is set if tmpFile is a partial download of downloadDir.
+	partial bool
 }
 
 func (ld *v2LayerDescriptor) Key() string {
@@ -144,6 +158,10 @@ func (ld *v2LayerDescriptor) ID() string {
 	return stringid.TruncateID(ld.digest.String())
 }
 
+func (ld *v2LayerDescriptor) Digest() digest.Digest {
+	return ld.digest
+}
+
 func (ld *v2LayerDescriptor) DiffID() (layer.DiffID, error) {
 	return ld.V2MetadataService.GetDiffID(ld.digest)
 }
@@ -157,20 +175,30 @@ func (ld *v2LayerDescriptor) Download(ctx context.Context, progressOutput progre
 	)
 
 	if ld.tmpFile == nil {
-		ld.tmpFile, err = createDownloadFile()
+		if ld.downloadDir != "" {
+			offset, err = ld.openPartialDownload()
+			if err == errPartialDownloadBusy {
+				// The download can't be resumed by later pulls.
+				logrus.Debugf("partial download of %q is in use, downloading to a temporary file", ld.digest)
+				ld.tmpFile, err = createDownloadFile()
+			}
+		} else {
+			ld.tmpFile, err = createDownloadFile()
+		}
 		if err != nil {
 			return nil, 0, xfer.DoNotRetry{Err: err}
 		}
+		if offset != 0 {
+			logrus.Debugf("attempting to resume download of %q from %d bytes of a previous pull", ld.digest, offset)
+		}
 	} else {
 		offset, err = ld.tmpFile.Seek(0, os.SEEK_END)
 		if err != nil {
 			logrus.Debugf("error seeking to end of download file: %v", err)
 			offset = 0
 
-			ld.tmpFile.Close()
-			if err := os.Remove(ld.tmpFile.Name()); err != nil {
-				logrus.Errorf("Failed to remove temp file: %s", ld.tmpFile.Name())
-			}
+			closeDownloadFile(ld.tmpFile, ld.partial, true)
+			ld.partial = false
 			ld.tmpFile, err = createDownloadFile()
 			if err != nil {
 				return nil, 0, xfer.DoNotRetry{Err: err}
@@ -182,6 +210,13 @@ func (ld *v2LayerDescriptor) Download(ctx context.Context, progressOutput progre
 
 	tmpFile := ld.tmpFile
 
+	// The partial download of a previous pull may be complete already, if
+	// the daemon stopped before the layer was registered.
+	if offset != 0 && ld.verifier != nil && ld.verifier.Verified() {
+		progress.Update(progressOutput, ld.ID(), "Download complete")
+		return ld.handOffDownloadFile(offset)
+	}
+
 	layerDownload, err := ld.open(ctx)
 	if err != nil {
 		logrus.Errorf("Error initiating layer download: %v", err)
@@ -260,6 +295,12 @@ func (ld *v2LayerDescriptor) Download(ctx context.Context, progressOutput progre
 
 			return nil, 0, err
 		}
+		// Don't let the next pulls resume a corrupted download.
+		if ld.partial {
+			if err := ld.truncateDownloadFile(); err != nil {
+				logrus.Errorf("Failed to truncate partial download %s: %v", ld.tmpFile.Name(), err)
+			}
+		}
 		return nil, 0, xfer.DoNotRetry{Err: err}
 	}
 
@@ -267,13 +308,19 @@ func (ld *v2LayerDescriptor) Download(ctx context.Context, progressOutput progre
 
 	logrus.Debugf("Downloaded %s to tempfile %s", ld.ID(), tmpFile.Name())
 
-	_, err = tmpFile.Seek(0, os.SEEK_SET)
+	return ld.handOffDownloadFile(size)
+}
+
+// handOffDownloadFile returns the verified download file, which is removed
+// once the download manager closes it.
+func (ld *v2LayerDescriptor) handOffDownloadFile(size int64) (io.ReadCloser, int64, error) {
+	tmpFile, partial := ld.tmpFile, ld.partial
+
+	_, err := tmpFile.Seek(0, os.SEEK_SET)
 	if err != nil {
-		tmpFile.Close()
-		if err := os.Remove(tmpFile.Name()); err != nil {
-			logrus.Errorf("Failed to remove temp file: %s", tmpFile.Name())
-		}
+		closeDownloadFile(tmpFile, partial, true)
 		ld.tmpFile = nil
+		ld.partial = false
 		ld.verifier = nil
 		return nil, 0, xfer.DoNotRetry{Err: err}
 	}
@@ -281,26 +328,43 @@ func (ld *v2LayerDescriptor) Download(ctx context.Context, progressOutput progre
 	// hand off the temporary file to the download manager, so it will only
 	// be closed once
 	ld.tmpFile = nil
+	ld.partial = false
 
 	return ioutils.NewReadCloserWrapper(tmpFile, func() error {
-		tmpFile.Close()
-		err := os.RemoveAll(tmpFile.Name())
-		if err != nil {
-			logrus.Errorf("Failed to remove temp file: %s", tmpFile.Name())
-		}
-		return err
+		return closeDownloadFile(tmpFile, partial, true)
 	}), size, nil
 }
 
 func (ld *v2LayerDescriptor) Close() {
 	if ld.tmpFile != nil {
-		ld.tmpFile.Close()
-		if err := os.RemoveAll(ld.tmpFile.Name()); err != nil {
-			logrus.Errorf("Failed to remove temp file: %s", ld.tmpFile.Name())
-		}
+		// A partial download is kept for the next pull to resume it.
+		closeDownloadFile(ld.tmpFile, ld.partial, !ld.partial)
 	}
 }
 
+// openPartialDownload opens the partial download of the layer in
+// downloadDir as the download file, and returns its size. The verifier is
+// fed with the bytes already downloaded.
+func (ld *v2LayerDescriptor) openPartialDownload() (int64, error) {
+	f, err := openPartialDownloadFile(ld.downloadDir, ld.digest)
+	if err != nil {
+		return 0, err
+	}
+	verifier, err := digest.NewDigestVerifier(ld.digest)
+	if err != nil {
+		closePartialDownloadFile(f, false)
+		return 0, err
+	}
+	ld.tmpFile, ld.partial, ld.verifier = f, true, verifier
+
+	offset, err := io.Copy(verifier, f)
+	if err != nil {
+		logrus.Debugf("error reading partial download of %q: %v", ld.digest, err)
+		return 0, ld.truncateDownloadFile()
+	}
+	return offset, nil
+}
+
 func (ld *v2LayerDescriptor) truncateDownloadFile() error {
 	// Need a new hash context since we will be redoing the download
 	ld.verifier = nil
@@ -320,7 +384,7 @@ func (ld *v2LayerDescriptor) truncateDownloadFile() error {
 
 func (ld *v2LayerDescriptor) Registered(diffID layer.DiffID) {
 	// Cache mapping from this layer's DiffID to the blobsum
-	ld.V2MetadataService.Add(diffID, metadata.V2Metadata{Digest: ld.digest, SourceRepository: ld.repoInfo.FullName()})
+	ld.V2MetadataService.AddWithHMAC(diffID, ld.hmacKey, metadata.V2Metadata{Digest: ld.digest, SourceRepository: ld.repoInfo.FullName()})
 }
 
 func (p *v2Puller) pullV2Tag(ctx context.Context, ref reference.Named) (tagUpdated bool, err error) {
@@ -461,6 +525,8 @@ func (p *v2Puller) pullSchema1(ctx context.Context, ref reference.Named, unverif
 			repoInfo:          p.repoInfo,
 			repo:              p.repo,
 			V2MetadataService: p.V2MetadataService,
+			hmacKey:           p.hmacKey,
+			downloadDir:       p.config.DownloadDir,
 		}
 
 		descriptors = append(descriptors, layerDescriptor)
@@ -511,7 +577,9 @@ func (p *v2Puller) pullSchema2(ctx context.Context, ref reference.Named, mfst *s
 			repo:              p.repo,
 			repoInfo:          p.repoInfo,
 			V2MetadataService: p.V2MetadataService,
+			hmacKey:           p.hmacKey,
 			src:               d,
+			downloadDir:       p.config.DownloadDir,
 		}
 
 		descriptors = append(descriptors, layerDescriptor)
@@ -623,20 +691,19 @@ func (p *v2Puller) pullManifestList(ctx context.Context, ref reference.Named, mf
 		return "", "", err
 	}
 
-	var manifestDigest digest.Digest
-	for _, manifestDescriptor := range mfstList.Manifests {
-		// TODO(aaronl): The manifest list spec supports optional
-		// "features" and "variant" fields. These are not yet used.
-		// Once they are, their values should be interpreted here.
-		if manifestDescriptor.Platform.Architecture == runtime.GOARCH && manifestDescriptor.Platform.OS == runtime.GOOS {
-			manifestDigest = manifestDescriptor.Digest
-			break
-		}
+	platform := DefaultPlatform()
+	if p.config.Platform != nil {
+		platform = *p.config.Platform
 	}
-
-	if manifestDigest == "" {
-		return "", "", errors.New("no supported platform found in manifest list")
+	// TODO(aaronl): The manifest list spec supports optional "features"
+	// fields. These are not yet used. Once they are, their values should
+	// be interpreted here.
+	manifestDescriptor, ok := selectManifest(mfstList.Manifests, platform)
+	if !ok {
+		return "", "", fmt.Errorf("no matching manifest for %s in the manifest list entries", platformString(platform))
 	}
+	manifestDigest := manifestDescriptor.Digest
+	logrus.Debugf("%s resolved to %s for platform %s", manifestListDigest, manifestDigest, platformString(manifestDescriptor.Platform))
 
 	manSvc, err := p.repo.Manifests(ctx)
 	if err != nil {
@@ -668,6 +735,10 @@ func (p *v2Puller) pullManifestList(ctx context.Context, ref reference.Named, mf
 		return "", "", errors.New("unsupported manifest format")
 	}
 
+	if err := metadata.NewPlatformService(p.config.MetadataStore).Set(imageID, manifestDescriptor.Platform); err != nil {
+		return "", "", err
+	}
+
 	return imageID, manifestListDigest, err
 }
 
@@ -48,6 +48,9 @@ type ImagePushConfig struct {
 	TrustKey libtrust.PrivateKey
 	// UploadManager dispatches uploads.
 	UploadManager *xfer.LayerUploadManager
+	// UploadChunkSize is the size of the chunks layers are uploaded in,
+	// or 0 to upload them as a single stream.
+	UploadChunkSize int64
 }
 
 // Pusher is an interface that abstracts pushing for different API versions.
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"sync"
 
 	"github.com/Sirupsen/logrus"
@@ -13,6 +14,7 @@ import (
 	"github.com/docker/distribution/manifest/schema2"
 	distreference "github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/client"
+	"github.com/docker/distribution/registry/client/auth"
 	"github.com/docker/docker/distribution/metadata"
 	"github.com/docker/docker/distribution/xfer"
 	"github.com/docker/docker/image"
@@ -41,6 +43,13 @@ type v2Pusher struct {
 	repoInfo          *registry.RepositoryInfo
 	config            *ImagePushConfig
 	repo              distribution.Repository
+	// transport is the transport of repo.
+	transport http.RoundTripper
+	// hmacKey is the key of the credentials of the push, which tags the
+	// metadata of the layers pushed with them, and anonymousHMACKey the
+	// one of anonymous requests.
+	hmacKey          []byte
+	anonymousHMACKey []byte
 
 	// pushState is state built by the Upload functions.
 	pushState pushState
@@ -56,12 +65,26 @@ type pushState struct {
 	// confirmedV2 is set to true if we confirm we're talking to a v2
 	// registry. This is used to limit fallbacks to the v1 protocol.
 	confirmedV2 bool
+	// mountRepo is the repository authorized to mount blobs from the
+	// repositories of the registry in mountSources, and mountTransport
+	// its transport.
+	mountRepo      distribution.Repository
+	mountTransport http.RoundTripper
+	mountSources   map[string]bool
 }
 
 func (p *v2Pusher) Push(ctx context.Context) (err error) {
 	p.pushState.remoteLayers = make(map[layer.DiffID]distribution.Descriptor)
+	p.pushState.mountSources = make(map[string]bool)
 
-	p.repo, p.pushState.confirmedV2, err = NewV2Repository(ctx, p.repoInfo, p.endpoint, p.config.MetaHeaders, p.config.AuthConfig, "push", "pull")
+	if p.hmacKey, err = metadata.ComputeV2MetadataHMACKey(p.config.AuthConfig); err != nil {
+		return err
+	}
+	if p.anonymousHMACKey, err = metadata.ComputeV2MetadataHMACKey(nil); err != nil {
+		return err
+	}
+
+	p.repo, p.pushState.confirmedV2, p.transport, err = newV2Repository(ctx, p.repoInfo, p.endpoint, p.config.MetaHeaders, p.config.AuthConfig, nil, "push", "pull")
 	if err != nil {
 		logrus.Debugf("Error getting v2 registry: %v", err)
 		return err
@@ -137,7 +160,12 @@ func (p *v2Pusher) pushV2Tag(ctx context.Context, ref reference.NamedTagged, ima
 	descriptorTemplate := v2PushDescriptor{
 		v2MetadataService: p.v2MetadataService,
 		repoInfo:          p.repoInfo,
+		endpoint:          p.endpoint,
+		config:            p.config,
 		repo:              p.repo,
+		transport:         p.transport,
+		hmacKey:           p.hmacKey,
+		anonymousHMACKey:  p.anonymousHMACKey,
 		pushState:         &p.pushState,
 	}
 
@@ -150,6 +178,8 @@ func (p *v2Pusher) pushV2Tag(ctx context.Context, ref reference.NamedTagged, ima
 		l = l.Parent()
 	}
 
+	p.authorizeMounts(ctx, descriptors)
+
 	if err := p.config.UploadManager.Upload(ctx, descriptors, p.config.ProgressOutput); err != nil {
 		return err
 	}
@@ -218,13 +248,97 @@ func manifestFromBuilder(ctx context.Context, builder distribution.ManifestBuild
 	return builder.Build(ctx)
 }
 
+// authorizeMounts authorizes the pushes of descriptors to mount their layers
+// from the repositories they are mount candidates of, with one token for
+// all of them, at most maxMountRepositories. Without it, the layers are
+// uploaded.
+func (p *v2Pusher) authorizeMounts(ctx context.Context, descriptors []xfer.UploadDescriptor) {
+	p.pushState.Lock()
+	sources := make(map[string]bool, len(p.pushState.mountSources))
+	for source := range p.pushState.mountSources {
+		sources[source] = true
+	}
+	var candidates []mountCandidate
+	for _, d := range descriptors {
+		pd := d.(*v2PushDescriptor)
+		if _, ok := p.pushState.remoteLayers[pd.DiffID()]; ok {
+			continue
+		}
+		v2Metadata, err := p.v2MetadataService.GetMetadata(pd.DiffID())
+		if err != nil {
+			v2Metadata = nil
+		}
+		candidates = append(candidates, pd.mountCandidates(v2Metadata)...)
+	}
+	p.pushState.Unlock()
+
+	added := false
+	for _, candidate := range candidates {
+		if len(sources) == maxMountRepositories {
+			break
+		}
+		if !sources[candidate.SourceRepository] {
+			sources[candidate.SourceRepository] = true
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+
+	var scopes []auth.Scope
+	for source := range sources {
+		sourceRepo, err := reference.ParseNamed(source)
+		if err != nil {
+			delete(sources, source)
+			continue
+		}
+		scopes = append(scopes, auth.RepositoryScope{
+			Repository: repoScopeName(sourceRepo, p.endpoint),
+			Actions:    []string{"pull"},
+		})
+	}
+	repo, _, tr, err := newV2Repository(ctx, p.repoInfo, p.endpoint, p.config.MetaHeaders, p.config.AuthConfig, scopes, "push", "pull")
+	if err != nil {
+		logrus.Debugf("failed to get a repository to mount layers from: %v", err)
+		return
+	}
+
+	p.pushState.Lock()
+	p.pushState.mountRepo = repo
+	p.pushState.mountTransport = tr
+	p.pushState.mountSources = sources
+	p.pushState.Unlock()
+}
+
+// maxMountAttempts is the number of repositories of the registry which a
+// layer is mounted from before being uploaded, including at most
+// maxKnownMountAttempts repositories where the daemon saw its blob, and
+// maxMountRepositories the number of repositories a push is authorized to
+// mount layers from.
+const (
+	maxMountAttempts      = 5
+	maxKnownMountAttempts = 3
+	maxMountRepositories  = 15
+)
+
 type v2PushDescriptor struct {
 	layer             layer.Layer
 	v2MetadataService *metadata.V2MetadataService
-	repoInfo          reference.Named
+	repoInfo          *registry.RepositoryInfo
+	endpoint          registry.APIEndpoint
+	config            *ImagePushConfig
 	repo              distribution.Repository
+	transport         http.RoundTripper
+	hmacKey           []byte
+	anonymousHMACKey  []byte
 	pushState         *pushState
 	remoteDescriptor  distribution.Descriptor
+	// uploadSession is the chunked upload session of the layer, kept
+	// to resume the upload when it is retried, from spool, the
+	// compressed stream of the layer.
+	uploadSession *blobUploadSession
+	spool         *layerSpool
 }
 
 func (pd *v2PushDescriptor) Key() string {
@@ -280,29 +394,21 @@ func (pd *v2PushDescriptor) Upload(ctx context.Context, progressOutput progress.
 
 	// if digest was empty or not saved, or if blob does not exist on the remote repository,
 	// then push the blob.
-	bs := pd.repo.Blobs(ctx)
-
 	var layerUpload distribution.BlobWriter
-	mountAttemptsRemaining := 3
 
 	// Attempt to find another repository in the same registry to mount the layer
 	// from to avoid an unnecessary upload.
-	// Note: metadata is stored from oldest to newest, so we iterate through this
-	// slice in reverse to maximize our chances of the blob still existing in the
-	// remote repository.
-	for i := len(v2Metadata) - 1; i >= 0 && mountAttemptsRemaining > 0; i-- {
-		mountFrom := v2Metadata[i]
-
-		sourceRepo, err := reference.ParseNamed(mountFrom.SourceRepository)
-		if err != nil {
-			continue
+	pd.pushState.Lock()
+	mountRepo, mountTransport, mountSources := pd.pushState.mountRepo, pd.pushState.mountTransport, pd.pushState.mountSources
+	pd.pushState.Unlock()
+	for _, mountFrom := range pd.mountCandidates(v2Metadata) {
+		if mountRepo == nil || layerUpload != nil {
+			break
 		}
-		if pd.repoInfo.Hostname() != sourceRepo.Hostname() {
-			// don't mount blobs from another registry
+		if !mountSources[mountFrom.SourceRepository] {
 			continue
 		}
-
-		namedRef, err := reference.WithName(mountFrom.SourceRepository)
+		sourceRepo, err := reference.ParseNamed(mountFrom.SourceRepository)
 		if err != nil {
 			continue
 		}
@@ -310,7 +416,7 @@ func (pd *v2PushDescriptor) Upload(ctx context.Context, progressOutput progress.
 		// TODO (brianbland): We need to construct a reference where the Name is
 		// only the full remote name, so clean this up when distribution has a
 		// richer reference package
-		remoteRef, err := distreference.WithName(namedRef.RemoteName())
+		remoteRef, err := distreference.WithName(sourceRepo.RemoteName())
 		if err != nil {
 			continue
 		}
@@ -320,9 +426,21 @@ func (pd *v2PushDescriptor) Upload(ctx context.Context, progressOutput progress.
 			continue
 		}
 
+		// Check that the blob can be pulled from the repository first,
+		// since a failed mount starts an upload session.
+		if err := pd.statMountSource(ctx, sourceRepo, mountFrom.Digest, mountTransport); err != nil {
+			logrus.Debugf("not mounting layer %s (%s) from %s: %v", diffID, mountFrom.Digest, sourceRepo.FullName(), err)
+			if mountFrom.known && err == distribution.ErrBlobUnknown {
+				// the blob is no longer in this repository, so this source mapping is no longer valid
+				logrus.Debugf("unassociating layer %s (%s) with %s", diffID, mountFrom.Digest, mountFrom.SourceRepository)
+				pd.v2MetadataService.Remove(mountFrom.V2Metadata)
+			}
+			continue
+		}
+
 		logrus.Debugf("attempting to mount layer %s (%s) from %s", diffID, mountFrom.Digest, sourceRepo.FullName())
 
-		layerUpload, err = bs.Create(ctx, client.WithMountFrom(canonicalRef))
+		upload, err := mountRepo.Blobs(ctx).Create(ctx, client.WithMountFrom(canonicalRef))
 		switch err := err.(type) {
 		case distribution.ErrBlobMounted:
 			progress.Updatef(progressOutput, pd.ID(), "Mounted from %s", err.From.Name())
@@ -335,32 +453,69 @@ func (pd *v2PushDescriptor) Upload(ctx context.Context, progressOutput progress.
 			pd.pushState.Unlock()
 
 			// Cache mapping from this layer's DiffID to the blobsum
-			if err := pd.v2MetadataService.Add(diffID, metadata.V2Metadata{Digest: mountFrom.Digest, SourceRepository: pd.repoInfo.FullName()}); err != nil {
+			if err := pd.v2MetadataService.AddWithHMAC(diffID, pd.hmacKey, metadata.V2Metadata{Digest: mountFrom.Digest, SourceRepository: pd.repoInfo.FullName()}); err != nil {
 				return distribution.Descriptor{}, xfer.DoNotRetry{Err: err}
 			}
 			return err.Descriptor, nil
 		case nil:
-			// blob upload session created successfully, so begin the upload
-			mountAttemptsRemaining = 0
+			// the registry started an upload session instead, e.g. if
+			// it doesn't support mounts, so upload the layer with it
+			layerUpload = upload
 		default:
-			// unable to mount layer from this repository, so this source mapping is no longer valid
-			logrus.Debugf("unassociating layer %s (%s) with %s", diffID, mountFrom.Digest, mountFrom.SourceRepository)
-			pd.v2MetadataService.Remove(mountFrom)
-			mountAttemptsRemaining--
+			logrus.Debugf("failed to mount layer %s (%s) from %s: %v", diffID, mountFrom.Digest, sourceRepo.FullName(), err)
 		}
 	}
 
-	if layerUpload == nil {
-		layerUpload, err = bs.Create(ctx)
-		if err != nil {
-			return distribution.Descriptor{}, retryOnError(err)
+	var (
+		pushDigest digest.Digest
+		nn         int64
+	)
+	if pd.config.UploadChunkSize > 0 {
+		if layerUpload != nil {
+			// the chunked upload uses its own upload session
+			layerUpload.Cancel(ctx)
+			layerUpload.Close()
 		}
+		pushDigest, nn, err = pd.uploadChunked(ctx, progressOutput)
+	} else {
+		pushDigest, nn, err = pd.uploadStream(ctx, progressOutput, layerUpload)
 	}
-	defer layerUpload.Close()
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	logrus.Debugf("uploaded layer %s (%s), %d bytes", diffID, pushDigest, nn)
+	progress.Update(progressOutput, pd.ID(), "Pushed")
+
+	// Cache mapping from this layer's DiffID to the blobsum
+	if err := pd.v2MetadataService.AddWithHMAC(diffID, pd.hmacKey, metadata.V2Metadata{Digest: pushDigest, SourceRepository: pd.repoInfo.FullName()}); err != nil {
+		return distribution.Descriptor{}, xfer.DoNotRetry{Err: err}
+	}
+
+	pd.pushState.Lock()
+
+	// If Commit succeeded, that's an indication that the remote registry
+	// speaks the v2 protocol.
+	pd.pushState.confirmedV2 = true
+
+	descriptor := distribution.Descriptor{
+		Digest:    pushDigest,
+		MediaType: schema2.MediaTypeLayer,
+		Size:      nn,
+	}
+	pd.pushState.remoteLayers[diffID] = descriptor
+
+	pd.pushState.Unlock()
+
+	return descriptor, nil
+}
 
+// layerStream returns the compressed tar stream of the layer, and a function
+// to call once done reading it.
+func (pd *v2PushDescriptor) layerStream(ctx context.Context, progressOutput progress.Output) (io.Reader, func(), error) {
 	arch, err := pd.layer.TarStream()
 	if err != nil {
-		return distribution.Descriptor{}, xfer.DoNotRetry{Err: err}
+		return nil, nil, xfer.DoNotRetry{Err: err}
 	}
 
 	// don't care if this fails; best effort
@@ -368,49 +523,220 @@ func (pd *v2PushDescriptor) Upload(ctx context.Context, progressOutput progress.
 
 	reader := progress.NewProgressReader(ioutils.NewCancelReadCloser(ctx, arch), progressOutput, size, pd.ID(), "Pushing")
 	compressedReader, compressionDone := compress(reader)
-	defer func() {
+	return compressedReader, func() {
+		compressedReader.Close()
 		reader.Close()
 		<-compressionDone
-	}()
+	}, nil
+}
+
+// uploadStream uploads the layer as a single stream to layerUpload, or to a
+// new upload session if layerUpload is nil, and returns its digest and size.
+func (pd *v2PushDescriptor) uploadStream(ctx context.Context, progressOutput progress.Output, layerUpload distribution.BlobWriter) (digest.Digest, int64, error) {
+	if layerUpload == nil {
+		var err error
+		layerUpload, err = pd.repo.Blobs(ctx).Create(ctx)
+		if err != nil {
+			return "", 0, retryOnError(err)
+		}
+	}
+	defer layerUpload.Close()
+
+	compressedReader, done, err := pd.layerStream(ctx, progressOutput)
+	if err != nil {
+		return "", 0, err
+	}
+	defer done()
 
 	digester := digest.Canonical.New()
 	tee := io.TeeReader(compressedReader, digester.Hash())
 
 	nn, err := layerUpload.ReadFrom(tee)
-	compressedReader.Close()
 	if err != nil {
-		return distribution.Descriptor{}, retryOnError(err)
+		return "", 0, retryOnError(err)
 	}
 
 	pushDigest := digester.Digest()
 	if _, err := layerUpload.Commit(ctx, distribution.Descriptor{Digest: pushDigest}); err != nil {
-		return distribution.Descriptor{}, retryOnError(err)
+		return "", 0, retryOnError(err)
 	}
+	return pushDigest, nn, nil
+}
 
-	logrus.Debugf("uploaded layer %s (%s), %d bytes", diffID, pushDigest, nn)
-	progress.Update(progressOutput, pd.ID(), "Pushed")
+// uploadChunked uploads the layer in chunks of the upload chunk size, and
+// returns its digest and size. The chunks are uploaded while the rest of the
+// layer is compressed; the compressed layer is kept until the upload is
+// released, so that an interrupted upload is resumed from the last chunk the
+// registry received without compressing the layer again.
+func (pd *v2PushDescriptor) uploadChunked(ctx context.Context, progressOutput progress.Output) (digest.Digest, int64, error) {
+	if pd.spool == nil {
+		compressedReader, done, err := pd.layerStream(ctx, progressOutput)
+		if err != nil {
+			return "", 0, err
+		}
+		if pd.spool, err = newLayerSpool(compressedReader, done); err != nil {
+			return "", 0, xfer.DoNotRetry{Err: err}
+		}
+		// a session of a previous stream can't be resumed from this one
+		pd.uploadSession = nil
+	}
 
-	// Cache mapping from this layer's DiffID to the blobsum
-	if err := pd.v2MetadataService.Add(diffID, metadata.V2Metadata{Digest: pushDigest, SourceRepository: pd.repoInfo.FullName()}); err != nil {
-		return distribution.Descriptor{}, xfer.DoNotRetry{Err: err}
+	session := pd.uploadSession
+	if session != nil {
+		if err := session.status(ctx); err != nil {
+			logrus.Debugf("cannot resume the upload of layer %s: %v", pd.DiffID(), err)
+			session = nil
+		} else if session.offset > 0 {
+			logrus.Debugf("resuming the upload of layer %s at offset %d", pd.DiffID(), session.offset)
+		}
+	}
+	if session == nil {
+		var err error
+		session, err = startBlobUploadSession(ctx, pd.transport, pd.endpoint, pd.repo.Named())
+		if err != nil {
+			return "", 0, retryOnError(err)
+		}
+		pd.uploadSession = session
 	}
 
-	pd.pushState.Lock()
+	nn, err := session.upload(ctx, pd.spool, pd.config.UploadChunkSize)
+	if err != nil {
+		if pd.spool.failed() != nil {
+			// the layer must be compressed again, in a new session
+			pd.spool.close()
+			pd.spool = nil
+			pd.uploadSession = nil
+		} else if err == distribution.ErrBlobUploadUnknown || err == errBlobUploadRewound {
+			pd.uploadSession = nil
+		}
+		return "", 0, retryOnError(err)
+	}
 
-	// If Commit succeeded, that's an indication that the remote registry
-	// speaks the v2 protocol.
-	pd.pushState.confirmedV2 = true
+	// A session can't be committed again, e.g. if the registry corrupted
+	// the blob.
+	pd.uploadSession = nil
+	pushDigest, _, err := pd.spool.result()
+	if err != nil {
+		return "", 0, retryOnError(err)
+	}
+	if err := session.commit(ctx, pushDigest); err != nil {
+		session.cancel(ctx)
+		return "", 0, retryOnError(err)
+	}
+	return pushDigest, nn, nil
+}
 
-	descriptor := distribution.Descriptor{
-		Digest:    pushDigest,
-		MediaType: schema2.MediaTypeLayer,
-		Size:      nn,
+// Release removes the compressed layer kept to resume its chunked upload.
+func (pd *v2PushDescriptor) Release() {
+	if pd.spool != nil {
+		pd.spool.close()
+		pd.spool = nil
 	}
-	pd.pushState.remoteLayers[diffID] = descriptor
+}
 
-	pd.pushState.Unlock()
+// mountCandidate is a repository to mount the blob of a layer from.
+type mountCandidate struct {
+	metadata.V2Metadata
+	// known is set if the daemon saw the blob in the repository.
+	known bool
+}
 
-	return descriptor, nil
+// mountCandidates returns the repositories of the registry to mount the
+// layer described by v2Metadata from: first the ones where the daemon saw
+// its blob, then the other ones the daemon pulled from or pushed to, which
+// may have the blob too, e.g. if it was pulled from another registry. Only
+// the repositories accessed with the credentials of the push, or
+// anonymously, are candidates, since the others may not be pullable with
+// them.
+//
+// The metadata stored by older daemons isn't tagged with the credentials it
+// was written with. The repositories it names are tried after the ones where
+// the daemon saw the blob with the credentials of the push, since the blob is
+// only mounted from a repository once it was found there with them. They
+// aren't known sources either, so that the metadata isn't removed when the
+// blob can't be found with other credentials than the ones of the pull.
+func (pd *v2PushDescriptor) mountCandidates(v2Metadata []metadata.V2Metadata) []mountCandidate {
+	var (
+		candidates []mountCandidate
+		untagged   []mountCandidate
+		digests    []digest.Digest
+	)
+	seen := make(map[string]bool)
+	seenDigests := make(map[digest.Digest]bool)
+
+	// Note: metadata is stored from oldest to newest, so we iterate through this
+	// slice in reverse to maximize our chances of the blob still existing in the
+	// remote repository.
+	for i := len(v2Metadata) - 1; i >= 0; i-- {
+		meta := v2Metadata[i]
+		if !seenDigests[meta.Digest] {
+			seenDigests[meta.Digest] = true
+			digests = append(digests, meta.Digest)
+		}
+
+		if len(candidates) == maxKnownMountAttempts || meta.SourceRepository == pd.repoInfo.FullName() {
+			continue
+		}
+		tagged := metadata.CheckV2MetadataHMAC(&meta, pd.hmacKey) || metadata.CheckV2MetadataHMAC(&meta, pd.anonymousHMACKey)
+		if !tagged && meta.HMAC != "" {
+			continue
+		}
+		sourceRepo, err := reference.ParseNamed(meta.SourceRepository)
+		if err != nil {
+			continue
+		}
+		if pd.repoInfo.Hostname() != sourceRepo.Hostname() {
+			// don't mount blobs from another registry
+			continue
+		}
+		if !tagged {
+			untagged = append(untagged, mountCandidate{V2Metadata: meta})
+			continue
+		}
+		seen[string(meta.Digest)+" "+meta.SourceRepository] = true
+		candidates = append(candidates, mountCandidate{V2Metadata: meta, known: true})
+	}
+	for _, candidate := range untagged {
+		key := string(candidate.Digest) + " " + candidate.SourceRepository
+		if len(candidates) == maxKnownMountAttempts || seen[key] {
+			continue
+		}
+		seen[key] = true
+		candidates = append(candidates, candidate)
+	}
+
+	repositories, err := pd.v2MetadataService.GetRepositories(pd.repoInfo.Hostname(), pd.hmacKey, pd.anonymousHMACKey)
+	if err != nil {
+		return candidates
+	}
+	for _, dgst := range digests {
+		for i := len(repositories) - 1; i >= 0 && len(candidates) < maxMountAttempts; i-- {
+			key := string(dgst) + " " + repositories[i]
+			if repositories[i] == pd.repoInfo.FullName() || seen[key] {
+				continue
+			}
+			seen[key] = true
+			meta := metadata.V2Metadata{Digest: dgst, SourceRepository: repositories[i]}
+			candidates = append(candidates, mountCandidate{V2Metadata: meta})
+		}
+	}
+	return candidates
+}
+
+// statMountSource checks that the blob dgst can be pulled from the
+// repository sourceRepo of the registry through tr, the transport of the
+// repository authorized to mount blobs from it.
+func (pd *v2PushDescriptor) statMountSource(ctx context.Context, sourceRepo reference.Named, dgst digest.Digest, tr http.RoundTripper) error {
+	sourceName, err := distreference.ParseNamed(repoScopeName(sourceRepo, pd.endpoint))
+	if err != nil {
+		return err
+	}
+	repo, err := client.NewRepository(ctx, sourceName, pd.endpoint.URL.String(), tr)
+	if err != nil {
+		return err
+	}
+	_, err = repo.Blobs(ctx).Stat(ctx, dgst)
+	return err
 }
 
 func (pd *v2PushDescriptor) SetRemoteDescriptor(descriptor distribution.Descriptor) {
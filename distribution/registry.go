@@ -13,6 +13,7 @@ import (
 	"github.com/docker/distribution/registry/client/auth"
 	"github.com/docker/distribution/registry/client/transport"
 	"github.com/docker/docker/dockerversion"
+	"github.com/docker/docker/reference"
 	"github.com/docker/docker/registry"
 	"github.com/docker/engine-api/types"
 	"github.com/docker/go-connections/sockets"
@@ -38,11 +39,15 @@ func (dcs dumbCredentialStore) SetRefreshToken(*url.URL, string, string) {
 // providing timeout settings and authentication support, and also verifies the
 // remote API version.
 func NewV2Repository(ctx context.Context, repoInfo *registry.RepositoryInfo, endpoint registry.APIEndpoint, metaHeaders http.Header, authConfig *types.AuthConfig, actions ...string) (repo distribution.Repository, foundVersion bool, err error) {
-	repoName := repoInfo.FullName()
-	// If endpoint does not support CanonicalName, use the RemoteName instead
-	if endpoint.TrimHostname {
-		repoName = repoInfo.RemoteName()
-	}
+	repo, foundVersion, _, err = newV2Repository(ctx, repoInfo, endpoint, metaHeaders, authConfig, nil, actions...)
+	return
+}
+
+// newV2Repository is like NewV2Repository, but also authorizes the access to
+// extraScopes, e.g. to mount blobs from other repositories, and returns the
+// transport of the repository, to make requests the client doesn't support.
+func newV2Repository(ctx context.Context, repoInfo *registry.RepositoryInfo, endpoint registry.APIEndpoint, metaHeaders http.Header, authConfig *types.AuthConfig, extraScopes []auth.Scope, actions ...string) (repo distribution.Repository, foundVersion bool, tr http.RoundTripper, err error) {
+	repoName := repoScopeName(repoInfo, endpoint)
 
 	direct := &net.Dialer{
 		Timeout:   30 * time.Second,
@@ -75,7 +80,7 @@ func NewV2Repository(ctx context.Context, repoInfo *registry.RepositoryInfo, end
 			transportOK = true
 			err = responseErr.Err
 		}
-		return nil, foundVersion, fallbackError{
+		return nil, foundVersion, nil, fallbackError{
 			err:         err,
 			confirmedV2: foundVersion,
 			transportOK: transportOK,
@@ -90,23 +95,23 @@ func NewV2Repository(ctx context.Context, repoInfo *registry.RepositoryInfo, end
 		tokenHandlerOptions := auth.TokenHandlerOptions{
 			Transport:   authTransport,
 			Credentials: creds,
-			Scopes: []auth.Scope{
+			Scopes: append([]auth.Scope{
 				auth.RepositoryScope{
 					Repository: repoName,
 					Actions:    actions,
 				},
-			},
+			}, extraScopes...),
 			ClientID: registry.AuthClientID,
 		}
 		tokenHandler := auth.NewTokenHandlerWithOptions(tokenHandlerOptions)
 		basicHandler := auth.NewBasicHandler(creds)
 		modifiers = append(modifiers, auth.NewAuthorizer(challengeManager, tokenHandler, basicHandler))
 	}
-	tr := transport.NewTransport(base, modifiers...)
+	tr = transport.NewTransport(base, modifiers...)
 
 	repoNameRef, err := distreference.ParseNamed(repoName)
 	if err != nil {
-		return nil, foundVersion, fallbackError{
+		return nil, foundVersion, nil, fallbackError{
 			err:         err,
 			confirmedV2: foundVersion,
 			transportOK: true,
@@ -124,6 +129,15 @@ func NewV2Repository(ctx context.Context, repoInfo *registry.RepositoryInfo, end
 	return
 }
 
+// repoScopeName returns the name of the repository repoInfo on endpoint.
+func repoScopeName(repoInfo reference.Named, endpoint registry.APIEndpoint) string {
+	// If endpoint does not support CanonicalName, use the RemoteName instead
+	if endpoint.TrimHostname {
+		return repoInfo.RemoteName()
+	}
+	return repoInfo.FullName()
+}
+
 type existingTokenHandler struct {
 	token string
 }
@@ -0,0 +1,399 @@
+package distribution
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
+	distreference "github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/client"
+	"github.com/docker/docker/distribution/xfer"
+	"github.com/docker/docker/registry"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// maxChunkAttempts is the number of times the upload of a chunk is
+// attempted before the upload of the blob fails.
+const maxChunkAttempts = 5
+
+// errBlobUploadRewound is returned when the registry lost part of a blob
+// upload session, which then can't be resumed.
+var errBlobUploadRewound = errors.New("registry lost part of the blob upload")
+
+// errBlobUploadOffset is returned when the registry rejects a chunk because
+// it doesn't start at the size of the part of the blob it received.
+var errBlobUploadOffset = errors.New("registry rejected the offset of the blob upload chunk")
+
+// layerSpool stores the compressed stream of a layer in a temporary file
+// while it is being compressed, so that the chunks of the layer are uploaded
+// while the rest of it is compressed, and chunks are uploaded again, e.g. to
+// resume an interrupted upload, without compressing the layer again.
+type layerSpool struct {
+	file     *os.File
+	finished chan struct{}
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// size is the size of the part of the stream stored.
+	size   int64
+	digest digest.Digest
+	done   bool
+	closed bool
+	err    error
+}
+
+// newLayerSpool stores the stream read from r in a new spool, and calls
+// release once it was read.
+func newLayerSpool(r io.Reader, release func()) (*layerSpool, error) {
+	f, err := ioutil.TempFile("", "PushImageBlob")
+	if err != nil {
+		release()
+		return nil, err
+	}
+	s := &layerSpool{
+		file:     f,
+		finished: make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	go s.fill(r, release)
+	return s, nil
+}
+
+func (s *layerSpool) fill(r io.Reader, release func()) {
+	defer close(s.finished)
+	defer release()
+
+	digester := digest.Canonical.New()
+	buf := make([]byte, 32*1024)
+	var size int64
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := s.file.WriteAt(buf[:n], size); werr != nil {
+				err = werr
+			} else {
+				digester.Hash().Write(buf[:n])
+				size += int64(n)
+			}
+		}
+
+		s.mu.Lock()
+		s.size = size
+		switch {
+		case s.closed:
+			err = errors.New("layer spool closed")
+			fallthrough
+		case err != nil && err != io.EOF:
+			s.err = err
+		case err == io.EOF:
+			s.done = true
+			s.digest = digester.Digest()
+		}
+		s.cond.Broadcast()
+		stop := s.done || s.err != nil
+		s.mu.Unlock()
+		if stop {
+			return
+		}
+	}
+}
+
+// wait waits until the spool stored the stream up to offset end, or the
+// whole stream if it is shorter, and returns the size of the part stored.
+func (s *layerSpool) wait(end int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.size < end && !s.done && s.err == nil {
+		s.cond.Wait()
+	}
+	if s.size < end && s.err != nil {
+		return s.size, s.err
+	}
+	return s.size, nil
+}
+
+// result waits until the spool stored the whole stream, and returns its
+// digest and size.
+func (s *layerSpool) result() (digest.Digest, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !s.done && s.err == nil {
+		s.cond.Wait()
+	}
+	return s.digest, s.size, s.err
+}
+
+// failed returns the error which stopped the spool from storing the stream,
+// if any.
+func (s *layerSpool) failed() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// close stops storing the stream and removes the temporary file.
+func (s *layerSpool) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	<-s.finished
+
+	s.file.Close()
+	if err := os.Remove(s.file.Name()); err != nil {
+		logrus.Errorf("Failed to remove temporary file %s: %v", s.file.Name(), err)
+	}
+}
+
+// blobUploadSession is an upload session of a registry which a blob is
+// uploaded to in chunks, so that an interrupted upload resumes from the last
+// chunk the registry received instead of starting over.
+type blobUploadSession struct {
+	client *http.Client
+	// location is the URL of the session, as last returned by the
+	// registry.
+	location string
+	// offset is the size of the part of the blob the registry received.
+	offset int64
+	// unsure is set when the registry reported a range of "0-0", which it
+	// does both when it received nothing and when it received a single
+	// byte. offset is then 0 until a chunk at that offset is rejected.
+	unsure bool
+}
+
+// startBlobUploadSession starts an upload session of a blob of the repository
+// name on endpoint, whose requests are made with tr.
+func startBlobUploadSession(ctx context.Context, tr http.RoundTripper, endpoint registry.APIEndpoint, name distreference.Named) (*blobUploadSession, error) {
+	ub, err := v2.NewURLBuilderFromString(endpoint.URL.String(), false)
+	if err != nil {
+		return nil, err
+	}
+	u, err := ub.BuildBlobUploadURL(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &blobUploadSession{client: &http.Client{Transport: tr}}
+	req, err := http.NewRequest("POST", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ctxhttp.Do(ctx, s.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, client.HandleErrorResponse(resp)
+	}
+	if err := s.setLocation(resp); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// setLocation updates the URL of the session from the response of the
+// registry.
+func (s *blobUploadSession) setLocation(resp *http.Response) error {
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return errors.New("missing Location header in blob upload response")
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+	s.location = resp.Request.URL.ResolveReference(u).String()
+	return nil
+}
+
+func (s *blobUploadSession) handleErrorResponse(resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return distribution.ErrBlobUploadUnknown
+	}
+	return client.HandleErrorResponse(resp)
+}
+
+// upload uploads the rest of the blob stored by spool in chunks of chunkSize
+// bytes, as soon as they are stored, and returns the size of the blob.
+func (s *blobUploadSession) upload(ctx context.Context, spool *layerSpool, chunkSize int64) (int64, error) {
+	for {
+		size, err := spool.wait(s.offset + chunkSize)
+		if err != nil {
+			return s.offset, err
+		}
+		if size < s.offset {
+			// the registry has more than the whole blob
+			return s.offset, errBlobUploadRewound
+		}
+		if size == s.offset {
+			return s.offset, nil
+		}
+		end := s.offset + chunkSize
+		if size < end {
+			end = size
+		}
+		if err := s.writeChunk(ctx, spool.file, end); err != nil {
+			return s.offset, err
+		}
+	}
+}
+
+// writeChunk uploads the chunk of the blob read from r between the offset of
+// the session and end. The upload is retried on errors, resuming from the
+// offset the registry reports.
+func (s *blobUploadSession) writeChunk(ctx context.Context, r io.ReaderAt, end int64) error {
+	start := s.offset
+	for attempt := 1; ; attempt++ {
+		err := s.patch(ctx, io.NewSectionReader(r, s.offset, end-s.offset), end-s.offset)
+		if err == nil {
+			return nil
+		}
+		if err == errBlobUploadOffset && s.unsure {
+			// The registry has the first byte of the blob.
+			s.offset, s.unsure = 1, false
+			if s.offset == end {
+				return nil
+			}
+			continue
+		}
+		if _, isDNR := retryOnError(err).(xfer.DoNotRetry); isDNR || err == distribution.ErrBlobUploadUnknown || attempt == maxChunkAttempts {
+			return err
+		}
+		logrus.Debugf("Upload of chunk at offset %d failed, retrying: %v", s.offset, err)
+
+		select {
+		case <-time.After(time.Duration(attempt) * time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		// The registry may have received part of the chunk.
+		if err := s.status(ctx); err != nil {
+			logrus.Debugf("Failed to get the status of the blob upload: %v", err)
+			continue
+		}
+		if s.offset < start || s.offset > end {
+			return errBlobUploadRewound
+		}
+		if s.offset == end {
+			return nil
+		}
+	}
+}
+
+// patch sends the n bytes read from r to the registry, at the offset of the
+// session.
+func (s *blobUploadSession) patch(ctx context.Context, r io.Reader, n int64) error {
+	req, err := http.NewRequest("PATCH", s.location, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Range", fmt.Sprintf("%d-%d", s.offset, s.offset+n-1))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.ContentLength = n
+
+	resp, err := ctxhttp.Do(ctx, s.client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return errBlobUploadOffset
+	}
+	if !client.SuccessStatus(resp.StatusCode) {
+		return s.handleErrorResponse(resp)
+	}
+	if err := s.setLocation(resp); err != nil {
+		return err
+	}
+	s.offset += n
+	s.unsure = false
+	return nil
+}
+
+// status updates the offset of the session to the size of the part of the
+// blob the registry received.
+func (s *blobUploadSession) status(ctx context.Context) error {
+	resp, err := ctxhttp.Get(ctx, s.client, s.location)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if !client.SuccessStatus(resp.StatusCode) {
+		return s.handleErrorResponse(resp)
+	}
+	if err := s.setLocation(resp); err != nil {
+		return err
+	}
+
+	rng := resp.Header.Get("Range")
+	var start, end int64
+	if n, err := fmt.Sscanf(rng, "%d-%d", &start, &end); err != nil {
+		return err
+	} else if n != 2 || start != 0 || end < start {
+		return fmt.Errorf("bad range format: %s", rng)
+	}
+	// The registry reports "0-0" both when it has no data and when it has
+	// a single byte: the offset is assumed to be 0 until the registry
+	// rejects it.
+	s.unsure = end == 0
+	if s.unsure {
+		s.offset = 0
+	} else {
+		s.offset = end + 1
+	}
+	return nil
+}
+
+// commit completes the upload of the blob dgst.
+func (s *blobUploadSession) commit(ctx context.Context, dgst digest.Digest) error {
+	u, err := url.Parse(s.location)
+	if err != nil {
+		return err
+	}
+	values := u.Query()
+	values.Set("digest", dgst.String())
+	u.RawQuery = values.Encode()
+
+	req, err := http.NewRequest("PUT", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := ctxhttp.Do(ctx, s.client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if !client.SuccessStatus(resp.StatusCode) {
+		return s.handleErrorResponse(resp)
+	}
+	return nil
+}
+
+// cancel cancels the upload session.
+func (s *blobUploadSession) cancel(ctx context.Context) error {
+	req, err := http.NewRequest("DELETE", s.location, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := ctxhttp.Do(ctx, s.client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || client.SuccessStatus(resp.StatusCode) {
+		return nil
+	}
+	return s.handleErrorResponse(resp)
+}
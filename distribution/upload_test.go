@@ -0,0 +1,327 @@
+package distribution
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/distribution/digest"
+	distreference "github.com/docker/distribution/reference"
+	"github.com/docker/docker/distribution/metadata"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/reference"
+	"github.com/docker/docker/registry"
+	"github.com/docker/engine-api/types"
+	"golang.org/x/net/context"
+)
+
+// mockUploadRegistry is a registry supporting chunked blob uploads, which
+// only receives half of the failingPatch-th PATCH request.
+type mockUploadRegistry struct {
+	sync.Mutex
+	data         []byte
+	patches      int
+	failingPatch int
+	committed    digest.Digest
+}
+
+func (m *mockUploadRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+
+	const location = "/v2/foo/bar/blobs/uploads/uuid"
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/v2/foo/bar/blobs/uploads/":
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusAccepted)
+	case r.URL.Path != location:
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == "PATCH":
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Content-Range"), "%d-%d", &start, &end); err != nil || start != len(m.data) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		p, _ := ioutil.ReadAll(r.Body)
+		m.patches++
+		if m.patches == m.failingPatch {
+			m.data = append(m.data, p[:len(p)/2]...)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		m.data = append(m.data, p...)
+		w.Header().Set("Location", location)
+		w.Header().Set("Range", fmt.Sprintf("0-%d", len(m.data)-1))
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == "GET":
+		end := len(m.data) - 1
+		if end < 0 {
+			end = 0
+		}
+		w.Header().Set("Location", location)
+		w.Header().Set("Range", fmt.Sprintf("0-%d", end))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "PUT":
+		dgst := digest.Digest(r.URL.Query().Get("digest"))
+		if dgst != digest.FromBytes(m.data) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.committed = dgst
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// TestBlobUploadSessionResumesChunk checks that the chunked upload of a blob
+// resumes a chunk the registry received part of, from the offset the
+// registry reports.
+func TestBlobUploadSessionResumesChunk(t *testing.T) {
+	blob := bytes.Repeat([]byte("chunked layer "), 100)
+	reg := &mockUploadRegistry{failingPatch: 2}
+	server := httptest.NewServer(reg)
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := distreference.ParseNamed("foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	session, err := startBlobUploadSession(ctx, http.DefaultTransport, registry.APIEndpoint{URL: u}, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spool, err := newLayerSpool(bytes.NewReader(blob), func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.close()
+	size, err := session.upload(ctx, spool, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(blob)) {
+		t.Fatalf("expected size %d, got %d", len(blob), size)
+	}
+	if !bytes.Equal(reg.data, blob) {
+		t.Fatal("registry received a corrupted blob")
+	}
+	if err := session.commit(ctx, digest.FromBytes(blob)); err != nil {
+		t.Fatal(err)
+	}
+	if reg.committed != digest.FromBytes(blob) {
+		t.Fatalf("blob was not committed")
+	}
+}
+
+// TestBlobUploadSessionResumesAfterFirstByte checks that an upload resumes
+// when the registry received a single byte of it, which it reports with the
+// same range as no data at all.
+func TestBlobUploadSessionResumesAfterFirstByte(t *testing.T) {
+	blob := []byte("chunked layer")
+	reg := &mockUploadRegistry{failingPatch: 1}
+	server := httptest.NewServer(reg)
+	defer server.Close()
+
+	session := &blobUploadSession{client: http.DefaultClient, location: server.URL + "/v2/foo/bar/blobs/uploads/uuid"}
+	spool, err := newLayerSpool(bytes.NewReader(blob), func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.close()
+
+	// The first chunk is 2 bytes long, of which the registry receives 1.
+	size, err := session.upload(context.Background(), spool, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(blob)) {
+		t.Fatalf("expected size %d, got %d", len(blob), size)
+	}
+	if !bytes.Equal(reg.data, blob) {
+		t.Fatalf("registry received a corrupted blob: %q", reg.data)
+	}
+}
+
+// TestLayerSpool checks that a spool makes the part of the stream it stored
+// available while the rest of it is being read, and removes its file when
+// it is closed.
+func TestLayerSpool(t *testing.T) {
+	blob := bytes.Repeat([]byte("spooled layer "), 100)
+	pr, pw := io.Pipe()
+	released := make(chan struct{})
+	spool, err := newLayerSpool(pr, func() { close(released) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pw.Write(blob[:512]); err != nil {
+		t.Fatal(err)
+	}
+	size, err := spool.wait(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 512 {
+		t.Fatalf("expected 512 bytes to be stored, got %d", size)
+	}
+	stored := make([]byte, 512)
+	if _, err := spool.file.ReadAt(stored, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, blob[:512]) {
+		t.Fatal("spool stored a corrupted stream")
+	}
+
+	if _, err := pw.Write(blob[512:]); err != nil {
+		t.Fatal(err)
+	}
+	pw.Close()
+	dgst, size, err := spool.result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dgst != digest.FromBytes(blob) || size != int64(len(blob)) {
+		t.Fatalf("expected %s of size %d, got %s of size %d", digest.FromBytes(blob), len(blob), dgst, size)
+	}
+	<-released
+
+	name := spool.file.Name()
+	spool.close()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed, got %v", name, err)
+	}
+}
+
+// TestBlobUploadSessionStatus checks that a session resumed by a later
+// attempt gets its offset from the registry.
+func TestBlobUploadSessionStatus(t *testing.T) {
+	reg := &mockUploadRegistry{}
+	server := httptest.NewServer(reg)
+	defer server.Close()
+
+	session := &blobUploadSession{client: http.DefaultClient, location: server.URL + "/v2/foo/bar/blobs/uploads/uuid", offset: 10}
+	ctx := context.Background()
+	if err := session.status(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if session.offset != 0 {
+		t.Fatalf("expected offset 0 for an empty upload, got %d", session.offset)
+	}
+
+	reg.data = []byte(strings.Repeat("a", 42))
+	if err := session.status(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if session.offset != 42 {
+		t.Fatalf("expected offset 42, got %d", session.offset)
+	}
+}
+
+func TestMountCandidates(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "mount-candidates-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	metadataStore, err := metadata.NewFSMetadataStore(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2MetadataService := metadata.NewV2MetadataService(metadataStore)
+
+	userKey, err := metadata.ComputeV2MetadataHMACKey(&types.AuthConfig{Username: "user", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := metadata.ComputeV2MetadataHMACKey(&types.AuthConfig{Username: "other", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymousKey, err := metadata.ComputeV2MetadataHMACKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dgst := digest.Digest("sha256:f0cd5ca10b07f35512fc2f1cbf9a6cefbdb5cba70ac6b0c9e5988f4497f71937")
+	otherDiffID := layer.DiffID("sha256:86e0e091d0da6bde2456dbb48306f3956bbeb2eae1b5b9a43045843f69fe4aaa")
+	diffID := layer.DiffID("sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4")
+
+	// The registry has repositories the layer was never seen in, accessed
+	// anonymously or with the credentials of a user or of another one.
+	for _, r := range []struct {
+		repository string
+		key        []byte
+	}{
+		{"myregistry:5000/base", anonymousKey},
+		{"myregistry:5000/app", userKey},
+		{"myregistry:5000/private", otherKey},
+		{"myregistry:5000/target", userKey},
+	} {
+		if err := v2MetadataService.AddWithHMAC(otherDiffID, r.key, metadata.V2Metadata{Digest: digest.Digest("sha256:9e3447ca24cb96d86ebd5960cb34d1299b07e0a0e03801d90b9969a2c187dd6e"), SourceRepository: r.repository}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The layer was pulled from another registry, from the base image and
+	// from a repository of the other user.
+	for _, r := range []struct {
+		repository string
+		key        []byte
+	}{
+		{"docker.io/library/busybox", anonymousKey},
+		{"myregistry:5000/base", anonymousKey},
+		{"myregistry:5000/private", otherKey},
+	} {
+		if err := v2MetadataService.AddWithHMAC(diffID, r.key, metadata.V2Metadata{Digest: dgst, SourceRepository: r.repository}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An older daemon pulled the layer from a repository without tagging the
+	// metadata with the credentials of the pull.
+	legacy := metadata.V2Metadata{Digest: dgst, SourceRepository: "myregistry:5000/legacy"}
+	if err := v2MetadataService.Add(diffID, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	named, err := reference.ParseNamed("myregistry:5000/target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pd := &v2PushDescriptor{
+		v2MetadataService: v2MetadataService,
+		repoInfo:          &registry.RepositoryInfo{Named: named},
+		hmacKey:           userKey,
+		anonymousHMACKey:  anonymousKey,
+	}
+	v2Metadata, err := v2MetadataService.GetMetadata(diffID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := metadata.V2Metadata{Digest: dgst, SourceRepository: "myregistry:5000/base"}
+	base.HMAC = metadata.ComputeV2MetadataHMAC(anonymousKey, &base)
+	expected := []mountCandidate{
+		{V2Metadata: base, known: true},
+		{V2Metadata: legacy},
+		{V2Metadata: metadata.V2Metadata{Digest: dgst, SourceRepository: "myregistry:5000/app"}},
+	}
+	if candidates := pd.mountCandidates(v2Metadata); !reflect.DeepEqual(candidates, expected) {
+		t.Fatalf("expected mount candidates %v, got %v", expected, candidates)
+	}
+}
@@ -0,0 +1,167 @@
+package xfer
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/docker/pkg/ioutils"
+	"github.com/docker/docker/pkg/progress"
+	"golang.org/x/net/context"
+)
+
+// BlobCache is a cache of the layer blobs, keyed by digest, which the
+// download manager consults before downloading the layers from their
+// registry. It may be shared by the daemons of several hosts, so that they
+// download each blob once.
+type BlobCache interface {
+	// Get returns a reader of the blob dgst and its size, or an error if
+	// it isn't cached.
+	Get(ctx context.Context, dgst digest.Digest) (io.ReadCloser, int64, error)
+	// Put stores the blob dgst read from r, unless r fails or isn't the
+	// blob dgst. It may return before reading all of r.
+	Put(ctx context.Context, dgst digest.Digest, r io.Reader) error
+}
+
+// DownloadDescriptorWithDigest is a DownloadDescriptor of a layer blob whose
+// digest is known, which is looked up in the blob cache of the download
+// manager before being downloaded, and stored in it once downloaded. This
+// interface is used if a cast to DownloadDescriptorWithDigest is successful.
+type DownloadDescriptorWithDigest interface {
+	DownloadDescriptor
+	Digest() digest.Digest
+}
+
+// maxBlobCachePuts is the number of blobs stored in the blob cache at the
+// same time. The downloaded blobs are not cached while that many are being
+// stored, so that a slow cache doesn't pile up copies of the blobs.
+const maxBlobCachePuts = 3
+
+// SetBlobCache sets the blob cache consulted before downloading layers, or
+// disables it if cache is nil.
+func (ldm *LayerDownloadManager) SetBlobCache(cache BlobCache) {
+	ldm.blobCache = cache
+	ldm.blobCachePuts = make(chan struct{}, maxBlobCachePuts)
+}
+
+// downloadFromBlobCache copies the blob dgst from the blob cache to a
+// temporary file, and returns it once its digest is verified.
+func (ldm *LayerDownloadManager) downloadFromBlobCache(ctx context.Context, dgst digest.Digest, id string, progressOutput progress.Output) (io.ReadCloser, int64, error) {
+	rc, size, err := ldm.blobCache.Get(ctx, dgst)
+	if err != nil {
+		return nil, 0, err
+	}
+	reader := progress.NewProgressReader(ioutils.NewCancelReadCloser(ctx, rc), progressOutput, size, id, "Downloading from blob cache")
+	defer reader.Close()
+
+	tmpFile, err := ioutil.TempFile("", "GetImageBlob")
+	if err != nil {
+		return nil, 0, err
+	}
+	removeTmpFile := func() {
+		tmpFile.Close()
+		if err := os.Remove(tmpFile.Name()); err != nil {
+			logrus.Errorf("Failed to remove temp file: %s", tmpFile.Name())
+		}
+	}
+
+	verifier, err := digest.NewDigestVerifier(dgst)
+	if err != nil {
+		removeTmpFile()
+		return nil, 0, err
+	}
+	size, err = io.Copy(tmpFile, io.TeeReader(reader, verifier))
+	if err != nil {
+		removeTmpFile()
+		return nil, 0, err
+	}
+	if !verifier.Verified() {
+		removeTmpFile()
+		return nil, 0, fmt.Errorf("blob cache verification failed for digest %s", dgst)
+	}
+	if _, err := tmpFile.Seek(0, os.SEEK_SET); err != nil {
+		removeTmpFile()
+		return nil, 0, err
+	}
+
+	return ioutils.NewReadCloserWrapper(tmpFile, func() error {
+		removeTmpFile()
+		return nil
+	}), size, nil
+}
+
+// cacheBlob returns a reader of the downloaded blob dgst which copies it to a
+// temporary file as it is read. The returned function must be called before
+// the reader is closed, with the error of the download, if any: the rest of
+// the blob is then read, and unless err is not nil the blob is stored in the
+// blob cache in the background, so that a slow cache never holds up the
+// extraction of the layers. Storing the blob is best effort: it is skipped
+// if too many blobs are already being stored.
+func (ldm *LayerDownloadManager) cacheBlob(dgst digest.Digest, rc io.ReadCloser) (io.ReadCloser, func(err error)) {
+	select {
+	case ldm.blobCachePuts <- struct{}{}:
+	default:
+		logrus.Debugf("Not storing blob %s in the busy blob cache", dgst)
+		return rc, func(error) {}
+	}
+	release := func() { <-ldm.blobCachePuts }
+
+	tmpFile, err := ioutil.TempFile("", "BlobCache")
+	if err != nil {
+		release()
+		logrus.Debugf("Failed to store blob %s in the blob cache: %v", dgst, err)
+		return rc, func(error) {}
+	}
+	removeTmpFile := func() {
+		tmpFile.Close()
+		if err := os.Remove(tmpFile.Name()); err != nil {
+			logrus.Errorf("Failed to remove temp file: %s", tmpFile.Name())
+		}
+		release()
+	}
+
+	w := &blobCacheWriter{w: tmpFile}
+	tee := io.TeeReader(rc, w)
+	return ioutils.NewReadCloserWrapper(tee, rc.Close), func(err error) {
+		if err == nil {
+			// The extraction of the layer may stop before the end of
+			// the blob.
+			_, err = io.Copy(ioutil.Discard, tee)
+		}
+		if err == nil {
+			err = w.err
+		}
+		if err == nil {
+			_, err = tmpFile.Seek(0, os.SEEK_SET)
+		}
+		if err != nil {
+			removeTmpFile()
+			return
+		}
+
+		go func() {
+			defer removeTmpFile()
+			// The blob outlives the download it was read by.
+			if err := ldm.blobCache.Put(context.Background(), dgst, tmpFile); err != nil {
+				logrus.Debugf("Failed to store blob %s in the blob cache: %v", dgst, err)
+			}
+		}()
+	}
+}
+
+// blobCacheWriter writes to w until it fails, without failing the reads of
+// the download the writes are made from.
+type blobCacheWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (bw *blobCacheWriter) Write(p []byte) (int, error) {
+	if bw.err == nil {
+		_, bw.err = bw.w.Write(p)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,197 @@
+package xfer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/digest"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/progress"
+	"golang.org/x/net/context"
+)
+
+type mockBlobCache struct {
+	sync.Mutex
+	blobs map[digest.Digest][]byte
+}
+
+func (c *mockBlobCache) Get(ctx context.Context, dgst digest.Digest) (io.ReadCloser, int64, error) {
+	c.Lock()
+	defer c.Unlock()
+	b, ok := c.blobs[dgst]
+	if !ok {
+		return nil, 0, errors.New("blob not cached")
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), int64(len(b)), nil
+}
+
+func (c *mockBlobCache) Put(ctx context.Context, dgst digest.Digest, r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.blobs[dgst] = b
+	return nil
+}
+
+// waitCached waits for the blob dgst to be stored in the background.
+func (c *mockBlobCache) waitCached(dgst digest.Digest) bool {
+	for i := 0; i < 100; i++ {
+		c.Lock()
+		_, ok := c.blobs[dgst]
+		c.Unlock()
+		if ok {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+// blockingBlobCache is a blob cache which never finishes storing blobs.
+type blockingBlobCache struct {
+	mockBlobCache
+	unblock chan struct{}
+}
+
+func (c *blockingBlobCache) Put(ctx context.Context, dgst digest.Digest, r io.Reader) error {
+	<-c.unblock
+	return nil
+}
+
+// mockDigestDownloadDescriptor is a mockDownloadDescriptor whose digest is
+// known, and which counts its downloads.
+type mockDigestDownloadDescriptor struct {
+	*mockDownloadDescriptor
+	downloads int32
+}
+
+func (d *mockDigestDownloadDescriptor) Digest() digest.Digest {
+	b, _ := ioutil.ReadAll(d.mockTarStream())
+	return digest.FromBytes(b)
+}
+
+func (d *mockDigestDownloadDescriptor) Download(ctx context.Context, progressOutput progress.Output) (io.ReadCloser, int64, error) {
+	atomic.AddInt32(&d.downloads, 1)
+	return d.mockDownloadDescriptor.Download(ctx, progressOutput)
+}
+
+func TestDownloadWithBlobCache(t *testing.T) {
+	cache := &mockBlobCache{blobs: make(map[digest.Digest][]byte)}
+
+	download := func(id string) *mockDigestDownloadDescriptor {
+		layerStore := &mockLayerStore{make(map[layer.ChainID]*mockLayer)}
+		ldm := NewLayerDownloadManager(layerStore, maxDownloadConcurrency)
+		ldm.SetBlobCache(cache)
+
+		descriptor := &mockDigestDownloadDescriptor{mockDownloadDescriptor: &mockDownloadDescriptor{id: id}}
+		progressChan := make(chan progress.Progress)
+		go func() {
+			for range progressChan {
+			}
+		}()
+		defer close(progressChan)
+
+		rootFS, releaseFunc, err := ldm.Download(context.Background(), *image.NewRootFS(), []DownloadDescriptor{descriptor}, progress.ChanOutput(progressChan))
+		if err != nil {
+			t.Fatalf("download error: %v", err)
+		}
+		defer releaseFunc()
+
+		b, _ := ioutil.ReadAll(descriptor.mockTarStream())
+		if expected := layer.DiffID(digest.FromBytes(b)); rootFS.DiffIDs[0] != expected {
+			t.Fatalf("wrong diffID: expected %v, got %v", expected, rootFS.DiffIDs[0])
+		}
+		return descriptor
+	}
+
+	// The first download populates the cache.
+	first := download("id1")
+	if first.downloads != 1 {
+		t.Fatalf("expected 1 download, got %d", first.downloads)
+	}
+	if !cache.waitCached(first.Digest()) {
+		t.Fatal("downloaded blob was not stored in the cache")
+	}
+
+	// The second one is served by the cache.
+	second := download("id1")
+	if second.downloads != 0 {
+		t.Fatalf("expected the blob to be served by the cache, got %d downloads", second.downloads)
+	}
+}
+
+func TestDownloadWithCorruptedBlobCache(t *testing.T) {
+	layerStore := &mockLayerStore{make(map[layer.ChainID]*mockLayer)}
+	ldm := NewLayerDownloadManager(layerStore, maxDownloadConcurrency)
+
+	descriptor := &mockDigestDownloadDescriptor{mockDownloadDescriptor: &mockDownloadDescriptor{id: "id1"}}
+	cache := &mockBlobCache{blobs: map[digest.Digest][]byte{descriptor.Digest(): []byte("corrupted")}}
+	ldm.SetBlobCache(cache)
+
+	progressChan := make(chan progress.Progress)
+	go func() {
+		for range progressChan {
+		}
+	}()
+	defer close(progressChan)
+
+	_, releaseFunc, err := ldm.Download(context.Background(), *image.NewRootFS(), []DownloadDescriptor{descriptor}, progress.ChanOutput(progressChan))
+	if err != nil {
+		t.Fatalf("download error: %v", err)
+	}
+	releaseFunc()
+
+	if descriptor.downloads != 1 {
+		t.Fatalf("expected the corrupted blob to be downloaded again, got %d downloads", descriptor.downloads)
+	}
+}
+
+// TestDownloadWithBlockedBlobCache checks that downloads complete while the
+// blob cache is busy storing blobs.
+func TestDownloadWithBlockedBlobCache(t *testing.T) {
+	cache := &blockingBlobCache{mockBlobCache: mockBlobCache{blobs: make(map[digest.Digest][]byte)}, unblock: make(chan struct{})}
+	defer close(cache.unblock)
+
+	layerStore := &mockLayerStore{make(map[layer.ChainID]*mockLayer)}
+	ldm := NewLayerDownloadManager(layerStore, maxDownloadConcurrency)
+	ldm.SetBlobCache(cache)
+
+	progressChan := make(chan progress.Progress)
+	go func() {
+		for range progressChan {
+		}
+	}()
+	defer close(progressChan)
+
+	var descriptors []DownloadDescriptor
+	for _, id := range []string{"id1", "id2", "id3", "id4", "id5"} {
+		descriptors = append(descriptors, &mockDigestDownloadDescriptor{mockDownloadDescriptor: &mockDownloadDescriptor{id: id}})
+	}
+
+	done := make(chan error)
+	go func() {
+		_, releaseFunc, err := ldm.Download(context.Background(), *image.NewRootFS(), descriptors, progress.ChanOutput(progressChan))
+		if err == nil {
+			releaseFunc()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("download error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("download blocked by the blob cache")
+	}
+}
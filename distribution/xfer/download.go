@@ -8,6 +8,7 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
 	"github.com/docker/docker/image"
 	"github.com/docker/docker/layer"
 	"github.com/docker/docker/pkg/archive"
@@ -24,6 +25,10 @@ const maxDownloadAttempts = 5
 type LayerDownloadManager struct {
 	layerStore layer.Store
 	tm         TransferManager
+	blobCache  BlobCache
+	// blobCachePuts limits the number of blobs stored in blobCache at the
+	// same time.
+	blobCachePuts chan struct{}
 }
 
 // SetConcurrency set the max concurrent downloads for each pull
@@ -245,7 +250,23 @@ func (ldm *LayerDownloadManager) makeDownloadFunc(descriptor DownloadDescriptor,
 
 			defer descriptor.Close()
 
-			for {
+			// The layers of known digest are looked up in the blob
+			// cache first.
+			var (
+				dgst   digest.Digest
+				cached bool
+			)
+			if withDigest, ok := descriptor.(DownloadDescriptorWithDigest); ok && ldm.blobCache != nil {
+				dgst = withDigest.Digest()
+				downloadReader, size, err = ldm.downloadFromBlobCache(d.Transfer.Context(), dgst, descriptor.ID(), progressOutput)
+				if err == nil {
+					cached = true
+				} else {
+					logrus.Debugf("Blob %s not found in the blob cache: %v", dgst, err)
+				}
+			}
+
+			for !cached {
 				downloadReader, size, err = descriptor.Download(d.Transfer.Context(), progressOutput)
 				if err == nil {
 					break
@@ -310,8 +331,18 @@ func (ldm *LayerDownloadManager) makeDownloadFunc(descriptor DownloadDescriptor,
 				parentLayer = l.ChainID()
 			}
 
+			var cacheDone func(error)
+			if dgst != "" && !cached {
+				downloadReader, cacheDone = ldm.cacheBlob(dgst, downloadReader)
+			}
+
 			reader := progress.NewProgressReader(ioutils.NewCancelReadCloser(d.Transfer.Context(), downloadReader), progressOutput, size, descriptor.ID(), "Extracting")
 			defer reader.Close()
+			if cacheDone != nil {
+				defer func() {
+					cacheDone(d.err)
+				}()
+			}
 
 			inflatedLayerData, err := archive.DecompressStream(reader)
 			if err != nil {
@@ -55,6 +55,16 @@ type UploadDescriptor interface {
 	SetRemoteDescriptor(descriptor distribution.Descriptor)
 }
 
+// UploadDescriptorWithRelease is an UploadDescriptor that has an additional
+// Release method which gets called once the upload succeeded or failed for
+// good. This allows the descriptor to keep resources between the attempts
+// of the upload, e.g. to resume it. This method is called if a cast to
+// UploadDescriptorWithRelease is successful.
+type UploadDescriptorWithRelease interface {
+	UploadDescriptor
+	Release()
+}
+
 // Upload is a blocking function which ensures the listed layers are present on
 // the remote registry. It uses the string returned by the Key method to
 // deduplicate uploads.
@@ -106,6 +116,9 @@ func (lum *LayerUploadManager) makeUploadFunc(descriptor UploadDescriptor) DoFun
 			defer func() {
 				close(progressChan)
 			}()
+			if withRelease, hasRelease := descriptor.(UploadDescriptorWithRelease); hasRelease {
+				defer withRelease.Release()
+			}
 
 			progressOutput := progress.ChanOutput(progressChan)
 
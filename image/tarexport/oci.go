@@ -0,0 +1,81 @@
+package tarexport
+
+import (
+	"github.com/docker/distribution/digest"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/reference"
+)
+
+const (
+	ociLayoutFileName     = "oci-layout"
+	ociIndexFileName      = "index.json"
+	ociBlobsDirName       = "blobs"
+	ociImageLayoutVersion = "1.0.0"
+
+	mediaTypeOCIIndex        = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest     = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIConfig       = "application/vnd.oci.image.config.v1+json"
+	mediaTypeOCILayer        = "application/vnd.oci.image.layer.v1.tar"
+	mediaTypeOCILayerGzip    = "application/vnd.oci.image.layer.v1.tar+gzip"
+	mediaTypeOCIForeignLayer = "application/vnd.oci.image.layer.nondistributable.v1.tar"
+	mediaTypeOCIForeignGzip  = "application/vnd.oci.image.layer.nondistributable.v1.tar+gzip"
+
+	// ociRefNameAnnotation is the annotation of the index.json descriptors
+	// holding the tag of the image, and imageNameAnnotation the one holding
+	// its full reference, as written by containerd.
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+	imageNameAnnotation  = "io.containerd.image.name"
+)
+
+type ociLayout struct {
+	ImageLayoutVersion string `json:"imageLayoutVersion"`
+}
+
+type ociPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      digest.Digest     `json:"digest"`
+	Size        int64             `json:"size"`
+	URLs        []string          `json:"urls,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *ociPlatform      `json:"platform,omitempty"`
+}
+
+type ociIndex struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Manifests     []ociDescriptor   `json:"manifests"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Config        ociDescriptor     `json:"config"`
+	Layers        []ociDescriptor   `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type ociExporter struct {
+	*tarexporter
+}
+
+// NewOCIExporter returns new ImageExporter for OCI image layouts. Its Save
+// writes a tar of an OCI image layout, and its Load reads both the OCI image
+// layouts and the tar packages.
+func NewOCIExporter(is image.Store, ls layer.Store, rs reference.Store, loggerImgEvent LogImageEvent) image.Exporter {
+	return &ociExporter{
+		tarexporter: &tarexporter{
+			is:             is,
+			ls:             ls,
+			rs:             rs,
+			loggerImgEvent: loggerImgEvent,
+		},
+	}
+}
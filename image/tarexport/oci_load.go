@@ -0,0 +1,252 @@
+package tarexport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	distreference "github.com/docker/distribution/reference"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/progress"
+	"github.com/docker/docker/reference"
+)
+
+// anchoredTagRegexp matches a tag on its own, without a repository.
+var anchoredTagRegexp = regexp.MustCompile(`^` + distreference.TagRegexp.String() + `$`)
+
+// isOCILayout returns whether tmpDir holds an OCI image layout.
+func isOCILayout(tmpDir string) bool {
+	p, err := safePath(tmpDir, ociLayoutFileName)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(p)
+	return err == nil
+}
+
+// ociLoad loads the images of the OCI image layout extracted in tmpDir,
+// tagging them with the references of their index.json annotations. The
+// images annotated with a tag without a repository can't be tagged, their ID
+// is reported along with the tag so that they can be tagged by the user.
+func (l *tarexporter) ociLoad(tmpDir string, outStream io.Writer, progressOutput progress.Output) error {
+	var layout ociLayout
+	if err := readJSONFile(tmpDir, ociLayoutFileName, &layout); err != nil {
+		return err
+	}
+	if layout.ImageLayoutVersion != ociImageLayoutVersion {
+		return fmt.Errorf("unsupported OCI image layout version: %q", layout.ImageLayoutVersion)
+	}
+
+	var index ociIndex
+	if err := readJSONFile(tmpDir, ociIndexFileName, &index); err != nil {
+		return err
+	}
+
+	var imageIDsStr string
+	var imageRefCount int
+
+	for _, desc := range index.Manifests {
+		manifestDesc, err := resolveOCIManifest(tmpDir, desc)
+		if err != nil {
+			return err
+		}
+		imgID, err := l.ociLoadImage(tmpDir, manifestDesc, progressOutput)
+		if err != nil {
+			return err
+		}
+		if ref, ok := ociDescriptorReference(desc); ok {
+			l.setLoadedTag(ref, imgID, outStream)
+			outStream.Write([]byte(fmt.Sprintf("Loaded image: %s\n", ref)))
+			imageRefCount++
+		} else if tag, ok := ociDescriptorTag(desc); ok {
+			outStream.Write([]byte(fmt.Sprintf("Loaded image ID: %s (untagged, its tag %q has no repository; use docker tag to name it)\n", imgID, tag)))
+			imageRefCount++
+		} else {
+			imageIDsStr += fmt.Sprintf("Loaded image ID: %s\n", imgID)
+		}
+		l.loggerImgEvent.LogImageEvent(imgID.String(), imgID.String(), "load")
+	}
+
+	if imageRefCount == 0 {
+		outStream.Write([]byte(imageIDsStr))
+	}
+
+	return nil
+}
+
+// resolveOCIManifest returns the descriptor of the image manifest desc
+// refers to, picking the one matching the platform of the daemon if desc is
+// an image index.
+func resolveOCIManifest(tmpDir string, desc ociDescriptor) (ociDescriptor, error) {
+	for {
+		switch desc.MediaType {
+		case mediaTypeOCIManifest, schema2.MediaTypeManifest:
+			return desc, nil
+		case mediaTypeOCIIndex, manifestlist.MediaTypeManifestList:
+		default:
+			return ociDescriptor{}, fmt.Errorf("unsupported manifest media type: %q", desc.MediaType)
+		}
+
+		data, err := readOCIBlob(tmpDir, desc)
+		if err != nil {
+			return ociDescriptor{}, err
+		}
+		var index ociIndex
+		if err := json.Unmarshal(data, &index); err != nil {
+			return ociDescriptor{}, err
+		}
+		found := false
+		for _, d := range index.Manifests {
+			if d.Platform == nil || (d.Platform.OS == runtime.GOOS && d.Platform.Architecture == runtime.GOARCH) {
+				desc, found = d, true
+				break
+			}
+		}
+		if !found {
+			return ociDescriptor{}, fmt.Errorf("no image found in index %s for platform %s/%s", desc.Digest, runtime.GOOS, runtime.GOARCH)
+		}
+	}
+}
+
+// ociDescriptorReference returns the reference desc is annotated with:
+// either the full reference of the image, or a tag which is a full
+// reference as well.
+func ociDescriptorReference(desc ociDescriptor) (reference.NamedTagged, bool) {
+	for _, key := range []string{imageNameAnnotation, ociRefNameAnnotation} {
+		name, ok := desc.Annotations[key]
+		if !ok {
+			continue
+		}
+		named, err := reference.ParseNamed(name)
+		if err != nil {
+			continue
+		}
+		// A ref.name which is only a tag, such as "latest", parses as a
+		// name only reference.
+		if ref, ok := named.(reference.NamedTagged); ok {
+			return ref, true
+		}
+	}
+	return nil, false
+}
+
+// ociDescriptorTag returns the tag desc is annotated with when it isn't a
+// full reference, such as "latest".
+func ociDescriptorTag(desc ociDescriptor) (string, bool) {
+	if _, ok := desc.Annotations[imageNameAnnotation]; ok {
+		return "", false
+	}
+	tag := desc.Annotations[ociRefNameAnnotation]
+	return tag, anchoredTagRegexp.MatchString(tag)
+}
+
+// ociLoadImage loads the layers and the config of the image manifest desc.
+func (l *tarexporter) ociLoadImage(tmpDir string, desc ociDescriptor, progressOutput progress.Output) (image.ID, error) {
+	data, err := readOCIBlob(tmpDir, desc)
+	if err != nil {
+		return "", err
+	}
+	var m ociManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return "", err
+	}
+
+	config, err := readOCIBlob(tmpDir, m.Config)
+	if err != nil {
+		return "", err
+	}
+	img, err := image.NewFromJSON(config)
+	if err != nil {
+		return "", err
+	}
+	var rootFS image.RootFS
+	rootFS = *img.RootFS
+	rootFS.DiffIDs = nil
+
+	if expected, actual := len(m.Layers), len(img.RootFS.DiffIDs); expected != actual {
+		return "", fmt.Errorf("invalid manifest, layers length mismatch: expected %d, got %d", expected, actual)
+	}
+
+	for i, diffID := range img.RootFS.DiffIDs {
+		switch m.Layers[i].MediaType {
+		case mediaTypeOCILayer, mediaTypeOCILayerGzip, mediaTypeOCIForeignLayer, mediaTypeOCIForeignGzip, schema2.MediaTypeLayer, schema2.MediaTypeForeignLayer:
+		default:
+			return "", fmt.Errorf("unsupported layer media type: %q", m.Layers[i].MediaType)
+		}
+		r := rootFS
+		r.Append(diffID)
+		newLayer, err := l.ls.Get(r.ChainID())
+		if err != nil {
+			layerPath, err := ociBlobPath(tmpDir, m.Layers[i].Digest)
+			if err != nil {
+				return "", err
+			}
+			newLayer, err = l.loadLayer(layerPath, rootFS, diffID.String(), distribution.Descriptor{}, progressOutput)
+			if err != nil {
+				return "", err
+			}
+		}
+		defer layer.ReleaseAndLog(l.ls, newLayer)
+		if expected, actual := diffID, newLayer.DiffID(); expected != actual {
+			return "", fmt.Errorf("invalid diffID for layer %d: expected %q, got %q", i, expected, actual)
+		}
+		rootFS.Append(diffID)
+	}
+
+	return l.is.Create(config)
+}
+
+// ociBlobPath returns the path of the blob dgst in the OCI image layout
+// extracted in tmpDir.
+func ociBlobPath(tmpDir string, dgst digest.Digest) (string, error) {
+	if err := dgst.Validate(); err != nil {
+		return "", err
+	}
+	return safePath(tmpDir, filepath.Join(ociBlobsDirName, string(dgst.Algorithm()), dgst.Hex()))
+}
+
+// readOCIBlob reads the blob desc, checking its size and digest.
+func readOCIBlob(tmpDir string, desc ociDescriptor) ([]byte, error) {
+	p, err := ociBlobPath(tmpDir, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != desc.Size {
+		return nil, fmt.Errorf("invalid size for blob %s: expected %d, got %d", desc.Digest, desc.Size, len(data))
+	}
+	verifier, err := digest.NewDigestVerifier(desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	verifier.Write(data)
+	if !verifier.Verified() {
+		return nil, fmt.Errorf("invalid digest for blob %s", desc.Digest)
+	}
+	return data, nil
+}
+
+func readJSONFile(tmpDir, name string, v interface{}) error {
+	p, err := safePath(tmpDir, name)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
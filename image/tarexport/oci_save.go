@@ -0,0 +1,235 @@
+package tarexport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/docker/distribution/digest"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/system"
+)
+
+type ociSaveSession struct {
+	*tarexporter
+	outDir     string
+	images     map[image.ID]*imageDescriptor
+	savedBlobs map[digest.Digest]int64
+}
+
+func (l *ociExporter) Save(names []string, outStream io.Writer) error {
+	images, err := l.parseNames(names)
+	if err != nil {
+		return err
+	}
+
+	return (&ociSaveSession{tarexporter: l.tarexporter, images: images}).save(outStream)
+}
+
+func (s *ociSaveSession) save(outStream io.Writer) error {
+	s.savedBlobs = make(map[digest.Digest]int64)
+
+	tempDir, err := ioutil.TempDir("", "docker-export-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	s.outDir = tempDir
+	if err := os.MkdirAll(filepath.Join(tempDir, ociBlobsDirName, string(digest.Canonical)), 0755); err != nil {
+		return err
+	}
+
+	// The images are sorted so that the same images always give the same
+	// index.
+	var ids []string
+	for id := range s.images {
+		ids = append(ids, id.String())
+	}
+	sort.Strings(ids)
+
+	index := ociIndex{SchemaVersion: 2, Manifests: []ociDescriptor{}}
+	for _, idStr := range ids {
+		id := image.ID(idStr)
+		desc, err := s.saveImage(id)
+		if err != nil {
+			return err
+		}
+
+		refs := s.images[id].refs
+		if len(refs) == 0 {
+			index.Manifests = append(index.Manifests, desc)
+		}
+		for _, ref := range refs {
+			d := desc
+			d.Annotations = map[string]string{
+				imageNameAnnotation:  ref.String(),
+				ociRefNameAnnotation: ref.Tag(),
+			}
+			index.Manifests = append(index.Manifests, d)
+		}
+		s.tarexporter.loggerImgEvent.LogImageEvent(id.String(), id.String(), "save")
+	}
+
+	if err := s.writeFile(ociLayoutFileName, ociLayout{ImageLayoutVersion: ociImageLayoutVersion}); err != nil {
+		return err
+	}
+	if err := s.writeFile(ociIndexFileName, index); err != nil {
+		return err
+	}
+
+	fs, err := archive.Tar(tempDir, archive.Uncompressed)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	if _, err := io.Copy(outStream, fs); err != nil {
+		return err
+	}
+	return nil
+}
+
+// saveImage writes the config, the layers and the manifest of the image id
+// as blobs, and returns the descriptor of the manifest.
+func (s *ociSaveSession) saveImage(id image.ID) (ociDescriptor, error) {
+	img, err := s.is.Get(id)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+
+	if len(img.RootFS.DiffIDs) == 0 {
+		return ociDescriptor{}, fmt.Errorf("empty export - not implemented")
+	}
+
+	m := ociManifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeOCIManifest,
+	}
+	for i := range img.RootFS.DiffIDs {
+		rootFS := *img.RootFS
+		rootFS.DiffIDs = rootFS.DiffIDs[:i+1]
+		desc, err := s.saveLayer(rootFS.ChainID(), img.Created)
+		if err != nil {
+			return ociDescriptor{}, err
+		}
+		m.Layers = append(m.Layers, desc)
+	}
+
+	m.Config, err = s.saveBlob(img.RawJSON(), mediaTypeOCIConfig)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+
+	manifestJSON, err := json.Marshal(m)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	desc, err := s.saveBlob(manifestJSON, mediaTypeOCIManifest)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	desc.Platform = &ociPlatform{
+		Architecture: img.Architecture,
+		OS:           img.OS,
+	}
+	return desc, nil
+}
+
+// saveLayer writes the uncompressed tar of the layer id as a blob, and
+// returns its descriptor.
+func (s *ociSaveSession) saveLayer(id layer.ChainID, createdTime time.Time) (ociDescriptor, error) {
+	l, err := s.ls.Get(id)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	defer layer.ReleaseAndLog(s.ls, l)
+
+	// The digest of the uncompressed tar of a layer is its DiffID.
+	dgst := digest.Digest(l.DiffID())
+	if size, exists := s.savedBlobs[dgst]; exists {
+		return ociDescriptor{MediaType: mediaTypeOCILayer, Digest: dgst, Size: size}, nil
+	}
+
+	tarFile, err := ioutil.TempFile(filepath.Join(s.outDir, ociBlobsDirName), "layer-")
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	defer os.Remove(tarFile.Name())
+	defer tarFile.Close()
+
+	arch, err := l.TarStream()
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	defer arch.Close()
+
+	digester := digest.Canonical.New()
+	size, err := io.Copy(io.MultiWriter(tarFile, digester.Hash()), arch)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	if err := tarFile.Close(); err != nil {
+		return ociDescriptor{}, err
+	}
+	if actual := digester.Digest(); actual != dgst {
+		return ociDescriptor{}, fmt.Errorf("invalid tar stream for layer %s: got digest %s", dgst, actual)
+	}
+
+	blobPath := s.blobPath(dgst)
+	if err := os.Rename(tarFile.Name(), blobPath); err != nil {
+		return ociDescriptor{}, err
+	}
+	if err := os.Chmod(blobPath, 0644); err != nil {
+		return ociDescriptor{}, err
+	}
+	if err := system.Chtimes(blobPath, createdTime, createdTime); err != nil {
+		return ociDescriptor{}, err
+	}
+
+	s.savedBlobs[dgst] = size
+	return ociDescriptor{MediaType: mediaTypeOCILayer, Digest: dgst, Size: size}, nil
+}
+
+// saveBlob writes data as a blob, and returns its descriptor.
+func (s *ociSaveSession) saveBlob(data []byte, mediaType string) (ociDescriptor, error) {
+	dgst := digest.FromBytes(data)
+	desc := ociDescriptor{MediaType: mediaType, Digest: dgst, Size: int64(len(data))}
+	if _, exists := s.savedBlobs[dgst]; exists {
+		return desc, nil
+	}
+
+	blobPath := s.blobPath(dgst)
+	if err := ioutil.WriteFile(blobPath, data, 0644); err != nil {
+		return ociDescriptor{}, err
+	}
+	if err := system.Chtimes(blobPath, time.Unix(0, 0), time.Unix(0, 0)); err != nil {
+		return ociDescriptor{}, err
+	}
+	s.savedBlobs[dgst] = desc.Size
+	return desc, nil
+}
+
+func (s *ociSaveSession) blobPath(dgst digest.Digest) string {
+	return filepath.Join(s.outDir, ociBlobsDirName, string(dgst.Algorithm()), dgst.Hex())
+}
+
+// writeFile writes v as JSON in the file name at the root of the layout.
+func (s *ociSaveSession) writeFile(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(s.outDir, name)
+	if err := ioutil.WriteFile(p, data, 0644); err != nil {
+		return err
+	}
+	return system.Chtimes(p, time.Unix(0, 0), time.Unix(0, 0))
+}
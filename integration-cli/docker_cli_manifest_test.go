@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/pkg/integration/checker"
+	"github.com/go-check/check"
+)
+
+func (s *DockerRegistrySuite) TestManifestCreateAndPush(c *check.C) {
+	testRequires(c, NotArm)
+	amd64Name := fmt.Sprintf("%v/dockercli/busybox-amd64", privateRegistryURL)
+	armName := fmt.Sprintf("%v/dockercli/busybox-arm", privateRegistryURL)
+	listName := fmt.Sprintf("%v/dockercli/busybox-multi:latest", privateRegistryURL)
+
+	for _, name := range []string{amd64Name, armName} {
+		dockerCmd(c, "tag", "busybox", name)
+		dockerCmd(c, "push", name)
+		dockerCmd(c, "rmi", name)
+	}
+
+	out, _ := dockerCmd(c, "manifest", "create", listName, amd64Name, armName)
+	c.Assert(out, checker.Contains, "Created manifest list")
+
+	out, _, err := dockerCmdWithError("manifest", "create", listName, amd64Name)
+	c.Assert(err, checker.NotNil, check.Commentf("%s", out))
+	c.Assert(out, checker.Contains, "--amend")
+
+	dockerCmd(c, "manifest", "annotate", listName, armName, "--arch", "arm", "--variant", "v7")
+	out, _ = dockerCmd(c, "manifest", "inspect", listName, armName)
+	c.Assert(out, checker.Contains, `"variant": "v7"`)
+
+	out, _ = dockerCmd(c, "manifest", "push", "--purge", listName)
+	c.Assert(strings.TrimSpace(out), checker.HasPrefix, "sha256:")
+
+	// The manifest list is removed once pushed, and inspect fetches it
+	out, _ = dockerCmd(c, "manifest", "inspect", listName)
+	c.Assert(out, checker.Contains, "application/vnd.docker.distribution.manifest.list.v2+json")
+
+	dockerCmd(c, "pull", "--platform", "linux/arm/v7", listName)
+	c.Assert(inspectField(c, listName, "Platform.Variant"), checker.Equals, "v7")
+	dockerCmd(c, "rmi", listName)
+
+	dockerCmd(c, "pull", listName)
+	c.Assert(inspectField(c, listName, "Platform.Architecture"), checker.Equals, "amd64")
+	dockerCmd(c, "rmi", listName)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/docker/docker/pkg/integration/checker"
+	"github.com/go-check/check"
+)
+
+func (s *DockerSuite) TestSystemPruneRemovesUnusedObjects(c *check.C) {
+	out, _ := dockerCmd(c, "run", "-d", "busybox", "true")
+	stopped := strings.TrimSpace(out)
+	dockerCmd(c, "wait", stopped)
+	running, _ := runSleepingContainer(c)
+	running = strings.TrimSpace(running)
+	dockerCmd(c, "volume", "create", "--name", "prune-unused")
+	dockerCmd(c, "network", "create", "prune-unused")
+
+	out, _ = dockerCmd(c, "system", "prune", "--force")
+	c.Assert(out, checker.Contains, stopped)
+	c.Assert(out, checker.Contains, "prune-unused")
+	c.Assert(out, checker.Contains, "Total reclaimed space:")
+
+	out, _ = dockerCmd(c, "ps", "-a", "-q", "--no-trunc")
+	c.Assert(out, checker.Not(checker.Contains), stopped)
+	c.Assert(out, checker.Contains, running)
+
+	_, _, err := dockerCmdWithError("volume", "inspect", "prune-unused")
+	c.Assert(err, checker.NotNil)
+	_, _, err = dockerCmdWithError("network", "inspect", "prune-unused")
+	c.Assert(err, checker.NotNil)
+}
+
+func (s *DockerSuite) TestSystemPruneLabelFilter(c *check.C) {
+	out, _ := dockerCmd(c, "run", "-d", "--label", "prune=yes", "busybox", "true")
+	labeled := strings.TrimSpace(out)
+	out, _ = dockerCmd(c, "run", "-d", "busybox", "true")
+	unlabeled := strings.TrimSpace(out)
+	dockerCmd(c, "wait", labeled, unlabeled)
+
+	out, _ = dockerCmd(c, "system", "prune", "--force", "--filter", "label=prune=yes")
+	c.Assert(out, checker.Contains, labeled)
+	c.Assert(out, checker.Not(checker.Contains), unlabeled)
+}
@@ -304,41 +304,15 @@ func (s *DockerSchema1RegistrySuite) TestPullNoLayers(c *check.C) {
 	testPullNoLayers(c)
 }
 
-func (s *DockerRegistrySuite) TestPullManifestList(c *check.C) {
-	testRequires(c, NotArm)
-	pushDigest, err := setupImage(c)
-	c.Assert(err, checker.IsNil, check.Commentf("error setting up image"))
-
-	// Inject a manifest list into the registry
+// injectManifestList writes a manifest list of manifests in the registry
+// stored in registryDir, tags it as latest and returns its digest.
+func injectManifestList(c *check.C, registryDir string, manifests []manifestlist.ManifestDescriptor) digest.Digest {
 	manifestList := &manifestlist.ManifestList{
 		Versioned: manifest.Versioned{
 			SchemaVersion: 2,
 			MediaType:     manifestlist.MediaTypeManifestList,
 		},
-		Manifests: []manifestlist.ManifestDescriptor{
-			{
-				Descriptor: distribution.Descriptor{
-					Digest:    "sha256:1a9ec845ee94c202b2d5da74a24f0ed2058318bfa9879fa541efaecba272e86b",
-					Size:      3253,
-					MediaType: schema2.MediaTypeManifest,
-				},
-				Platform: manifestlist.PlatformSpec{
-					Architecture: "bogus_arch",
-					OS:           "bogus_os",
-				},
-			},
-			{
-				Descriptor: distribution.Descriptor{
-					Digest:    pushDigest,
-					Size:      3253,
-					MediaType: schema2.MediaTypeManifest,
-				},
-				Platform: manifestlist.PlatformSpec{
-					Architecture: runtime.GOARCH,
-					OS:           runtime.GOOS,
-				},
-			},
-		},
+		Manifests: manifests,
 	}
 
 	manifestListJSON, err := json.MarshalIndent(manifestList, "", "   ")
@@ -347,7 +321,7 @@ func (s *DockerRegistrySuite) TestPullManifestList(c *check.C) {
 	manifestListDigest := digest.FromBytes(manifestListJSON)
 	hexDigest := manifestListDigest.Hex()
 
-	registryV2Path := filepath.Join(s.reg.dir, "docker", "registry", "v2")
+	registryV2Path := filepath.Join(registryDir, "docker", "registry", "v2")
 
 	// Write manifest list to blob store
 	blobDir := filepath.Join(registryV2Path, "blobs", "sha256", hexDigest[:2], hexDigest)
@@ -370,6 +344,40 @@ func (s *DockerRegistrySuite) TestPullManifestList(c *check.C) {
 	err = ioutil.WriteFile(tagPath, []byte(manifestListDigest.String()), 0644)
 	c.Assert(err, checker.IsNil, check.Commentf("error writing tag link"))
 
+	return manifestListDigest
+}
+
+func (s *DockerRegistrySuite) TestPullManifestList(c *check.C) {
+	testRequires(c, NotArm)
+	pushDigest, err := setupImage(c)
+	c.Assert(err, checker.IsNil, check.Commentf("error setting up image"))
+
+	// Inject a manifest list into the registry
+	manifestListDigest := injectManifestList(c, s.reg.dir, []manifestlist.ManifestDescriptor{
+		{
+			Descriptor: distribution.Descriptor{
+				Digest:    "sha256:1a9ec845ee94c202b2d5da74a24f0ed2058318bfa9879fa541efaecba272e86b",
+				Size:      3253,
+				MediaType: schema2.MediaTypeManifest,
+			},
+			Platform: manifestlist.PlatformSpec{
+				Architecture: "bogus_arch",
+				OS:           "bogus_os",
+			},
+		},
+		{
+			Descriptor: distribution.Descriptor{
+				Digest:    pushDigest,
+				Size:      3253,
+				MediaType: schema2.MediaTypeManifest,
+			},
+			Platform: manifestlist.PlatformSpec{
+				Architecture: runtime.GOARCH,
+				OS:           runtime.GOOS,
+			},
+		},
+	})
+
 	// Verify that the image can be pulled through the manifest list.
 	out, _ := dockerCmd(c, "pull", repoName)
 
@@ -384,6 +392,60 @@ func (s *DockerRegistrySuite) TestPullManifestList(c *check.C) {
 	// Was the image actually created?
 	dockerCmd(c, "inspect", repoName)
 
+	// The selected platform is shown
+	platform := inspectField(c, repoName, "Platform.OS") + "/" + inspectField(c, repoName, "Platform.Architecture")
+	c.Assert(platform, checker.Equals, runtime.GOOS+"/"+runtime.GOARCH)
+
+	dockerCmd(c, "rmi", repoName)
+}
+
+func (s *DockerRegistrySuite) TestPullManifestListPlatform(c *check.C) {
+	testRequires(c, NotArm)
+	pushDigest, err := setupImage(c)
+	c.Assert(err, checker.IsNil, check.Commentf("error setting up image"))
+
+	// The pushed image is listed for arm v6, and a missing one for arm v8
+	injectManifestList(c, s.reg.dir, []manifestlist.ManifestDescriptor{
+		{
+			Descriptor: distribution.Descriptor{
+				Digest:    "sha256:1a9ec845ee94c202b2d5da74a24f0ed2058318bfa9879fa541efaecba272e86b",
+				Size:      3253,
+				MediaType: schema2.MediaTypeManifest,
+			},
+			Platform: manifestlist.PlatformSpec{
+				Architecture: "arm",
+				OS:           "linux",
+				Variant:      "v8",
+			},
+		},
+		{
+			Descriptor: distribution.Descriptor{
+				Digest:    pushDigest,
+				Size:      3253,
+				MediaType: schema2.MediaTypeManifest,
+			},
+			Platform: manifestlist.PlatformSpec{
+				Architecture: "arm",
+				OS:           "linux",
+				Variant:      "v6",
+			},
+		},
+	})
+
+	// No entry matches the platform of the daemon
+	out, _, err := dockerCmdWithError("pull", repoName)
+	c.Assert(err, checker.NotNil, check.Commentf("%s", out))
+	c.Assert(out, checker.Contains, "no matching manifest")
+
+	out, _, err = dockerCmdWithError("pull", "--platform", "linux", repoName)
+	c.Assert(err, checker.NotNil, check.Commentf("%s", out))
+	c.Assert(out, checker.Contains, "invalid platform")
+
+	// An arm v7 CPU runs the arm v6 image
+	dockerCmd(c, "pull", "--platform", "linux/arm/v7", repoName)
+	c.Assert(inspectField(c, repoName, "Platform.Architecture"), checker.Equals, "arm")
+	c.Assert(inspectField(c, repoName, "Platform.Variant"), checker.Equals, "v6")
+
 	dockerCmd(c, "rmi", repoName)
 }
 
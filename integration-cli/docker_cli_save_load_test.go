@@ -380,3 +380,67 @@ func (s *DockerSuite) TestSaveLoadNoTag(c *check.C) {
 	c.Assert(out, checker.Contains, "Loaded image: "+name+":latest")
 	c.Assert(out, checker.Not(checker.Contains), "Loaded image ID:")
 }
+
+func (s *DockerSuite) TestSaveOCIAndLoadRepo(c *check.C) {
+	testRequires(c, DaemonIsLinux)
+	name := "test-save-oci-and-load-repo"
+	dockerCmd(c, "run", "--name", name, "busybox", "true")
+
+	repoName := "foobar-save-load-test-oci"
+	deleteImages(repoName)
+	dockerCmd(c, "commit", name, repoName)
+
+	before, _ := dockerCmd(c, "inspect", repoName)
+
+	out, _, err := runCommandPipelineWithOutput(
+		exec.Command(dockerBinary, "save", "--format", "oci", repoName),
+		exec.Command(dockerBinary, "load"))
+	c.Assert(err, checker.IsNil, check.Commentf("failed to save and load repo: %s, %v", out, err))
+
+	after, _ := dockerCmd(c, "inspect", repoName)
+	c.Assert(before, checker.Equals, after, check.Commentf("inspect is not the same after a save / load"))
+}
+
+func (s *DockerSuite) TestSaveOCILayoutAndLoadDirectory(c *check.C) {
+	testRequires(c, DaemonIsLinux)
+	repoName := "foobar-save-oci-layout:v1"
+	dockerCmd(c, "tag", "busybox", repoName)
+	id := inspectField(c, repoName, "Id")
+
+	tmpDir, err := ioutil.TempDir("", "save-oci-layout")
+	c.Assert(err, checker.IsNil)
+	defer os.RemoveAll(tmpDir)
+
+	out, _, err := runCommandPipelineWithOutput(
+		exec.Command(dockerBinary, "save", "--format", "oci", repoName),
+		exec.Command("tar", "-xf", "-", "-C", tmpDir),
+	)
+	c.Assert(err, checker.IsNil, check.Commentf("failed to save and extract image: %s", out))
+
+	layout, err := ioutil.ReadFile(filepath.Join(tmpDir, "oci-layout"))
+	c.Assert(err, checker.IsNil)
+	c.Assert(string(layout), checker.Equals, `{"imageLayoutVersion":"1.0.0"}`)
+
+	var index struct {
+		Manifests []struct {
+			MediaType   string
+			Digest      digest.Digest
+			Annotations map[string]string
+		}
+	}
+	indexJSON, err := ioutil.ReadFile(filepath.Join(tmpDir, "index.json"))
+	c.Assert(err, checker.IsNil)
+	c.Assert(json.Unmarshal(indexJSON, &index), checker.IsNil)
+	c.Assert(index.Manifests, checker.HasLen, 1)
+	c.Assert(index.Manifests[0].MediaType, checker.Equals, "application/vnd.oci.image.manifest.v1+json")
+	c.Assert(index.Manifests[0].Annotations["org.opencontainers.image.ref.name"], checker.Equals, "v1")
+	_, err = os.Stat(filepath.Join(tmpDir, "blobs", "sha256", index.Manifests[0].Digest.Hex()))
+	c.Assert(err, checker.IsNil)
+	_, err = os.Stat(filepath.Join(tmpDir, "blobs", "sha256", strings.TrimPrefix(id, "sha256:")))
+	c.Assert(err, checker.IsNil, check.Commentf("the image config should be a blob"))
+
+	dockerCmd(c, "rmi", repoName)
+	out, _ = dockerCmd(c, "load", "-i", tmpDir)
+	c.Assert(out, checker.Contains, "Loaded image: "+repoName)
+	c.Assert(inspectField(c, repoName, "Id"), checker.Equals, id)
+}
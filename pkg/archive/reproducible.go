@@ -0,0 +1,108 @@
+package archive
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/pkg/ioutils"
+	"github.com/docker/docker/pkg/pools"
+)
+
+// reproducibleEntry is an entry of an archive being made reproducible, whose
+// content was spooled at offset in a temporary file.
+type reproducibleEntry struct {
+	hdr    *tar.Header
+	offset int64
+}
+
+// Reproducible reads the tar archive from in and returns an archive with the
+// same entries, whose bytes only depend on their names, content and
+// metadata, except for time:
+//
+//  * modification times later than epoch are set to epoch, and all of them
+//    are truncated to the second
+//  * access and change times are dropped
+//  * entries are sorted by name, hard links coming after all other entries
+//    so that their target is always extracted first
+//
+// The content of the entries is spooled to a temporary file, which is
+// removed when the returned archive is closed.
+func Reproducible(in io.Reader, epoch time.Time) (Archive, error) {
+	spool, err := ioutil.TempFile("", "docker-reproducible-")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() error {
+		err := spool.Close()
+		os.Remove(spool.Name())
+		return err
+	}
+
+	var (
+		entries []reproducibleEntry
+		offset  int64
+	)
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		n, err := pools.Copy(spool, tr)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		if hdr.ModTime.After(epoch) {
+			hdr.ModTime = epoch
+		}
+		hdr.ModTime = hdr.ModTime.Truncate(time.Second)
+		hdr.AccessTime = time.Time{}
+		hdr.ChangeTime = time.Time{}
+		entries = append(entries, reproducibleEntry{hdr: hdr, offset: offset})
+		offset += n
+	}
+
+	sort.Sort(byReproducibleOrder(entries))
+
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		for _, e := range entries {
+			if err := tw.WriteHeader(e.hdr); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := pools.Copy(tw, io.NewSectionReader(spool, e.offset, e.hdr.Size)); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(tw.Close())
+	}()
+
+	return ioutils.NewReadCloserWrapper(pr, func() error {
+		pr.Close()
+		return cleanup()
+	}), nil
+}
+
+type byReproducibleOrder []reproducibleEntry
+
+func (e byReproducibleOrder) Len() int      { return len(e) }
+func (e byReproducibleOrder) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e byReproducibleOrder) Less(i, j int) bool {
+	iLink, jLink := e[i].hdr.Typeflag == tar.TypeLink, e[j].hdr.Typeflag == tar.TypeLink
+	if iLink != jLink {
+		return jLink
+	}
+	return e[i].hdr.Name < e[j].hdr.Name
+}
@@ -0,0 +1,102 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReproducible(t *testing.T) {
+	epoch := time.Unix(1000000000, 0)
+	before := epoch.Add(-time.Hour)
+
+	makeArchive := func(order []string, now time.Time) []byte {
+		entries := map[string]*tar.Header{
+			"dir/":         {Typeflag: tar.TypeDir, Mode: 0755, ModTime: now},
+			"dir/file":     {Typeflag: tar.TypeReg, Mode: 0644, ModTime: before, AccessTime: now},
+			"dir/link":     {Typeflag: tar.TypeLink, Linkname: "dir/file", ModTime: now},
+			"dir/new-file": {Typeflag: tar.TypeReg, Mode: 0644, ModTime: now, ChangeTime: now},
+		}
+		buf := new(bytes.Buffer)
+		tw := tar.NewWriter(buf)
+		for _, name := range order {
+			hdr := entries[name]
+			hdr.Name = name
+			content := ""
+			if hdr.Typeflag == tar.TypeReg {
+				content = "content of " + name
+			}
+			hdr.Size = int64(len(content))
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write([]byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		rdr, err := Reproducible(buf, epoch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rdr.Close()
+		out, err := ioutil.ReadAll(rdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	first := makeArchive([]string{"dir/", "dir/file", "dir/link", "dir/new-file"}, time.Now())
+	second := makeArchive([]string{"dir/new-file", "dir/", "dir/file", "dir/link"}, time.Now().Add(time.Minute))
+	if !bytes.Equal(first, second) {
+		t.Fatal("Expected identical archives")
+	}
+
+	var (
+		names   []string
+		mtimes  []time.Time
+		content []string
+	)
+	tr := tar.NewReader(bytes.NewReader(first))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hdr.AccessTime.IsZero() || !hdr.ChangeTime.IsZero() {
+			t.Fatalf("Expected no access and change time for %s", hdr.Name)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		mtimes = append(mtimes, hdr.ModTime)
+		content = append(content, string(b))
+	}
+
+	expectedNames := []string{"dir/", "dir/file", "dir/new-file", "dir/link"}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Fatalf("Expected entries %v, got %v", expectedNames, names)
+	}
+	expectedContent := []string{"", "content of dir/file", "content of dir/new-file", ""}
+	if !reflect.DeepEqual(content, expectedContent) {
+		t.Fatalf("Expected content %q, got %q", expectedContent, content)
+	}
+	for i, expected := range []time.Time{epoch, before, epoch, epoch} {
+		if !mtimes[i].Equal(expected) {
+			t.Fatalf("Expected %s to have mtime %s, got %s", names[i], expected, mtimes[i])
+		}
+	}
+}
@@ -102,7 +102,16 @@ func OptimizedMatches(file string, patterns []string, patDirs [][]string) (bool,
 
 		if !match && parentPath != "." {
 			// Check to see if the pattern matches one of our parent dirs.
-			if len(patDirs[i]) <= len(parentPathDirs) {
+			if strings.Contains(pattern, "**") {
+				// The number of directories matched by "**" is unknown,
+				// so try every parent.
+				for dir := parentPath; dir != "." && !match; dir = filepath.Dir(dir) {
+					match, _ = regexpMatch(pattern, dir)
+					if dir == filepath.Dir(dir) {
+						break
+					}
+				}
+			} else if len(patDirs[i]) <= len(parentPathDirs) {
 				match, _ = regexpMatch(strings.Join(patDirs[i], string(os.PathSeparator)),
 					strings.Join(parentPathDirs[:len(patDirs[i])], string(os.PathSeparator)))
 			}
@@ -153,25 +162,37 @@ func regexpMatch(pattern, path string) (bool, error) {
 		escSL += `\`
 	}
 
+	// As in .gitignore files, "**" only matches across directories when it
+	// is a whole path component, so track whether the previous character
+	// started a new one.
+	componentStart := true
 	for scan.Peek() != scanner.EOF {
 		ch := scan.Next()
+		atComponentStart := componentStart
+		componentStart = string(ch) == sl
 
 		if ch == '*' {
 			if scan.Peek() == '*' {
 				// is some flavor of "**"
 				scan.Next()
 
-				if scan.Peek() == scanner.EOF {
-					// is "**EOF" - to align with .gitignore just accept all
+				switch {
+				case atComponentStart && scan.Peek() == scanner.EOF:
+					// is "**EOF" - everything, at any depth
 					regStr += ".*"
-				} else {
-					// is "**"
-					regStr += "((.*" + escSL + ")|([^" + escSL + "]*))"
-				}
-
-				// Treat **/ as ** so eat the "/"
-				if string(scan.Peek()) == sl {
+				case atComponentStart && string(scan.Peek()) == sl:
+					// is "**/" - zero or more directories
 					scan.Next()
+					componentStart = true
+					if scan.Peek() == scanner.EOF {
+						// "**/EOF", a file or anything in a directory
+						regStr += "((.*" + escSL + ")|([^" + escSL + "]*))"
+					} else {
+						regStr += "(.*" + escSL + ")?"
+					}
+				default:
+					// "**" within a path component is the same as "*"
+					regStr += "[^" + escSL + "]*"
 				}
 			} else {
 				// is "*" so map it to anything but "/"
@@ -192,6 +213,7 @@ func regexpMatch(pattern, path string) (bool, error) {
 				// and then just continue because filepath.Match on
 				// Windows doesn't allow escaping at all
 				regStr += escSL
+				componentStart = true
 				continue
 			}
 			if scan.Peek() != scanner.EOF {
@@ -261,6 +261,22 @@ func TestExclusionPatternMatchesPatternAfter(t *testing.T) {
 	}
 }
 
+// A "**" pattern matching a directory at any depth should match its content.
+func TestPatternMatchesNestedDirectory(t *testing.T) {
+	match, _ := Matches("app/lib/node_modules/dep/index.js", []string{"**/node_modules"})
+	if match != true {
+		t.Errorf("failed to get a true match on nested directory pattern, got %v", match)
+	}
+	match, _ = Matches("app/lib/my_node_modules/index.js", []string{"**/node_modules"})
+	if match != false {
+		t.Errorf("failed to get a false match on partial directory name, got %v", match)
+	}
+	match, _ = Matches("app/node_modules/dep/keep.js", []string{"**/node_modules", "!app/node_modules/dep/keep.js"})
+	if match != false {
+		t.Errorf("failed to get a false match on exclusion pattern, got %v", match)
+	}
+}
+
 // A filename evaluating to . should return false.
 func TestExclusionPatternMatchesWholeDirectory(t *testing.T) {
 	match, _ := Matches(".", []string{"*.go"})
@@ -339,9 +355,9 @@ func TestMatches(t *testing.T) {
 		{"**/dir2/**", "dir/dir2/dir3/file", true},
 		{"**/dir2/**", "dir/dir2/dir3/file/", true},
 		{"**file", "file", true},
-		{"**file", "dir/file", true},
+		{"**file", "dir/file", false},
 		{"**/file", "dir/file", true},
-		{"**file", "dir/dir/file", true},
+		{"**file", "dir/dir/file", false},
 		{"**/file", "dir/dir/file", true},
 		{"**/file*", "dir/dir/file", true},
 		{"**/file*", "dir/dir/file.txt", true},
@@ -353,8 +369,9 @@ func TestMatches(t *testing.T) {
 		{"**/*.txt", "file.txt", true},
 		{"**/**/*.txt", "file.txt", true},
 		{"a**/*.txt", "a/file.txt", true},
-		{"a**/*.txt", "a/dir/file.txt", true},
-		{"a**/*.txt", "a/dir/dir/file.txt", true},
+		{"a**/*.txt", "a/dir/file.txt", false},
+		{"a**/*.txt", "a/dir/dir/file.txt", false},
+		{"a**/*.txt", "abc/file.txt", true},
 		{"a/*.txt", "a/dir/file.txt", false},
 		{"a/*.txt", "a/file.txt", true},
 		{"a/*.txt**", "a/file.txt", true},
@@ -379,6 +396,16 @@ func TestMatches(t *testing.T) {
 		{"abc/**", "abc", false},
 		{"abc/**", "abc/def", true},
 		{"abc/**", "abc/def/ghi", true},
+		{"**/foo", "xfoo", false},
+		{"**/foo", "dir/xfoo", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/xb", false},
+		{"a/**/b", "ab", false},
+		{"foo**bar", "foobar", true},
+		{"foo**bar", "foo/bar", false},
+		{"a/b**", "a/b/c", false},
+		{"a/b**", "a/bc", true},
 	}
 
 	for _, test := range tests {
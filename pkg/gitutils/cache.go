@@ -0,0 +1,353 @@
+package gitutils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/pkg/directory"
+	"github.com/docker/docker/pkg/urlutil"
+)
+
+// buildRef is the ref of the cached repositories pointing to the commit
+// fetched for the last checkout.
+const buildRef = "refs/docker/build"
+
+// CheckoutOptions holds the options of a checkout from a Cache.
+type CheckoutOptions struct {
+	// RecurseSubmodules checks out the submodules of the repository.
+	// They are fetched from their remote and are not cached.
+	RecurseSubmodules bool
+	// Username and Password are sent to the HTTP(S) remote of the
+	// repository, instead of the credentials embedded in its URL if any.
+	Username string
+	Password string
+}
+
+// Cache keeps bare repositories of the remotes checked out through it, so
+// that checking out a remote again only fetches the objects which changed.
+// Repositories are keyed by the URL of their remote, without its fragment
+// and credentials. When the repositories take more than the max size of the
+// cache, the least recently checked out ones are removed.
+type Cache struct {
+	root    string
+	maxSize int64
+	mu      sync.Mutex
+	repos   map[string]*sync.Mutex
+	// users counts the checkouts using each repository, which is not
+	// removed while it is in use.
+	users map[string]int
+}
+
+// NewCache creates a Cache keeping its repositories in root, which take at
+// most maxSize bytes, or any size if maxSize is 0.
+func NewCache(root string, maxSize int64) (*Cache, error) {
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, err
+	}
+	return &Cache{
+		root:    root,
+		maxSize: maxSize,
+		repos:   make(map[string]*sync.Mutex),
+		users:   make(map[string]int),
+	}, nil
+}
+
+// Checkout checks out the remote repository at remoteURL into a newly
+// created directory which will be under "docker-build-git", and returns it
+// along with the directory to use as the build context. As with Clone, the
+// fragment of remoteURL may select a ref and a directory with the "#ref:dir"
+// syntax. The ref is fetched with a depth of 1 when the remote allows it.
+// The ID of the commit checked out is returned as well.
+// The caller is responsible for removing the returned root.
+func (c *Cache) Checkout(remoteURL string, opts CheckoutOptions) (root, contextDir, commit string, err error) {
+	remote, fragment, env, err := parseRemote(remoteURL, opts)
+	if err != nil {
+		return "", "", "", err
+	}
+	root, contextDir, commit, err = c.checkout(remote, fragment, env, opts.RecurseSubmodules)
+	if err == nil && c.maxSize > 0 {
+		if _, _, err := c.prune(c.maxSize, repositoryKey(remote)); err != nil {
+			logrus.Warnf("Failed to remove the least recently used repositories of the git cache: %v", err)
+		}
+	}
+	return root, contextDir, commit, err
+}
+
+// Prune removes the repositories which are not in use, least recently
+// checked out first, until the cache takes at most keepStorage bytes. It
+// returns the remotes of the repositories removed and the space reclaimed.
+func (c *Cache) Prune(keepStorage int64) (removed []string, reclaimed int64, err error) {
+	return c.prune(keepStorage, "")
+}
+
+// cachedRepository is a repository of the cache, as considered for removal.
+type cachedRepository struct {
+	key      string
+	size     int64
+	lastUsed time.Time
+}
+
+type byLastUsed []cachedRepository
+
+func (r byLastUsed) Len() int           { return len(r) }
+func (r byLastUsed) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r byLastUsed) Less(i, j int) bool { return r[i].lastUsed.Before(r[j].lastUsed) }
+
+// prune is like Prune, but never removes the repository keep.
+func (c *Cache) prune(keepStorage int64, keep string) (removed []string, reclaimed int64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	infos, err := ioutil.ReadDir(c.root)
+	if err != nil {
+		return nil, 0, err
+	}
+	var (
+		repos []cachedRepository
+		total int64
+	)
+	for _, info := range infos {
+		// Repositories being created are skipped.
+		if !info.IsDir() || strings.HasPrefix(info.Name(), "tmp-") {
+			continue
+		}
+		size, err := directory.Size(filepath.Join(c.root, info.Name()))
+		if err != nil {
+			return nil, 0, err
+		}
+		repos = append(repos, cachedRepository{key: info.Name(), size: size, lastUsed: info.ModTime()})
+		total += size
+	}
+	sort.Sort(byLastUsed(repos))
+
+	removed = []string{}
+	for _, r := range repos {
+		if total <= keepStorage {
+			break
+		}
+		if r.key == keep || c.users[r.key] > 0 {
+			continue
+		}
+		repo := filepath.Join(c.root, r.key)
+		remote, err := git("--git-dir", repo, "config", "--get", "remote.origin.url")
+		if err != nil {
+			remote = []byte(r.key)
+		}
+		if err := os.RemoveAll(repo); err != nil {
+			return removed, reclaimed, err
+		}
+		total -= r.size
+		reclaimed += r.size
+		removed = append(removed, strings.TrimSpace(string(remote)))
+	}
+	return removed, reclaimed, nil
+}
+
+func (c *Cache) checkout(remote, fragment string, env []string, recurseSubmodules bool) (root, contextDir, commit string, err error) {
+	refAndDir := strings.SplitN(fragment, ":", 2)
+	ref := refAndDir[0]
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	repo, unlock, err := c.repository(remote)
+	if err != nil {
+		return "", "", "", err
+	}
+	defer unlock()
+
+	if err := fetch(repo, ref, env); err != nil {
+		return "", "", "", err
+	}
+	// The modification time of the repository is the time it was last
+	// used, which orders the removal of the repositories.
+	now := time.Now()
+	if err := os.Chtimes(repo, now, now); err != nil {
+		return "", "", "", err
+	}
+
+	root, err = ioutil.TempDir("", "docker-build-git")
+	if err != nil {
+		return "", "", "", err
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(root)
+		}
+	}()
+
+	// The checkout gets its objects from the cached repository, then points
+	// to the real remote so that relative submodule URLs are resolved
+	// against it.
+	steps := [][]string{
+		{"init", "--quiet"},
+		{"fetch", "--quiet", "--update-shallow", repo, buildRef},
+		{"checkout", "--quiet", "FETCH_HEAD"},
+		{"remote", "add", "origin", remote},
+	}
+	if recurseSubmodules {
+		steps = append(steps, []string{"submodule", "update", "--init", "--recursive"})
+	}
+	for _, args := range steps {
+		if output, err := gitEnv(root, env, args...); err != nil {
+			return "", "", "", fmt.Errorf("Error trying to use git: %s (%s)", err, output)
+		}
+	}
+
+	output, err := gitEnv(root, nil, "rev-parse", "HEAD")
+	if err != nil {
+		return "", "", "", fmt.Errorf("Error trying to use git: %s (%s)", err, output)
+	}
+	commit = strings.TrimSpace(string(output))
+
+	contextDir = root
+	if len(refAndDir) > 1 {
+		contextDir, err = subdirectory(root, refAndDir[1])
+		if err != nil {
+			return "", "", "", err
+		}
+	}
+	return root, contextDir, commit, nil
+}
+
+// repositoryKey returns the name of the directory of the cached repository
+// of remote.
+func repositoryKey(remote string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(remote)))
+}
+
+// repository returns the path of the cached repository of remote, creating
+// it if needed, locked until unlock is called.
+func (c *Cache) repository(remote string) (repo string, unlock func(), err error) {
+	key := repositoryKey(remote)
+
+	c.mu.Lock()
+	mu, ok := c.repos[key]
+	if !ok {
+		mu = &sync.Mutex{}
+		c.repos[key] = mu
+	}
+	c.users[key]++
+	c.mu.Unlock()
+
+	mu.Lock()
+	unlock = func() {
+		c.mu.Lock()
+		c.users[key]--
+		c.mu.Unlock()
+		mu.Unlock()
+	}
+	repo = filepath.Join(c.root, key)
+	if _, err := os.Stat(repo); err == nil {
+		return repo, unlock, nil
+	} else if !os.IsNotExist(err) {
+		unlock()
+		return "", nil, err
+	}
+
+	// Create the repository aside so that a failure doesn't leave a
+	// half-initialized one behind.
+	tmp, err := ioutil.TempDir(c.root, "tmp-")
+	if err != nil {
+		unlock()
+		return "", nil, err
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet", "--bare", tmp},
+		{"--git-dir", tmp, "remote", "add", "origin", remote},
+	} {
+		if output, err := git(args...); err != nil {
+			os.RemoveAll(tmp)
+			unlock()
+			return "", nil, fmt.Errorf("Error trying to use git: %s (%s)", err, output)
+		}
+	}
+	if err := os.Rename(tmp, repo); err != nil {
+		os.RemoveAll(tmp)
+		unlock()
+		return "", nil, err
+	}
+	return repo, unlock, nil
+}
+
+// fetch updates buildRef of the repository repo to point to ref of its
+// remote.
+func fetch(repo, ref string, env []string) error {
+	// Shallow fetches of a commit ID are only supported by some servers, in
+	// which case everything is fetched instead.
+	output, err := gitEnv("", env, "--git-dir", repo, "fetch", "--quiet", "--force", "--depth", "1", "origin", "+"+ref+":"+buildRef)
+	if err == nil {
+		return nil
+	}
+
+	args := []string{"--git-dir", repo, "fetch", "--quiet", "--force", "--tags"}
+	if _, err := os.Stat(filepath.Join(repo, "shallow")); err == nil {
+		args = append(args, "--unshallow")
+	}
+	args = append(args, "origin", "+refs/heads/*:refs/remotes/origin/*")
+	if output, err := gitEnv("", env, args...); err != nil {
+		return fmt.Errorf("Error trying to use git: %s (%s)", err, output)
+	}
+	for _, name := range []string{ref, "origin/" + ref} {
+		commit, err := git("--git-dir", repo, "rev-parse", "--verify", "--quiet", name+"^{commit}")
+		if err != nil {
+			continue
+		}
+		if output, err := git("--git-dir", repo, "update-ref", buildRef, strings.TrimSpace(string(commit))); err != nil {
+			return fmt.Errorf("Error trying to use git: %s (%s)", err, output)
+		}
+		return nil
+	}
+	return fmt.Errorf("Error trying to use git: unable to fetch %q (%s)", ref, output)
+}
+
+// parseRemote splits remoteURL into the URL of the remote, without its
+// credentials, and its fragment. It returns the environment passing the
+// credentials, if any, to git.
+func parseRemote(remoteURL string, opts CheckoutOptions) (remote, fragment string, env []string, err error) {
+	if !urlutil.IsGitTransport(remoteURL) {
+		remoteURL = "https://" + remoteURL
+	}
+	remote = remoteURL
+	if i := strings.LastIndex(remoteURL, "#"); i >= 0 {
+		remote, fragment = remoteURL[:i], remoteURL[i+1:]
+	}
+	// Never prompt for credentials, the daemon has no terminal.
+	env = []string{"GIT_TERMINAL_PROMPT=0"}
+	if !urlutil.IsURL(remote) {
+		return remote, fragment, env, nil
+	}
+
+	u, err := url.Parse(remote)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if u.User != nil {
+		if opts.Username == "" && opts.Password == "" {
+			opts.Username = u.User.Username()
+			opts.Password, _ = u.User.Password()
+		}
+		u.User = nil
+	}
+	remote = u.String()
+
+	if opts.Username != "" || opts.Password != "" {
+		// The credentials are only sent to the host of the remote, and
+		// are passed in the environment to keep them out of the process
+		// list and of the configuration of the cached repository.
+		auth := base64.StdEncoding.EncodeToString([]byte(opts.Username + ":" + opts.Password))
+		scope := fmt.Sprintf("%s://%s/", u.Scheme, u.Host)
+		env = append(env, fmt.Sprintf("GIT_CONFIG_PARAMETERS='http.%s.extraheader=Authorization: Basic %s'", scope, auth))
+	}
+	return remote, fragment, env, nil
+}
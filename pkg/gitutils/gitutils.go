@@ -71,30 +71,51 @@ func checkoutGit(fragment, root string) (string, error) {
 		}
 	}
 
-	if len(refAndDir) > 1 && len(refAndDir[1]) != 0 {
-		newCtx, err := symlink.FollowSymlinkInScope(filepath.Join(root, refAndDir[1]), root)
-		if err != nil {
-			return "", fmt.Errorf("Error setting git context, %q not within git root: %s", refAndDir[1], err)
-		}
-
-		fi, err := os.Stat(newCtx)
-		if err != nil {
-			return "", err
-		}
-		if !fi.IsDir() {
-			return "", fmt.Errorf("Error setting git context, not a directory: %s", newCtx)
-		}
-		root = newCtx
+	if len(refAndDir) > 1 {
+		return subdirectory(root, refAndDir[1])
 	}
 
 	return root, nil
 }
 
+// subdirectory returns the directory dir of the checkout in root, or root
+// itself if dir is empty.
+func subdirectory(root, dir string) (string, error) {
+	if len(dir) == 0 {
+		return root, nil
+	}
+
+	newCtx, err := symlink.FollowSymlinkInScope(filepath.Join(root, dir), root)
+	if err != nil {
+		return "", fmt.Errorf("Error setting git context, %q not within git root: %s", dir, err)
+	}
+
+	fi, err := os.Stat(newCtx)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() {
+		return "", fmt.Errorf("Error setting git context, not a directory: %s", newCtx)
+	}
+	return newCtx, nil
+}
+
 func gitWithinDir(dir string, args ...string) ([]byte, error) {
 	a := []string{"--work-tree", dir, "--git-dir", filepath.Join(dir, ".git")}
 	return git(append(a, args...)...)
 }
 
 func git(args ...string) ([]byte, error) {
-	return exec.Command("git", args...).CombinedOutput()
+	return gitEnv("", nil, args...)
+}
+
+// gitEnv runs git from dir, or the current directory if empty, with env added
+// to the environment of the process.
+func gitEnv(dir string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd.CombinedOutput()
 }
@@ -170,3 +170,29 @@ func (sf *StderrFormatter) Write(buf []byte) (int, error) {
 	}
 	return len(buf), err
 }
+
+// AuxFormatter is a streamFormatter that writes auxiliary data, which is
+// only available with JSON streams.
+type AuxFormatter struct {
+	io.Writer
+	*StreamFormatter
+}
+
+// Emit writes aux as the auxiliary data of a message of the stream.
+func (sf *AuxFormatter) Emit(aux interface{}) error {
+	if !sf.json {
+		return fmt.Errorf("auxiliary data can only be sent in a JSON stream")
+	}
+	auxJSONBytes, err := json.Marshal(aux)
+	if err != nil {
+		return err
+	}
+	auxJSON := new(json.RawMessage)
+	*auxJSON = auxJSONBytes
+	b, err := json.Marshal(&jsonmessage.JSONMessage{Aux: auxJSON})
+	if err != nil {
+		return err
+	}
+	_, err = sf.Writer.Write(append(b, streamNewlineBytes...))
+	return err
+}
@@ -1,6 +1,7 @@
 package streamformatter
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"reflect"
@@ -106,3 +107,19 @@ func TestJSONFormatProgress(t *testing.T) {
 		t.Fatal("Original progress not equals progress from FormatProgress")
 	}
 }
+
+func TestAuxFormatterEmit(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	sf := &AuxFormatter{Writer: buf, StreamFormatter: NewJSONStreamFormatter()}
+	if err := sf.Emit(map[string]string{"key": "value"}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"aux":{"key":"value"}}` + "\r\n"; buf.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, buf.String())
+	}
+
+	sf = &AuxFormatter{Writer: buf, StreamFormatter: NewStreamFormatter()}
+	if err := sf.Emit("value"); err == nil {
+		t.Fatal("Expected an error when emitting aux data in a non JSON stream")
+	}
+}
@@ -15,8 +15,8 @@ import (
 
 // ServiceOptions holds command line options.
 type ServiceOptions struct {
-	Mirrors            []string `json:"registry-mirrors,omitempty"`
-	InsecureRegistries []string `json:"insecure-registries,omitempty"`
+	Mirrors            RegistryMirrors `json:"registry-mirrors,omitempty"`
+	InsecureRegistries []string        `json:"insecure-registries,omitempty"`
 
 	// V2Only controls access to legacy registries.  If it is set to true via the
 	// command line flag the daemon will not attempt to contact v1 legacy registries
@@ -27,6 +27,10 @@ type ServiceOptions struct {
 type serviceConfig struct {
 	registrytypes.ServiceConfig
 	V2Only bool
+
+	// registryMirrors are the mirrors of each registry, in the order they
+	// are tried.
+	registryMirrors map[string][]Mirror
 }
 
 var (
@@ -71,7 +75,7 @@ var lookupIP = net.LookupIP
 // InstallCliFlags adds command-line options to the top-level flag parser for
 // the current process.
 func (options *ServiceOptions) InstallCliFlags(cmd *flag.FlagSet, usageFn func(string) string) {
-	mirrors := opts.NewNamedListOptsRef("registry-mirrors", &options.Mirrors, ValidateMirror)
+	mirrors := opts.NewNamedListOptsRef("registry-mirrors", &options.Mirrors.Official, ValidateMirror)
 	cmd.Var(mirrors, []string{"-registry-mirror"}, usageFn("Preferred Docker registry mirror"))
 
 	insecureRegistries := opts.NewNamedListOptsRef("insecure-registries", &options.InsecureRegistries, ValidateIndexName)
@@ -89,15 +93,17 @@ func newServiceConfig(options ServiceOptions) *serviceConfig {
 	// daemon flags on boot2docker?
 	options.InsecureRegistries = append(options.InsecureRegistries, "127.0.0.0/8")
 
+	registryMirrors := options.Mirrors.byIndex()
 	config := &serviceConfig{
 		ServiceConfig: registrytypes.ServiceConfig{
 			InsecureRegistryCIDRs: make([]*registrytypes.NetIPNet, 0),
 			IndexConfigs:          make(map[string]*registrytypes.IndexInfo, 0),
 			// Hack: Bypass setting the mirrors to IndexConfigs since they are going away
-			// and Mirrors are only for the official registry anyways.
-			Mirrors: options.Mirrors,
+			// and Mirrors are only the ones of the official registry.
+			Mirrors: mirrorURLs(registryMirrors[IndexName]),
 		},
-		V2Only: options.V2Only,
+		V2Only:          options.V2Only,
+		registryMirrors: registryMirrors,
 	}
 	// Split --insecure-registry into CIDR and registry-specific settings.
 	for _, r := range options.InsecureRegistries {
@@ -110,7 +116,7 @@ func newServiceConfig(options ServiceOptions) *serviceConfig {
 			// Assume `host:port` if not CIDR.
 			config.IndexConfigs[r] = &registrytypes.IndexInfo{
 				Name:     r,
-				Mirrors:  make([]string, 0),
+				Mirrors:  mirrorURLs(registryMirrors[r]),
 				Secure:   false,
 				Official: false,
 			}
@@ -230,7 +236,7 @@ func newIndexInfo(config *serviceConfig, indexName string) (*registrytypes.Index
 	// Construct a non-configured index info.
 	index := &registrytypes.IndexInfo{
 		Name:     indexName,
-		Mirrors:  make([]string, 0),
+		Mirrors:  mirrorURLs(config.registryMirrors[indexName]),
 		Official: false,
 	}
 	index.Secure = isSecureIndex(config, indexName)
@@ -1,6 +1,7 @@
 package registry
 
 import (
+	"encoding/json"
 	"testing"
 )
 
@@ -47,3 +48,53 @@ func TestValidateMirror(t *testing.T) {
 		}
 	}
 }
+
+func TestRegistryMirrorsUnmarshalJSON(t *testing.T) {
+	var m RegistryMirrors
+	if err := json.Unmarshal([]byte(`["https://hub-mirror"]`), &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Official) != 1 || m.Official[0] != "https://hub-mirror" || len(m.Registries) != 0 {
+		t.Fatalf("unexpected mirrors %+v", m)
+	}
+
+	m = RegistryMirrors{}
+	if err := json.Unmarshal([]byte(`{"index.docker.io": ["https://hub-mirror"], "myregistry:5000": ["https://mirror1", {"url": "https://mirror2", "tlscacert": "/ca.pem"}]}`), &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Registries[IndexName]) != 1 {
+		t.Fatalf("expected the mirrors of %s, got %+v", IndexName, m.Registries)
+	}
+	mirrors := m.Registries["myregistry:5000"]
+	if len(mirrors) != 2 || mirrors[0].URL != "https://mirror1" || mirrors[1].URL != "https://mirror2" || mirrors[1].CACert != "/ca.pem" {
+		t.Fatalf("unexpected mirrors %+v", mirrors)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m2 RegistryMirrors
+	if err := json.Unmarshal(data, &m2); err != nil {
+		t.Fatal(err)
+	}
+	if len(m2.Registries["myregistry:5000"]) != 2 {
+		t.Fatalf("mirrors not preserved by marshaling: %s", data)
+	}
+
+	invalid := []string{
+		`"https://hub-mirror"`,
+		`{"myregistry:5000": [{"insecure": true}]}`,
+		`{"myregistry:5000": [{"url": "https://mirror", "tlscert": "/cert.pem"}]}`,
+		`{"-myregistry": ["https://mirror"]}`,
+		`["hub-mirror"]`,
+		`{"myregistry:5000": ["mirror:5000"]}`,
+		`{"myregistry:5000": ["ftp://mirror"]}`,
+		`{"myregistry:5000": [{"url": "https://mirror/v2/"}]}`,
+	}
+	for _, s := range invalid {
+		if err := json.Unmarshal([]byte(s), &RegistryMirrors{}); err == nil {
+			t.Errorf("expected an error for %s", s)
+		}
+	}
+}
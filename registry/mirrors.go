@@ -0,0 +1,184 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+)
+
+// Mirror is a pull-through mirror of a registry.
+type Mirror struct {
+	// URL is the address of the mirror, such as https://mirror.example.com.
+	URL string `json:"url"`
+	// Insecure disables the verification of the certificate of the mirror.
+	Insecure bool `json:"insecure,omitempty"`
+	// CACert is the path of the CA certificate the mirror is verified with.
+	CACert string `json:"tlscacert,omitempty"`
+	// Cert and Key are the paths of the client certificate and key
+	// presented to the mirror.
+	Cert string `json:"tlscert,omitempty"`
+	Key  string `json:"tlskey,omitempty"`
+}
+
+// UnmarshalJSON reads a mirror given either as its URL or as an object.
+func (m *Mirror) UnmarshalJSON(b []byte) error {
+	var u string
+	if err := json.Unmarshal(b, &u); err == nil {
+		*m = Mirror{URL: u}
+	} else {
+		// mirror has no UnmarshalJSON method to recurse into.
+		type mirror Mirror
+		if err := json.Unmarshal(b, (*mirror)(m)); err != nil {
+			return err
+		}
+	}
+	if m.URL == "" {
+		return errors.New("registry mirror without url")
+	}
+	if _, err := ValidateMirror(m.URL); err != nil {
+		return fmt.Errorf("invalid registry mirror %s: %v", m.URL, err)
+	}
+	if (m.Cert == "") != (m.Key == "") {
+		return fmt.Errorf("registry mirror %s: tlscert and tlskey must be set together", m.URL)
+	}
+	return nil
+}
+
+// RegistryMirrors is the registry-mirrors configuration, which is either a
+// list of mirrors of Docker Hub, or lists of mirrors by registry name:
+//
+//	"registry-mirrors": ["https://hub-mirror.example.com"]
+//	"registry-mirrors": {"myregistry:5000": ["https://mirror1", {"url": "https://mirror2", "insecure": true}]}
+type RegistryMirrors struct {
+	// Official are the mirrors of Docker Hub given as a list or with
+	// --registry-mirror.
+	Official []string
+	// Registries are the mirrors by registry name, in the order they are
+	// tried.
+	Registries map[string][]Mirror
+}
+
+// UnmarshalJSON reads either form of the registry-mirrors configuration.
+func (m *RegistryMirrors) UnmarshalJSON(b []byte) error {
+	var official []string
+	if err := json.Unmarshal(b, &official); err == nil {
+		for _, u := range official {
+			if _, err := ValidateMirror(u); err != nil {
+				return fmt.Errorf("invalid registry mirror %s: %v", u, err)
+			}
+		}
+		m.Official = official
+		return nil
+	}
+
+	var registries map[string][]Mirror
+	if err := json.Unmarshal(b, &registries); err != nil {
+		return fmt.Errorf("registry-mirrors must be a list of mirrors of Docker Hub, or lists of mirrors by registry: %v", err)
+	}
+	m.Registries = make(map[string][]Mirror)
+	for name, mirrors := range registries {
+		name, err := ValidateIndexName(name)
+		if err != nil {
+			return err
+		}
+		m.Registries[name] = append(m.Registries[name], mirrors...)
+	}
+	return nil
+}
+
+// MarshalJSON writes the mirrors as a list if there are only mirrors of
+// Docker Hub, and by registry name otherwise.
+func (m RegistryMirrors) MarshalJSON() ([]byte, error) {
+	if len(m.Registries) == 0 {
+		return json.Marshal(m.Official)
+	}
+	return json.Marshal(m.byIndex())
+}
+
+// byIndex returns the mirrors of each registry, the mirrors of Docker Hub
+// being under IndexName.
+func (m RegistryMirrors) byIndex() map[string][]Mirror {
+	mirrors := make(map[string][]Mirror)
+	for _, u := range m.Official {
+		mirrors[IndexName] = append(mirrors[IndexName], Mirror{URL: u})
+	}
+	for name, registryMirrors := range m.Registries {
+		mirrors[name] = append(mirrors[name], registryMirrors...)
+	}
+	return mirrors
+}
+
+// mirrorURLs returns the URLs of mirrors.
+func mirrorURLs(mirrors []Mirror) []string {
+	urls := make([]string, 0, len(mirrors))
+	for _, m := range mirrors {
+		urls = append(urls, m.URL)
+	}
+	return urls
+}
+
+// mirrorEndpoints returns the v2 endpoints of the mirrors of the registry
+// indexName, in the order they are tried.
+func (s *DefaultService) mirrorEndpoints(indexName string) ([]APIEndpoint, error) {
+	var endpoints []APIEndpoint
+	for _, mirror := range s.config.registryMirrors[indexName] {
+		u := mirror.URL
+		if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			u = "https://" + u
+		}
+		mirrorURL, err := url.Parse(u)
+		if err != nil {
+			return nil, err
+		}
+		mirrorTLSConfig, err := s.tlsConfigForMirror(mirrorURL, mirror)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, APIEndpoint{
+			URL: mirrorURL,
+			// guess mirrors are v2
+			Version:      APIVersion2,
+			Mirror:       true,
+			TrimHostname: true,
+			TLSConfig:    mirrorTLSConfig,
+		})
+	}
+	return endpoints, nil
+}
+
+// tlsConfigForMirror returns the TLS configuration of the mirror: the one
+// of its host, with the settings of the mirror applied.
+func (s *DefaultService) tlsConfigForMirror(mirrorURL *url.URL, mirror Mirror) (*tls.Config, error) {
+	tlsConfig, err := s.TLSConfig(mirrorURL.Host)
+	if err != nil {
+		return nil, err
+	}
+	if mirror.Insecure {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	if mirror.CACert != "" {
+		data, err := ioutil.ReadFile(mirror.CACert)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig.RootCAs == nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+		}
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in %s for registry mirror %s", mirror.CACert, mirror.URL)
+		}
+	}
+	if mirror.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(mirror.Cert, mirror.Key)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,82 @@
+package registry
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/distribution/registry/client/auth"
+	"github.com/docker/distribution/registry/client/transport"
+	"github.com/docker/engine-api/types"
+)
+
+type notaryCredentialStore struct {
+	auth types.AuthConfig
+}
+
+func (ncs notaryCredentialStore) Basic(*url.URL) (string, string) {
+	return ncs.auth.Username, ncs.auth.Password
+}
+
+func (ncs notaryCredentialStore) RefreshToken(*url.URL, string) string {
+	return ncs.auth.IdentityToken
+}
+
+func (ncs notaryCredentialStore) SetRefreshToken(*url.URL, string, string) {
+}
+
+// NotaryTransport returns the transport of the requests to the Notary server
+// for the trust data of the repository named repoName, authenticated with
+// authConfig for actions. The Notary server is pinged to set up the
+// authentication; if it cannot be reached, the transport is returned anyway
+// so that the cached trust data can be used offline.
+func NotaryTransport(server string, tlsConfig *tls.Config, userAgent string, metaHeaders http.Header, repoName string, authConfig types.AuthConfig, actions ...string) (http.RoundTripper, error) {
+	base := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		Dial: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			DualStack: true,
+		}).Dial,
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:     tlsConfig,
+		DisableKeepAlives:   true,
+	}
+
+	modifiers := DockerHeaders(userAgent, metaHeaders)
+	authTransport := transport.NewTransport(base, modifiers...)
+	pingClient := &http.Client{
+		Transport: authTransport,
+		Timeout:   5 * time.Second,
+	}
+	endpointStr := server + "/v2/"
+	req, err := http.NewRequest("GET", endpointStr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	challengeManager := auth.NewSimpleChallengeManager()
+
+	resp, err := pingClient.Do(req)
+	if err != nil {
+		// Ignore error on ping to operate in offline mode
+		logrus.Debugf("Error pinging notary server %q: %s", endpointStr, err)
+	} else {
+		defer resp.Body.Close()
+
+		// Add response to the challenge manager to parse out
+		// authentication header and register authentication method
+		if err := challengeManager.AddResponse(resp); err != nil {
+			return nil, err
+		}
+	}
+
+	creds := notaryCredentialStore{auth: authConfig}
+	tokenHandler := auth.NewTokenHandler(authTransport, creds, repoName, actions...)
+	basicHandler := auth.NewBasicHandler(creds)
+	modifiers = append(modifiers, transport.RequestModifier(auth.NewAuthorizer(challengeManager, tokenHandler, basicHandler)))
+	return transport.NewTransport(base, modifiers...), nil
+}
@@ -175,7 +175,7 @@ func makePublicIndex() *registrytypes.IndexInfo {
 
 func makeServiceConfig(mirrors []string, insecureRegistries []string) *serviceConfig {
 	options := ServiceOptions{
-		Mirrors:            mirrors,
+		Mirrors:            RegistryMirrors{Official: mirrors},
 		InsecureRegistries: insecureRegistries,
 	}
 
@@ -1,10 +1,12 @@
 package registry
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -684,6 +686,64 @@ func TestMirrorEndpointLookup(t *testing.T) {
 	}
 }
 
+func TestRegistryMirrorEndpointLookup(t *testing.T) {
+	var options ServiceOptions
+	if err := json.Unmarshal([]byte(`{"registry-mirrors": {"myregistry:5000": ["https://mirror1", {"url": "https://mirror2:5000", "insecure": true}]}}`), &options); err != nil {
+		t.Fatal(err)
+	}
+	s := DefaultService{config: newServiceConfig(options)}
+
+	pullAPIEndpoints, err := s.LookupPullEndpoints("myregistry:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hosts []string
+	for _, pe := range pullAPIEndpoints {
+		if pe.Version == APIVersion2 {
+			hosts = append(hosts, pe.URL.String())
+		}
+	}
+	expected := []string{"https://mirror1", "https://mirror2:5000", "https://myregistry:5000"}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Fatalf("Expected v2 pull endpoints %v, got %v", expected, hosts)
+	}
+	if !pullAPIEndpoints[0].Mirror || pullAPIEndpoints[0].TLSConfig.InsecureSkipVerify {
+		t.Fatal("Expected a secure mirror endpoint for mirror1")
+	}
+	if !pullAPIEndpoints[1].Mirror || !pullAPIEndpoints[1].TLSConfig.InsecureSkipVerify {
+		t.Fatal("Expected an insecure mirror endpoint for mirror2")
+	}
+
+	pushAPIEndpoints, err := s.LookupPushEndpoints("myregistry:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pe := range pushAPIEndpoints {
+		if pe.Mirror {
+			t.Fatalf("Push endpoint should not contain mirror %s", pe.URL)
+		}
+	}
+
+	// The mirrors of a registry are not the ones of the others.
+	pullAPIEndpoints, err = s.LookupPullEndpoints(IndexName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pe := range pullAPIEndpoints {
+		if pe.Mirror {
+			t.Fatalf("Pull endpoint of Docker Hub should not contain mirror %s", pe.URL)
+		}
+	}
+
+	index, err := s.ResolveIndex("myregistry:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"https://mirror1", "https://mirror2:5000"}; !reflect.DeepEqual(index.Mirrors, expected) {
+		t.Fatalf("Expected index mirrors %v, got %v", expected, index.Mirrors)
+	}
+}
+
 func TestPushRegistryTag(t *testing.T) {
 	r := spawnTestRegistrySession(t)
 	repoRef, err := reference.ParseNamed(REPO)
@@ -55,6 +55,102 @@ func ParseEnvFile(filename string) ([]string, error) {
 	return lines, scanner.Err()
 }
 
+// ParseDotEnvFile reads a file in the dotenv format, as used by
+// --build-arg-file. Like ParseEnvFile, it returns one "name=value" string per
+// variable, and variables without a value are taken from the environment.
+// In addition:
+//
+//   - lines may start with "export "
+//   - whitespace around names and unquoted values is trimmed, and unquoted
+//     values end at a " #" comment
+//   - values may be enclosed in single quotes, which are taken literally, or
+//     in double quotes, in which \n, \t, \", \$ and \\ are unescaped
+func ParseDotEnvFile(filename string) ([]string, error) {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return []string{}, err
+	}
+	defer fh.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(fh)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "export ") {
+			line = strings.TrimLeft(line[len("export "):], whiteSpaces)
+		}
+
+		data := strings.SplitN(line, "=", 2)
+		variable := strings.TrimRight(data[0], whiteSpaces)
+		if len(variable) == 0 || strings.ContainsAny(variable, whiteSpaces) {
+			return []string{}, ErrBadEnvVariable{fmt.Sprintf("line %d: variable '%s' has white spaces", lineNum, variable)}
+		}
+		if len(data) == 1 {
+			lines = append(lines, fmt.Sprintf("%s=%s", variable, os.Getenv(variable)))
+			continue
+		}
+
+		value, err := parseDotEnvValue(strings.TrimLeft(data[1], whiteSpaces))
+		if err != nil {
+			return []string{}, ErrBadEnvVariable{fmt.Sprintf("line %d: %v", lineNum, err)}
+		}
+		lines = append(lines, fmt.Sprintf("%s=%s", variable, value))
+	}
+	return lines, scanner.Err()
+}
+
+// parseDotEnvValue returns the value of a variable of a dotenv file, given
+// what follows the "=" sign.
+func parseDotEnvValue(raw string) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+
+	quote := raw[0]
+	if quote != '"' && quote != '\'' {
+		if i := strings.Index(raw, " #"); i >= 0 {
+			raw = raw[:i]
+		}
+		return strings.TrimRight(raw, whiteSpaces), nil
+	}
+
+	var (
+		value  []byte
+		escape bool
+	)
+	for i := 1; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case escape:
+			switch c {
+			case 'n':
+				value = append(value, '\n')
+			case 't':
+				value = append(value, '\t')
+			case '"', '$', '\\':
+				value = append(value, c)
+			default:
+				value = append(value, '\\', c)
+			}
+			escape = false
+		case c == '\\' && quote == '"':
+			escape = true
+		case c == quote:
+			rest := strings.TrimSpace(raw[i+1:])
+			if len(rest) > 0 && !strings.HasPrefix(rest, "#") {
+				return "", fmt.Errorf("unexpected characters after quoted value: %s", rest)
+			}
+			return string(value), nil
+		default:
+			value = append(value, c)
+		}
+	}
+	return "", fmt.Errorf("unterminated quoted value: %s", raw)
+}
+
 var whiteSpaces = " \t"
 
 // ErrBadEnvVariable typed error for bad environment variable
@@ -140,3 +140,56 @@ another invalid line`
 		t.Fatalf("Expected [%v], got [%v]", expectedMessage, err.Error())
 	}
 }
+
+// Test ParseDotEnvFile for a file using the dotenv syntax
+func TestParseDotEnvFile(t *testing.T) {
+	os.Setenv("DOTENV_TEST_FROM_ENV", "from env")
+	defer os.Unsetenv("DOTENV_TEST_FROM_ENV")
+
+	content := `# release metadata
+export VERSION=1.2.3
+NAME = my app # inline comment
+EMPTY=
+SINGLE='$literal \n # kept'
+DOUBLE="line1\nline2 \"quoted\" \$HOME" # comment
+HASH=a#b
+DOTENV_TEST_FROM_ENV
+`
+	tmpFile := tmpFileWithContent(content, t)
+	defer os.Remove(tmpFile)
+
+	lines, err := ParseDotEnvFile(tmpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedLines := []string{
+		"VERSION=1.2.3",
+		"NAME=my app",
+		"EMPTY=",
+		"SINGLE=$literal \\n # kept",
+		"DOUBLE=line1\nline2 \"quoted\" $HOME",
+		"HASH=a#b",
+		"DOTENV_TEST_FROM_ENV=from env",
+	}
+	if !reflect.DeepEqual(lines, expectedLines) {
+		t.Fatalf("Expected %q, got %q", expectedLines, lines)
+	}
+}
+
+// Test ParseDotEnvFile for badly formatted values
+func TestParseDotEnvFileBadlyFormattedFile(t *testing.T) {
+	for _, content := range []string{
+		"FOO=\"unterminated\n",
+		"FOO='value' trailing\n",
+		"FOO BAR=baz\n",
+		"=value\n",
+	} {
+		tmpFile := tmpFileWithContent(content, t)
+		_, err := ParseDotEnvFile(tmpFile)
+		os.Remove(tmpFile)
+		if _, ok := err.(ErrBadEnvVariable); !ok {
+			t.Fatalf("Expected an ErrBadEnvVariable for %q, got %v", content, err)
+		}
+	}
+}